@@ -9,14 +9,9 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
-	"github.com/pkg/errors"
 )
 
 // AccountLimit defines a usage limit imposed on account
@@ -63,131 +58,91 @@ type Account struct {
 	Users                []AccountUser   `json:"users,omitempty"`                  // [] len >= 0
 }
 
+// accountResource describes the account endpoint
+var accountResource = RegisterResource(&Resource[Account]{
+	Name:     "account",
+	Plural:   "accounts",
+	Prefix:   config.AccountPrefix,
+	CIDRegex: config.AccountCIDRegex,
+	CID:      func(o *Account) string { return o.CID },
+	Current:  true,
+})
+
 // FetchAccount retrieves account with passed cid. Pass nil for '/account/current'.
-func (a *API) FetchAccount(cid CIDType) (*Account, error) {
-	var accountCID string
-
-	switch {
-	case cid == nil:
-		fallthrough
-	case *cid == "":
-		accountCID = config.AccountPrefix + "/current"
-	case !strings.HasPrefix(*cid, config.AccountPrefix):
-		accountCID = fmt.Sprintf("%s/%s", config.AccountPrefix, *cid)
-	default:
-		accountCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.AccountCIDRegex, accountCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid account CID (%s)", accountCID)
-	}
-
-	result, err := a.Get(accountCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching account")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch account, received JSON: %s", string(result))
-	}
-
-	account := new(Account)
-	if err := json.Unmarshal(result, account); err != nil {
-		return nil, errors.Wrap(err, "parsing account")
-	}
-
-	return account, nil
+func (a *API) FetchAccount(cid CIDType, opts ...CallOption) (*Account, error) {
+	return a.FetchAccountWithContext(context.Background(), cid, opts...)
 }
 
-// FetchAccounts retrieves all accounts available to the API Token.
-func (a *API) FetchAccounts() (*[]Account, error) {
-	result, err := a.Get(config.AccountPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching accounts")
-	}
+// FetchAccountWithContext is FetchAccount with a context for cancellation and deadlines.
+func (a *API) FetchAccountWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*Account, error) {
+	return accountResource.Fetch(ctx, a, cid, opts...)
+}
 
-	var accounts []Account
-	if err := json.Unmarshal(result, &accounts); err != nil {
-		return nil, errors.Wrap(err, "parsing accounts")
-	}
+// FetchAccounts retrieves all accounts available to the API Token.
+func (a *API) FetchAccounts(opts ...CallOption) (*[]Account, error) {
+	return a.FetchAccountsWithContext(context.Background(), opts...)
+}
 
-	return &accounts, nil
+// FetchAccountsWithContext is FetchAccounts with a context for cancellation and deadlines.
+func (a *API) FetchAccountsWithContext(ctx context.Context, opts ...CallOption) (*[]Account, error) {
+	return accountResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateAccount updates passed account.
-func (a *API) UpdateAccount(cfg *Account) (*Account, error) {
-	if cfg == nil {
-		return nil, errors.Errorf("invalid account config (nil)")
-	}
+func (a *API) UpdateAccount(cfg *Account, opts ...CallOption) (*Account, error) {
+	return a.UpdateAccountWithContext(context.Background(), cfg, opts...)
+}
 
-	accountCID := cfg.CID
+// UpdateAccountWithContext is UpdateAccount with a context for cancellation and deadlines.
+func (a *API) UpdateAccountWithContext(ctx context.Context, cfg *Account, opts ...CallOption) (*Account, error) {
+	return accountResource.Update(ctx, a, cfg, opts...)
+}
 
-	matched, err := regexp.MatchString(config.AccountCIDRegex, accountCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid account CID (%s)", accountCID)
-	}
+// PatchAccount applies patch (see Patcher) to the account with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchAccount(cid CIDType, patch Patcher, opts ...CallOption) (*Account, error) {
+	return a.PatchAccountWithContext(context.Background(), cid, patch, opts...)
+}
+
+// PatchAccountWithContext is PatchAccount with a context for cancellation and deadlines.
+func (a *API) PatchAccountWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*Account, error) {
+	return accountResource.Patch(ctx, a, cid, patch, opts...)
+}
 
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
+// SearchAccounts returns accounts matching a filter (search queries are not
+// supported by the account endpoint). Pass nil as filter for all accounts the
+// API Token can access.
+func (a *API) SearchAccounts(filterCriteria *SearchFilterType, opts ...CallOption) (*[]Account, error) {
+	return a.SearchAccountsWithContext(context.Background(), filterCriteria, opts...)
+}
 
-	if a.Debug {
-		a.Log.Printf("account update, sending JSON: %s", string(jsonCfg))
-	}
+// SearchAccountsWithContext is SearchAccounts with a context for cancellation and deadlines.
+func (a *API) SearchAccountsWithContext(ctx context.Context, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Account, error) {
+	return accountResource.Search(ctx, a, nil, filterCriteria, opts...)
+}
 
-	result, err := a.Put(accountCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating account")
-	}
+// IterateAccounts calls fn for each account matching a filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateAccounts(filterCriteria *SearchFilterType, fn func(*Account) error) error {
+	return a.IterateAccountsWithContext(context.Background(), filterCriteria, fn)
+}
 
-	account := &Account{}
-	if err := json.Unmarshal(result, account); err != nil {
-		return nil, errors.Wrap(err, "parsing account")
-	}
+// IterateAccountsWithContext is IterateAccounts with a context for cancellation and deadlines.
+func (a *API) IterateAccountsWithContext(ctx context.Context, filterCriteria *SearchFilterType, fn func(*Account) error) error {
+	return accountResource.Iterate(ctx, a, nil, filterCriteria, fn)
+}
 
-	return account, nil
+// BulkUpdateAccounts updates accounts concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateAccounts(cfgs []*Account, opts *BulkOptions) BulkResults[*Account] {
+	return a.BulkUpdateAccountsWithContext(context.Background(), cfgs, opts)
 }
 
-// SearchAccounts returns accounts matching a filter (search queries are not
-// supported by the account endpoint). Pass nil as filter for all accounts the
-// API Token can access.
-func (a *API) SearchAccounts(filterCriteria *SearchFilterType) (*[]Account, error) {
-	q := url.Values{}
-
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
-
-	if q.Encode() == "" {
-		return a.FetchAccounts()
-	}
-
-	reqURL := url.URL{
-		Path:     config.AccountPrefix,
-		RawQuery: q.Encode(),
-	}
-
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching accounts")
-	}
-
-	var accounts []Account
-	if err := json.Unmarshal(result, &accounts); err != nil {
-		return nil, err
-	}
-
-	return &accounts, nil
+// BulkUpdateAccountsWithContext is BulkUpdateAccounts with a context for cancellation and deadlines.
+func (a *API) BulkUpdateAccountsWithContext(ctx context.Context, cfgs []*Account, opts *BulkOptions) BulkResults[*Account] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Account) (*Account, error) {
+		return a.UpdateAccountWithContext(ctx, cfg)
+	})
 }
@@ -9,14 +9,9 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
-	"github.com/pkg/errors"
 )
 
 // Acknowledgement defines a acknowledgement. See https://login.circonus.com/resources/api/calls/acknowledgement for more information.
@@ -32,166 +27,120 @@ type Acknowledgement struct {
 	Active            bool        `json:"_active,omitempty"`            // bool
 }
 
+// acknowledgementResource describes the acknowledgement endpoint
+var acknowledgementResource = RegisterResource(&Resource[Acknowledgement]{
+	Name:            "acknowledgement",
+	Plural:          "acknowledgements",
+	Prefix:          config.AcknowledgementPrefix,
+	CIDRegex:        config.AcknowledgementCIDRegex,
+	CID:             func(o *Acknowledgement) string { return o.CID },
+	LastModified:    func(o *Acknowledgement) uint { return o.LastModified },
+	SetLastModified: func(o *Acknowledgement, lastModified uint) { o.LastModified = lastModified },
+})
+
 // NewAcknowledgement returns new Acknowledgement (with defaults, if applicable).
 func NewAcknowledgement() *Acknowledgement {
 	return &Acknowledgement{}
 }
 
 // FetchAcknowledgement retrieves acknowledgement with passed cid.
-func (a *API) FetchAcknowledgement(cid CIDType) (*Acknowledgement, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.Errorf("invalid acknowledgement CID (none)")
-	}
-
-	var acknowledgementCID string
-	if !strings.HasPrefix(*cid, config.AcknowledgementPrefix) {
-		acknowledgementCID = fmt.Sprintf("%s/%s", config.AcknowledgementPrefix, *cid)
-	} else {
-		acknowledgementCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.AcknowledgementCIDRegex, acknowledgementCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid acknowledgement CID (%s)", acknowledgementCID)
-	}
-
-	result, err := a.Get(acknowledgementCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching acknowledgement")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch acknowledgement, received JSON: %s", string(result))
-	}
-
-	acknowledgement := &Acknowledgement{}
-	if err := json.Unmarshal(result, acknowledgement); err != nil {
-		return nil, errors.Wrap(err, "parsing acknowledgement")
-	}
-
-	return acknowledgement, nil
+func (a *API) FetchAcknowledgement(cid CIDType, opts ...CallOption) (*Acknowledgement, error) {
+	return a.FetchAcknowledgementWithContext(context.Background(), cid, opts...)
 }
 
-// FetchAcknowledgements retrieves all acknowledgements available to the API Token.
-func (a *API) FetchAcknowledgements() (*[]Acknowledgement, error) {
-	result, err := a.Get(config.AcknowledgementPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching acknowledgements")
-	}
+// FetchAcknowledgementWithContext is FetchAcknowledgement with a context for cancellation and deadlines.
+func (a *API) FetchAcknowledgementWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*Acknowledgement, error) {
+	return acknowledgementResource.Fetch(ctx, a, cid, opts...)
+}
 
-	var acknowledgements []Acknowledgement
-	if err := json.Unmarshal(result, &acknowledgements); err != nil {
-		return nil, errors.Wrap(err, "parsing acknowledgements")
-	}
+// FetchAcknowledgements retrieves all acknowledgements available to the API Token.
+func (a *API) FetchAcknowledgements(opts ...CallOption) (*[]Acknowledgement, error) {
+	return a.FetchAcknowledgementsWithContext(context.Background(), opts...)
+}
 
-	return &acknowledgements, nil
+// FetchAcknowledgementsWithContext is FetchAcknowledgements with a context for cancellation and deadlines.
+func (a *API) FetchAcknowledgementsWithContext(ctx context.Context, opts ...CallOption) (*[]Acknowledgement, error) {
+	return acknowledgementResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateAcknowledgement updates passed acknowledgement.
-func (a *API) UpdateAcknowledgement(cfg *Acknowledgement) (*Acknowledgement, error) {
-	if cfg == nil {
-		return nil, errors.Errorf("invalid acknowledgement config (nil)")
-	}
-
-	acknowledgementCID := cfg.CID
+func (a *API) UpdateAcknowledgement(cfg *Acknowledgement, opts ...CallOption) (*Acknowledgement, error) {
+	return a.UpdateAcknowledgementWithContext(context.Background(), cfg, opts...)
+}
 
-	matched, err := regexp.MatchString(config.AcknowledgementCIDRegex, acknowledgementCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid acknowledgement CID (%s)", acknowledgementCID)
-	}
+// UpdateAcknowledgementWithContext is UpdateAcknowledgement with a context for cancellation and deadlines.
+func (a *API) UpdateAcknowledgementWithContext(ctx context.Context, cfg *Acknowledgement, opts ...CallOption) (*Acknowledgement, error) {
+	return acknowledgementResource.Update(ctx, a, cfg, opts...)
+}
 
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
+// PatchAcknowledgement applies patch (see Patcher) to the acknowledgement with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchAcknowledgement(cid CIDType, patch Patcher, opts ...CallOption) (*Acknowledgement, error) {
+	return a.PatchAcknowledgementWithContext(context.Background(), cid, patch, opts...)
+}
 
-	if a.Debug {
-		a.Log.Printf("acknowledgement update, sending JSON: %s", string(jsonCfg))
-	}
+// PatchAcknowledgementWithContext is PatchAcknowledgement with a context for cancellation and deadlines.
+func (a *API) PatchAcknowledgementWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*Acknowledgement, error) {
+	return acknowledgementResource.Patch(ctx, a, cid, patch, opts...)
+}
 
-	result, err := a.Put(acknowledgementCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating acknowledgement")
-	}
+// CreateAcknowledgement creates a new acknowledgement.
+func (a *API) CreateAcknowledgement(cfg *Acknowledgement, opts ...CallOption) (*Acknowledgement, error) {
+	return a.CreateAcknowledgementWithContext(context.Background(), cfg, opts...)
+}
 
-	acknowledgement := &Acknowledgement{}
-	if err := json.Unmarshal(result, acknowledgement); err != nil {
-		return nil, errors.Wrap(err, "parsing acknowledgement")
-	}
+// CreateAcknowledgementWithContext is CreateAcknowledgement with a context for cancellation and deadlines.
+func (a *API) CreateAcknowledgementWithContext(ctx context.Context, cfg *Acknowledgement, opts ...CallOption) (*Acknowledgement, error) {
+	return acknowledgementResource.Create(ctx, a, cfg, opts...)
+}
 
-	return acknowledgement, nil
+// SearchAcknowledgements returns acknowledgements matching
+// the specified search query and/or filter. If nil is passed for
+// both parameters all acknowledgements will be returned.
+func (a *API) SearchAcknowledgements(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Acknowledgement, error) {
+	return a.SearchAcknowledgementsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
 }
 
-// CreateAcknowledgement creates a new acknowledgement.
-func (a *API) CreateAcknowledgement(cfg *Acknowledgement) (*Acknowledgement, error) {
-	if cfg == nil {
-		return nil, errors.Errorf("invalid acknowledgement config (nil)")
-	}
+// SearchAcknowledgementsWithContext is SearchAcknowledgements with a context for cancellation and deadlines.
+func (a *API) SearchAcknowledgementsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Acknowledgement, error) {
+	return acknowledgementResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
+// IterateAcknowledgements calls fn for each acknowledgement matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateAcknowledgements(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Acknowledgement) error) error {
+	return a.IterateAcknowledgementsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	result, err := a.Post(config.AcknowledgementPrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating acknowledgement")
-	}
+// IterateAcknowledgementsWithContext is IterateAcknowledgements with a context for cancellation and deadlines.
+func (a *API) IterateAcknowledgementsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Acknowledgement) error) error {
+	return acknowledgementResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	if a.Debug {
-		a.Log.Printf("acknowledgement create, sending JSON: %s", string(jsonCfg))
-	}
+// BulkCreateAcknowledgements creates acknowledgements concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateAcknowledgements(cfgs []*Acknowledgement, opts *BulkOptions) BulkResults[*Acknowledgement] {
+	return a.BulkCreateAcknowledgementsWithContext(context.Background(), cfgs, opts)
+}
 
-	acknowledgement := &Acknowledgement{}
-	if err := json.Unmarshal(result, acknowledgement); err != nil {
-		return nil, errors.Wrap(err, "parsing acknowledgement")
-	}
+// BulkCreateAcknowledgementsWithContext is BulkCreateAcknowledgements with a context for cancellation and deadlines.
+func (a *API) BulkCreateAcknowledgementsWithContext(ctx context.Context, cfgs []*Acknowledgement, opts *BulkOptions) BulkResults[*Acknowledgement] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Acknowledgement) (*Acknowledgement, error) {
+		return a.CreateAcknowledgementWithContext(ctx, cfg)
+	})
+}
 
-	return acknowledgement, nil
+// BulkUpdateAcknowledgements updates acknowledgements concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateAcknowledgements(cfgs []*Acknowledgement, opts *BulkOptions) BulkResults[*Acknowledgement] {
+	return a.BulkUpdateAcknowledgementsWithContext(context.Background(), cfgs, opts)
 }
 
-// SearchAcknowledgements returns acknowledgements matching
-// the specified search query and/or filter. If nil is passed for
-// both parameters all acknowledgements will be returned.
-func (a *API) SearchAcknowledgements(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]Acknowledgement, error) {
-	q := url.Values{}
-
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
-
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
-
-	if q.Encode() == "" {
-		return a.FetchAcknowledgements()
-	}
-
-	reqURL := url.URL{
-		Path:     config.AcknowledgementPrefix,
-		RawQuery: q.Encode(),
-	}
-
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching acknowledgements")
-	}
-
-	var acknowledgements []Acknowledgement
-	if err := json.Unmarshal(result, &acknowledgements); err != nil {
-		return nil, errors.Wrap(err, "parsing acknowledgements")
-	}
-
-	return &acknowledgements, nil
+// BulkUpdateAcknowledgementsWithContext is BulkUpdateAcknowledgements with a context for cancellation and deadlines.
+func (a *API) BulkUpdateAcknowledgementsWithContext(ctx context.Context, cfgs []*Acknowledgement, opts *BulkOptions) BulkResults[*Acknowledgement] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Acknowledgement) (*Acknowledgement, error) {
+		return a.UpdateAcknowledgementWithContext(ctx, cfg)
+	})
 }
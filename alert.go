@@ -8,14 +8,9 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
-	"github.com/pkg/errors"
 )
 
 // Alert defines a alert. See https://login.circonus.com/resources/api/calls/alert for more information.
@@ -39,95 +34,57 @@ type Alert struct {
 	Severity           uint     `json:"_severity,omitempty"`        // uint
 }
 
-// FetchAlert retrieves alert with passed cid.
-func (a *API) FetchAlert(cid CIDType) (*Alert, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid alert CID (none)")
-	}
-
-	var alertCID string
-	if !strings.HasPrefix(*cid, config.AlertPrefix) {
-		alertCID = fmt.Sprintf("%s/%s", config.AlertPrefix, *cid)
-	} else {
-		alertCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.AlertCIDRegex, alertCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid alert CID (%s)", alertCID)
-	}
-
-	result, err := a.Get(alertCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching alert")
-	}
+// alertResource describes the alert endpoint
+var alertResource = RegisterResource(&Resource[Alert]{
+	Name:     "alert",
+	Plural:   "alerts",
+	Prefix:   config.AlertPrefix,
+	CIDRegex: config.AlertCIDRegex,
+	CID:      func(o *Alert) string { return o.CID },
+	Tags:     func(o *Alert) *[]string { return &o.Tags },
+})
 
-	if a.Debug {
-		a.Log.Printf("fetch alert, received JSON: %s", string(result))
-	}
-
-	alert := &Alert{}
-	if err := json.Unmarshal(result, alert); err != nil {
-		return nil, errors.Wrap(err, "parsing alert")
-	}
+// FetchAlert retrieves alert with passed cid.
+func (a *API) FetchAlert(cid CIDType, opts ...CallOption) (*Alert, error) {
+	return a.FetchAlertWithContext(context.Background(), cid, opts...)
+}
 
-	return alert, nil
+// FetchAlertWithContext is FetchAlert with a context for cancellation and deadlines.
+func (a *API) FetchAlertWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*Alert, error) {
+	return alertResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchAlerts retrieves all alerts available to the API Token.
-func (a *API) FetchAlerts() (*[]Alert, error) {
-	result, err := a.Get(config.AlertPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching alerts")
-	}
-
-	var alerts []Alert
-	if err := json.Unmarshal(result, &alerts); err != nil {
-		return nil, errors.Wrap(err, "parsing alerts")
-	}
+func (a *API) FetchAlerts(opts ...CallOption) (*[]Alert, error) {
+	return a.FetchAlertsWithContext(context.Background(), opts...)
+}
 
-	return &alerts, nil
+// FetchAlertsWithContext is FetchAlerts with a context for cancellation and deadlines.
+func (a *API) FetchAlertsWithContext(ctx context.Context, opts ...CallOption) (*[]Alert, error) {
+	return alertResource.FetchAll(ctx, a, opts...)
 }
 
 // SearchAlerts returns alerts matching the specified search query
 // and/or filter. If nil is passed for both parameters all alerts
 // will be returned.
-func (a *API) SearchAlerts(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]Alert, error) {
-	q := url.Values{}
-
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
-
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
-
-	if q.Encode() == "" {
-		return a.FetchAlerts()
-	}
-
-	reqURL := url.URL{
-		Path:     config.AlertPrefix,
-		RawQuery: q.Encode(),
-	}
+func (a *API) SearchAlerts(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Alert, error) {
+	return a.SearchAlertsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching alerts")
-	}
+// SearchAlertsWithContext is SearchAlerts with a context for cancellation and deadlines.
+func (a *API) SearchAlertsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Alert, error) {
+	return alertResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	var alerts []Alert
-	if err := json.Unmarshal(result, &alerts); err != nil {
-		return nil, errors.Wrap(err, "parsing alerts")
-	}
+// IterateAlerts calls fn for each alert matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateAlerts(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Alert) error) error {
+	return a.IterateAlertsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	return &alerts, nil
+// IterateAlertsWithContext is IterateAlerts with a context for cancellation and deadlines.
+func (a *API) IterateAlertsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Alert) error) error {
+	return alertResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
 }
@@ -8,11 +8,7 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -32,204 +28,157 @@ type Annotation struct {
 	Stop           uint     `json:"stop"`                        // uint
 }
 
+// annotationResource describes the annotation endpoint
+var annotationResource = RegisterResource(&Resource[Annotation]{
+	Name:            "annotation",
+	Plural:          "annotations",
+	Prefix:          config.AnnotationPrefix,
+	CIDRegex:        config.AnnotationCIDRegex,
+	CID:             func(o *Annotation) string { return o.CID },
+	LastModified:    func(o *Annotation) uint { return o.LastModified },
+	SetLastModified: func(o *Annotation, lastModified uint) { o.LastModified = lastModified },
+})
+
 // NewAnnotation returns a new Annotation (with defaults, if applicable)
 func NewAnnotation() *Annotation {
 	return &Annotation{}
 }
 
 // FetchAnnotation retrieves annotation with passed cid.
-func (a *API) FetchAnnotation(cid CIDType) (*Annotation, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid annotation CID (none)")
-	}
-
-	var annotationCID string
-	if !strings.HasPrefix(*cid, config.AnnotationPrefix) {
-		annotationCID = fmt.Sprintf("%s/%s", config.AnnotationPrefix, *cid)
-	} else {
-		annotationCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.AnnotationCIDRegex, annotationCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid annotation CID (%s)", annotationCID)
-	}
-
-	result, err := a.Get(annotationCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching annotation")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch annotation, received JSON: %s", string(result))
-	}
-
-	annotation := &Annotation{}
-	if err := json.Unmarshal(result, annotation); err != nil {
-		return nil, errors.Wrap(err, "parsing annotation")
-	}
+func (a *API) FetchAnnotation(cid CIDType, opts ...CallOption) (*Annotation, error) {
+	return a.FetchAnnotationWithContext(context.Background(), cid, opts...)
+}
 
-	return annotation, nil
+// FetchAnnotationWithContext is FetchAnnotation with a context for cancellation and deadlines.
+func (a *API) FetchAnnotationWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*Annotation, error) {
+	return annotationResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchAnnotations retrieves all annotations available to the API Token.
-func (a *API) FetchAnnotations() (*[]Annotation, error) {
-	result, err := a.Get(config.AnnotationPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching annotations")
-	}
-
-	var annotations []Annotation
-	if err := json.Unmarshal(result, &annotations); err != nil {
-		return nil, errors.Wrap(err, "parsing annotations")
-	}
+func (a *API) FetchAnnotations(opts ...CallOption) (*[]Annotation, error) {
+	return a.FetchAnnotationsWithContext(context.Background(), opts...)
+}
 
-	return &annotations, nil
+// FetchAnnotationsWithContext is FetchAnnotations with a context for cancellation and deadlines.
+func (a *API) FetchAnnotationsWithContext(ctx context.Context, opts ...CallOption) (*[]Annotation, error) {
+	return annotationResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateAnnotation updates passed annotation.
-func (a *API) UpdateAnnotation(cfg *Annotation) (*Annotation, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid annotation config (nil)")
-	}
-
-	annotationCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.AnnotationCIDRegex, annotationCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid annotation CID (%s)", annotationCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update annotation, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) UpdateAnnotation(cfg *Annotation, opts ...CallOption) (*Annotation, error) {
+	return a.UpdateAnnotationWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Put(annotationCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating annotation")
-	}
+// UpdateAnnotationWithContext is UpdateAnnotation with a context for cancellation and deadlines.
+func (a *API) UpdateAnnotationWithContext(ctx context.Context, cfg *Annotation, opts ...CallOption) (*Annotation, error) {
+	return annotationResource.Update(ctx, a, cfg, opts...)
+}
 
-	annotation := &Annotation{}
-	if err := json.Unmarshal(result, annotation); err != nil {
-		return nil, errors.Wrap(err, "parsing annotation")
-	}
+// PatchAnnotation applies patch (see Patcher) to the annotation with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchAnnotation(cid CIDType, patch Patcher, opts ...CallOption) (*Annotation, error) {
+	return a.PatchAnnotationWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return annotation, nil
+// PatchAnnotationWithContext is PatchAnnotation with a context for cancellation and deadlines.
+func (a *API) PatchAnnotationWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*Annotation, error) {
+	return annotationResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateAnnotation creates a new annotation.
-func (a *API) CreateAnnotation(cfg *Annotation) (*Annotation, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid annotation config (nil)")
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create annotation, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Post(config.AnnotationPrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating annotation")
-	}
-
-	annotation := &Annotation{}
-	if err := json.Unmarshal(result, annotation); err != nil {
-		return nil, errors.Wrap(err, "parsing annotation")
-	}
+func (a *API) CreateAnnotation(cfg *Annotation, opts ...CallOption) (*Annotation, error) {
+	return a.CreateAnnotationWithContext(context.Background(), cfg, opts...)
+}
 
-	return annotation, nil
+// CreateAnnotationWithContext is CreateAnnotation with a context for cancellation and deadlines.
+func (a *API) CreateAnnotationWithContext(ctx context.Context, cfg *Annotation, opts ...CallOption) (*Annotation, error) {
+	return annotationResource.Create(ctx, a, cfg, opts...)
 }
 
 // DeleteAnnotation deletes passed annotation.
-func (a *API) DeleteAnnotation(cfg *Annotation) (bool, error) {
+func (a *API) DeleteAnnotation(cfg *Annotation, opts ...CallOption) (bool, error) {
+	return a.DeleteAnnotationWithContext(context.Background(), cfg, opts...)
+}
+
+// DeleteAnnotationWithContext is DeleteAnnotation with a context for cancellation and deadlines.
+func (a *API) DeleteAnnotationWithContext(ctx context.Context, cfg *Annotation, opts ...CallOption) (bool, error) {
 	if cfg == nil {
 		return false, errors.New("invalid annotation config (nil)")
 	}
 
-	return a.DeleteAnnotationByCID(CIDType(&cfg.CID))
+	return a.DeleteAnnotationByCIDWithContext(ctx, CIDType(&cfg.CID), opts...)
 }
 
 // DeleteAnnotationByCID deletes annotation with passed cid.
-func (a *API) DeleteAnnotationByCID(cid CIDType) (bool, error) {
-	if cid == nil || *cid == "" {
-		return false, errors.New("invalid annotation CID (none)")
-	}
-
-	var annotationCID string
-	if !strings.HasPrefix(*cid, config.AnnotationPrefix) {
-		annotationCID = fmt.Sprintf("%s/%s", config.AnnotationPrefix, *cid)
-	} else {
-		annotationCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.AnnotationCIDRegex, annotationCID)
-	if err != nil {
-		return false, err
-	}
-	if !matched {
-		return false, errors.Errorf("invalid annotation CID (%s)", annotationCID)
-	}
-
-	_, err = a.Delete(annotationCID)
-	if err != nil {
-		return false, errors.Wrap(err, "deleting annotation")
-	}
+func (a *API) DeleteAnnotationByCID(cid CIDType, opts ...CallOption) (bool, error) {
+	return a.DeleteAnnotationByCIDWithContext(context.Background(), cid, opts...)
+}
 
-	return true, nil
+// DeleteAnnotationByCIDWithContext is DeleteAnnotationByCID with a context for cancellation and deadlines.
+func (a *API) DeleteAnnotationByCIDWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (bool, error) {
+	return annotationResource.Delete(ctx, a, cid, opts...)
 }
 
 // SearchAnnotations returns annotations matching the specified
 // search query and/or filter. If nil is passed for both parameters
 // all annotations will be returned.
-func (a *API) SearchAnnotations(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]Annotation, error) {
-	q := url.Values{}
+func (a *API) SearchAnnotations(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Annotation, error) {
+	return a.SearchAnnotationsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
+// SearchAnnotationsWithContext is SearchAnnotations with a context for cancellation and deadlines.
+func (a *API) SearchAnnotationsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Annotation, error) {
+	return annotationResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
+// IterateAnnotations calls fn for each annotation matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateAnnotations(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Annotation) error) error {
+	return a.IterateAnnotationsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	if q.Encode() == "" {
-		return a.FetchAnnotations()
-	}
+// IterateAnnotationsWithContext is IterateAnnotations with a context for cancellation and deadlines.
+func (a *API) IterateAnnotationsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Annotation) error) error {
+	return annotationResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	reqURL := url.URL{
-		Path:     config.AnnotationPrefix,
-		RawQuery: q.Encode(),
-	}
+// BulkCreateAnnotations creates annotations concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateAnnotations(cfgs []*Annotation, opts *BulkOptions) BulkResults[*Annotation] {
+	return a.BulkCreateAnnotationsWithContext(context.Background(), cfgs, opts)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching annotations")
-	}
+// BulkCreateAnnotationsWithContext is BulkCreateAnnotations with a context for cancellation and deadlines.
+func (a *API) BulkCreateAnnotationsWithContext(ctx context.Context, cfgs []*Annotation, opts *BulkOptions) BulkResults[*Annotation] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Annotation) (*Annotation, error) {
+		return a.CreateAnnotationWithContext(ctx, cfg)
+	})
+}
 
-	var annotations []Annotation
-	if err := json.Unmarshal(result, &annotations); err != nil {
-		return nil, errors.Wrap(err, "parsing annotations")
-	}
+// BulkUpdateAnnotations updates annotations concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateAnnotations(cfgs []*Annotation, opts *BulkOptions) BulkResults[*Annotation] {
+	return a.BulkUpdateAnnotationsWithContext(context.Background(), cfgs, opts)
+}
+
+// BulkUpdateAnnotationsWithContext is BulkUpdateAnnotations with a context for cancellation and deadlines.
+func (a *API) BulkUpdateAnnotationsWithContext(ctx context.Context, cfgs []*Annotation, opts *BulkOptions) BulkResults[*Annotation] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Annotation) (*Annotation, error) {
+		return a.UpdateAnnotationWithContext(ctx, cfg)
+	})
+}
+
+// BulkDeleteAnnotations deletes annotations by cid concurrently (see BulkOptions),
+// the results are in the same order as cids.
+func (a *API) BulkDeleteAnnotations(cids []string, opts *BulkOptions) BulkResults[bool] {
+	return a.BulkDeleteAnnotationsWithContext(context.Background(), cids, opts)
+}
 
-	return &annotations, nil
+// BulkDeleteAnnotationsWithContext is BulkDeleteAnnotations with a context for cancellation and deadlines.
+func (a *API) BulkDeleteAnnotationsWithContext(ctx context.Context, cids []string, opts *BulkOptions) BulkResults[bool] {
+	return Bulk(ctx, cids, opts, func(ctx context.Context, cid string) (bool, error) {
+		return a.DeleteAnnotationByCIDWithContext(ctx, CIDType(&cid))
+	})
 }
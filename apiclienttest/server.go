@@ -0,0 +1,637 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package apiclienttest provides a stateful, in-memory fake of the Circonus
+// v2 API for testing code which uses apiclient.
+//
+//	srv := apiclienttest.NewServer()
+//	defer srv.Close()
+//
+//	client, err := apiclient.New(srv.Config())
+//	...
+//	bundle, err := client.CreateCheckBundle(cfg)
+//
+// Objects for every endpoint prefix are stored as JSON documents. Creates
+// assign a _cid (and _created/_last_modified), updates maintain
+// _last_modified, and list requests support search, f_ filters and size/from
+// paging. Faults (e.g. 429, 500, slow responses or dropped connections) can be
+// injected with InjectFault.
+package apiclienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apiclient "github.com/circonus-labs/go-apiclient"
+	"github.com/circonus-labs/go-apiclient/config"
+)
+
+// Object is a stored API object
+type Object map[string]interface{}
+
+// Fault describes an error injected into matching requests
+type Fault struct {
+	// Method to match, empty matches all methods
+	Method string
+	// Path prefix to match (e.g. /check_bundle), empty matches all paths
+	Path string
+	// StatusCode to respond with, 0 serves the request normally (after Delay)
+	StatusCode int
+	// RetryAfter sets the Retry-After header on the response
+	RetryAfter time.Duration
+	// Delay before responding, e.g. longer than the client timeout
+	Delay time.Duration
+	// Drop closes the connection without a response
+	Drop bool
+	// Times the fault is applied, 0 applies it until ClearFaults
+	Times int
+}
+
+// Request is a request received by the Server
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+// Server is an in-memory fake of the Circonus v2 API
+type Server struct {
+	*httptest.Server
+	objects  map[string]map[string]Object // prefix -> cid -> object
+	order    map[string][]string          // prefix -> cids in creation order
+	nextID   map[string]int
+	faults   []*Fault
+	requests []Request
+	mu       sync.Mutex
+}
+
+// Prefixes are the endpoint prefixes served
+var Prefixes = []string{
+	config.AccountPrefix,
+	config.AcknowledgementPrefix,
+	config.AlertPrefix,
+	config.AnnotationPrefix,
+	config.BrokerPrefix,
+	config.CheckBundleMetricsPrefix,
+	config.CheckBundlePrefix,
+	config.CheckPrefix,
+	config.ContactGroupPrefix,
+	config.DashboardPrefix,
+	config.GraphPrefix,
+	config.MaintenancePrefix,
+	config.MetricClusterPrefix,
+	config.MetricPrefix,
+	config.OutlierReportPrefix,
+	config.ProvisionBrokerPrefix,
+	config.RuleSetGroupPrefix,
+	config.RuleSetPrefix,
+	config.UserPrefix,
+	config.WorksheetPrefix,
+}
+
+const basePath = "/v2"
+
+// NewServer starts a fake API server, call Close when done
+func NewServer() *Server {
+	s := &Server{
+		objects: make(map[string]map[string]Object),
+		order:   make(map[string][]string),
+		nextID:  make(map[string]int),
+	}
+	for _, prefix := range Prefixes {
+		s.objects[prefix] = make(map[string]Object)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// APIURL returns the API URL of the server (for apiclient.Config.URL)
+func (s *Server) APIURL() string {
+	return s.URL + basePath
+}
+
+// Config returns an apiclient.Config for the server, with short retry delays
+func (s *Server) Config() *apiclient.Config {
+	return &apiclient.Config{
+		URL:           s.APIURL(),
+		TokenKey:      "apiclienttest",
+		TokenApp:      "apiclienttest",
+		MinRetryDelay: "10ms",
+		MaxRetryDelay: "50ms",
+	}
+}
+
+// Seed stores obj (any value which marshals to a json object) as is,
+// assigning a _cid when it does not have one. Returns the cid.
+func (s *Server) Seed(prefix string, obj interface{}) (string, error) {
+	if _, ok := s.objects[prefix]; !ok {
+		return "", fmt.Errorf("unknown prefix (%s)", prefix)
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	o, err := decodeObject(data)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cid, _ := o["_cid"].(string)
+	if cid == "" {
+		cid = s.newCID(prefix)
+		o["_cid"] = cid
+	}
+	s.store(prefix, cid, o)
+	return cid, nil
+}
+
+// Object returns a copy of the stored object with cid
+func (s *Server) Object(cid string) (Object, bool) {
+	prefix, _ := splitPath(cid)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.objects[prefix][cid]
+	if !ok {
+		return nil, false
+	}
+	return copyObject(o), true
+}
+
+// Objects returns copies of the stored objects for prefix, in creation order
+func (s *Server) Objects(prefix string) []Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objs := make([]Object, 0, len(s.order[prefix]))
+	for _, cid := range s.order[prefix] {
+		objs = append(objs, copyObject(s.objects[prefix][cid]))
+	}
+	return objs
+}
+
+// InjectFault adds a fault, faults are checked in the order added
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns the requests received, in order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request", err.Error())
+		return
+	}
+
+	apiPath := strings.TrimPrefix(r.URL.Path, basePath)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: apiPath, Query: r.URL.RawQuery, Body: string(body)})
+	fault := s.fault(r.Method, apiPath)
+	s.mu.Unlock()
+
+	if fault != nil {
+		if fault.Delay > 0 {
+			select {
+			case <-time.After(fault.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault.Drop {
+			if hj, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hj.Hijack(); err == nil {
+					conn.Close()
+					return
+				}
+			}
+			panic(http.ErrAbortHandler)
+		}
+		if fault.StatusCode != 0 {
+			if fault.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int((fault.RetryAfter+time.Second-1)/time.Second)))
+			}
+			writeError(w, fault.StatusCode, "Injected fault", "apiclienttest injected fault")
+			return
+		}
+	}
+
+	if r.Header.Get("X-Circonus-Auth-Token") == "" {
+		writeError(w, http.StatusForbidden, "Authentication failed", "missing X-Circonus-Auth-Token")
+		return
+	}
+
+	prefix, id := splitPath(apiPath)
+	if _, ok := s.objects[prefix]; !ok {
+		writeError(w, http.StatusNotFound, "Not found", "unknown endpoint "+apiPath)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		s.list(w, r, prefix)
+	case r.Method == http.MethodGet:
+		s.get(w, prefix, apiPath, id)
+	case r.Method == http.MethodPost && id == "":
+		s.create(w, prefix, body)
+	case r.Method == http.MethodPut && id != "":
+		s.update(w, prefix, apiPath, body)
+	case r.Method == http.MethodDelete && id != "":
+		s.delete(w, prefix, apiPath)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed", r.Method+" "+apiPath)
+	}
+}
+
+// fault returns the first matching fault, the caller must hold the lock
+func (s *Server) fault(method, apiPath string) *Fault {
+	for i, f := range s.faults {
+		if f.Method != "" && f.Method != method {
+			continue
+		}
+		if f.Path != "" && !strings.HasPrefix(apiPath, f.Path) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, prefix string) {
+	q := r.URL.Query()
+
+	s.mu.Lock()
+	var results []Object
+	for _, cid := range s.order[prefix] {
+		o := s.objects[prefix][cid]
+		if matchSearch(o, q.Get("search")) && matchFilters(o, q) {
+			results = append(results, o)
+		}
+	}
+	s.mu.Unlock()
+
+	from, _ := strconv.Atoi(q.Get("from"))
+	if from > len(results) {
+		from = len(results)
+	}
+	results = results[from:]
+	if size, err := strconv.Atoi(q.Get("size")); err == nil && size >= 0 && size < len(results) {
+		results = results[:size]
+	}
+	if results == nil {
+		results = []Object{}
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) get(w http.ResponseWriter, prefix, cid, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == "current" && len(s.order[prefix]) > 0 {
+		// e.g. /user/current, /account/current
+		cid = s.order[prefix][0]
+	}
+
+	o, ok := s.objects[prefix][cid]
+	if !ok {
+		writeNotFound(w, cid)
+		return
+	}
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (s *Server) create(w http.ResponseWriter, prefix string, body []byte) {
+	o, err := decodeObject(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := json.Number(strconv.FormatInt(time.Now().Unix(), 10))
+	cid := s.newCID(prefix)
+	o["_cid"] = cid
+	o["_created"] = now
+	o["_last_modified"] = now
+	o["_last_modified_by"] = "/user/0"
+
+	if prefix == config.CheckBundlePrefix {
+		// the API creates a check per broker
+		var checks []interface{}
+		brokers, _ := o["brokers"].([]interface{})
+		for _, broker := range brokers {
+			checkCID := s.newCID(config.CheckPrefix)
+			s.store(config.CheckPrefix, checkCID, Object{
+				"_cid":          checkCID,
+				"_active":       true,
+				"_broker":       broker,
+				"_check_bundle": cid,
+				"_check_uuid":   fmt.Sprintf("00000000-0000-0000-0000-%012d", s.nextID[config.CheckPrefix]),
+				"_details":      map[string]interface{}{},
+			})
+			checks = append(checks, checkCID)
+		}
+		o["_checks"] = checks
+	}
+
+	s.store(prefix, cid, o)
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (s *Server) update(w http.ResponseWriter, prefix, cid string, body []byte) {
+	o, err := decodeObject(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, ok := s.objects[prefix][cid]
+	if !ok {
+		writeNotFound(w, cid)
+		return
+	}
+
+	// read only, server maintained, fields are kept
+	for k, v := range cur {
+		if strings.HasPrefix(k, "_") {
+			o[k] = v
+		}
+	}
+	o["_cid"] = cid
+	last, _ := strconv.ParseInt(fmt.Sprint(cur["_last_modified"]), 10, 64)
+	now := time.Now().Unix()
+	if now <= last {
+		now = last + 1 // always changes on update
+	}
+	o["_last_modified"] = json.Number(strconv.FormatInt(now, 10))
+
+	s.objects[prefix][cid] = o
+	writeJSON(w, http.StatusOK, o)
+}
+
+func (s *Server) delete(w http.ResponseWriter, prefix, cid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.objects[prefix][cid]; !ok {
+		writeNotFound(w, cid)
+		return
+	}
+	delete(s.objects[prefix], cid)
+	for i, c := range s.order[prefix] {
+		if c == cid {
+			s.order[prefix] = append(s.order[prefix][:i], s.order[prefix][i+1:]...)
+			break
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newCID returns the next cid for prefix, the caller must hold the lock
+func (s *Server) newCID(prefix string) string {
+	for {
+		s.nextID[prefix]++
+		cid := prefix + "/" + strconv.Itoa(s.nextID[prefix])
+		if _, exists := s.objects[prefix][cid]; !exists {
+			return cid
+		}
+	}
+}
+
+// store saves an object, the caller must hold the lock
+func (s *Server) store(prefix, cid string, o Object) {
+	if _, exists := s.objects[prefix][cid]; !exists {
+		s.order[prefix] = append(s.order[prefix], cid)
+	}
+	s.objects[prefix][cid] = o
+}
+
+// matchSearch approximates the API search syntax. Terms of the form
+// (field:value) match a field (or an element of a list field, e.g.
+// (tags:env:prod)) case insensitively, other text must be contained in one
+// of the object's string values. A term prefixed with ! must not match.
+func matchSearch(o Object, search string) bool {
+	search = strings.TrimSpace(search)
+	for search != "" {
+		negate := strings.HasPrefix(search, "!")
+		search = strings.TrimPrefix(search, "!")
+
+		var term string
+		if strings.HasPrefix(search, "(") {
+			end := strings.Index(search, ")")
+			if end < 0 {
+				end = len(search) - 1
+			}
+			term, search = search[1:end], strings.TrimSpace(search[end+1:])
+			if i := strings.Index(term, ":"); i >= 0 {
+				field, value := term[:i], term[i+1:]
+				if matchField(o[field], unquoteSearch(value), strings.EqualFold) == negate {
+					return false
+				}
+				continue
+			}
+		} else {
+			end := strings.Index(search, "(")
+			if end < 0 {
+				end = len(search)
+			}
+			if bang := strings.Index(search, "!("); bang >= 0 && bang < end {
+				end = bang
+			}
+			term, search = strings.TrimSpace(search[:end]), search[end:]
+		}
+		if containsText(o, strings.ToLower(unquoteSearch(term))) == negate {
+			return false
+		}
+	}
+	return true
+}
+
+// unquoteSearch removes the quotes, and escapes, of a quoted search value
+func unquoteSearch(value string) string {
+	if len(value) < 2 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		return value
+	}
+	return strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(value[1 : len(value)-1])
+}
+
+// matchFilters applies f_ filters, multiple values for a filter match any
+// value and all filters must match. f_<field>_has matches an element of a list
+// field and f_<field>_wildcard matches shell style patterns (e.g. foo*).
+func matchFilters(o Object, q map[string][]string) bool {
+	for key, values := range q {
+		if !strings.HasPrefix(key, "f_") {
+			continue
+		}
+		field := strings.TrimPrefix(key, "f_")
+		match := func(a, b string) bool { return a == b }
+		switch {
+		case strings.HasSuffix(field, "_has"):
+			field = strings.TrimSuffix(field, "_has")
+		case strings.HasSuffix(field, "_wildcard"):
+			field = strings.TrimSuffix(field, "_wildcard")
+			match = func(a, pattern string) bool {
+				ok, _ := path.Match(pattern, a)
+				return ok
+			}
+		}
+		found := false
+		for _, v := range values {
+			if matchField(o[field], v, match) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func matchField(field interface{}, value string, match func(string, string) bool) bool {
+	switch f := field.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, e := range f {
+			if matchField(e, value, match) {
+				return true
+			}
+		}
+		return false
+	case bool:
+		if value == "1" || value == "0" {
+			return f == (value == "1")
+		}
+		return match(strconv.FormatBool(f), value)
+	default:
+		return match(fmt.Sprint(f), value)
+	}
+}
+
+func containsText(v interface{}, text string) bool {
+	switch t := v.(type) {
+	case string:
+		return strings.Contains(strings.ToLower(t), text)
+	case []interface{}:
+		for _, e := range t {
+			if containsText(e, text) {
+				return true
+			}
+		}
+	case Object:
+		for _, e := range t {
+			if containsText(e, text) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, e := range t {
+			if containsText(e, text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitPath splits an api path into the endpoint prefix and the id
+func splitPath(apiPath string) (string, string) {
+	p := strings.TrimPrefix(apiPath, "/")
+	parts := strings.SplitN(p, "/", 2)
+	if len(parts) < 2 {
+		return "/" + parts[0], ""
+	}
+	return "/" + parts[0], parts[1]
+}
+
+func decodeObject(data []byte) (Object, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var o Object
+	if err := dec.Decode(&o); err != nil {
+		return nil, err
+	}
+	if o == nil {
+		o = Object{}
+	}
+	return o, nil
+}
+
+func copyObject(o Object) Object {
+	data, _ := json.Marshal(o)
+	c, _ := decodeObject(data)
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeNotFound(w http.ResponseWriter, cid string) {
+	writeError(w, http.StatusNotFound, "Object not found", cid+" does not exist")
+}
+
+func writeError(w http.ResponseWriter, status int, message, explanation string) {
+	code := "ObjectError"
+	switch {
+	case status == http.StatusTooManyRequests:
+		code = "RateLimit"
+	case status >= 500:
+		code = "InternalError"
+	case status == http.StatusForbidden:
+		code = "Authentication"
+	}
+	writeJSON(w, status, map[string]string{
+		"code":        code,
+		"message":     message,
+		"explanation": explanation,
+		"reference":   strconv.FormatInt(time.Now().UnixNano(), 36),
+	})
+}
@@ -0,0 +1,233 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclienttest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	apiclient "github.com/circonus-labs/go-apiclient"
+	"github.com/circonus-labs/go-apiclient/config"
+)
+
+func newClient(t *testing.T, srv *Server) *apiclient.API {
+	t.Helper()
+	client, err := apiclient.New(srv.Config())
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	return client
+}
+
+func TestCRUD(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	client := newClient(t, srv)
+
+	cfg := apiclient.NewCheckBundle()
+	cfg.DisplayName = "web check"
+	cfg.Type = "http"
+	cfg.Target = "www.example.com"
+	cfg.Brokers = []string{"/broker/1"}
+	cfg.Config = apiclient.CheckBundleConfig{config.URL: "https://www.example.com/"}
+
+	bundle, err := client.CreateCheckBundle(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if bundle.CID != "/check_bundle/1" {
+		t.Fatalf("unexpected cid (%s)", bundle.CID)
+	}
+	if bundle.LastModified == 0 || bundle.Created == 0 {
+		t.Fatalf("expected _created and _last_modified, got %d %d", bundle.Created, bundle.LastModified)
+	}
+	if len(bundle.Checks) != 1 {
+		t.Fatalf("expected 1 check, got %v", bundle.Checks)
+	}
+
+	check, err := client.FetchCheck(apiclient.CIDType(&bundle.Checks[0]))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if check.CheckBundleCID != bundle.CID {
+		t.Fatalf("unexpected check bundle cid (%s)", check.CheckBundleCID)
+	}
+
+	bundle.DisplayName = "renamed"
+	bundle.LastModified = 1 // read only, kept by the server
+	updated, err := client.UpdateCheckBundle(bundle)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if updated.DisplayName != "renamed" {
+		t.Fatalf("unexpected name (%s)", updated.DisplayName)
+	}
+	if updated.LastModified <= 1 {
+		t.Fatalf("expected _last_modified to advance, got %d", updated.LastModified)
+	}
+
+	fetched, err := client.FetchCheckBundle(apiclient.CIDType(&bundle.CID))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if fetched.DisplayName != "renamed" || fetched.LastModified != updated.LastModified {
+		t.Fatalf("unexpected bundle %#v", fetched)
+	}
+
+	if _, err := client.DeleteCheckBundleByCID(apiclient.CIDType(&bundle.CID)); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if _, err := client.FetchCheckBundle(apiclient.CIDType(&bundle.CID)); !apiclient.IsNotFound(err) {
+		t.Fatalf("expected not found, got (%v)", err)
+	}
+	if _, ok := srv.Object(bundle.CID); ok {
+		t.Fatal("expected object to be deleted")
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	client := newClient(t, srv)
+
+	if _, err := client.FetchUser(nil); !apiclient.IsNotFound(err) {
+		t.Fatalf("expected not found, got (%v)", err)
+	}
+
+	if _, err := srv.Seed(config.UserPrefix, apiclient.User{Email: "jane@example.com"}); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	user, err := client.FetchUser(nil)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if user.CID != "/user/1" || user.Email != "jane@example.com" {
+		t.Fatalf("unexpected user %#v", user)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	for _, g := range []apiclient.Graph{
+		{Title: "CPU web1", Tags: []string{"env:prod", "role:web"}},
+		{Title: "CPU db1", Tags: []string{"env:prod", "role:db"}},
+		{Title: "Memory web2", Tags: []string{"env:dev", "role:web"}},
+	} {
+		if _, err := srv.Seed(config.GraphPrefix, g); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+
+	client := newClient(t, srv)
+
+	tests := []struct {
+		search   apiclient.SearchQueryType
+		filter   apiclient.SearchFilterType
+		expected []string
+		desc     string
+	}{
+		{"", nil, []string{"CPU web1", "CPU db1", "Memory web2"}, "all"},
+		{"cpu", nil, []string{"CPU web1", "CPU db1"}, "text"},
+		{"(tags:role:web)", nil, []string{"CPU web1", "Memory web2"}, "tag term"},
+		{"(tags:role:web) cpu", nil, []string{"CPU web1"}, "term and text"},
+		{"", apiclient.SearchFilterType{"f_tags_has": []string{"env:dev"}}, []string{"Memory web2"}, "has filter"},
+		{"", apiclient.SearchFilterType{"f_title": []string{"CPU db1", "Memory web2"}}, []string{"CPU db1", "Memory web2"}, "any filter value"},
+		{"", apiclient.SearchFilterType{"f_title_wildcard": []string{"CPU*"}, "f_tags_has": []string{"role:db"}}, []string{"CPU db1"}, "all filters"},
+		{"nothing", nil, []string{}, "no match"},
+		{`!(tags:"env:prod")`, nil, []string{"Memory web2"}, "negated term"},
+		{"!cpu", nil, []string{"Memory web2"}, "negated text"},
+		{*apiclient.NewSearchQuery().Tag("role:web").Not().Text("memory").Query(), nil, []string{"CPU web1"}, "builder"},
+		{"", *apiclient.NewSearchFilter().Tags("env:prod").Wildcard("title", "*db*").Filter(), []string{"CPU db1"}, "filter builder"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			graphs, err := client.SearchGraphs(&test.search, &test.filter)
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			titles := []string{}
+			for _, g := range *graphs {
+				titles = append(titles, g.Title)
+			}
+			if len(titles) != len(test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, titles)
+			}
+			for i := range titles {
+				if titles[i] != test.expected[i] {
+					t.Fatalf("expected %v, got %v", test.expected, titles)
+				}
+			}
+		})
+	}
+
+	t.Run("paging", func(t *testing.T) {
+		resp, err := client.Get("/graph?size=1&from=1")
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if want := `[{"_cid":"/graph/2"`; string(resp[:len(want)]) != want {
+			t.Fatalf("unexpected page (%s)", resp)
+		}
+	})
+}
+
+func TestFaults(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	cid, err := srv.Seed(config.BrokerPrefix, apiclient.Broker{Name: "b1"})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	client := newClient(t, srv)
+
+	t.Run("retried", func(t *testing.T) {
+		srv.InjectFault(Fault{Path: config.BrokerPrefix, StatusCode: http.StatusInternalServerError, Times: 1})
+		srv.InjectFault(Fault{Method: http.MethodGet, Drop: true, Times: 1})
+		if _, err := client.FetchBroker(apiclient.CIDType(&cid)); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if n := len(srv.Requests()); n != 3 {
+			t.Fatalf("expected 3 requests, got %d", n)
+		}
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		srv.InjectFault(Fault{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second})
+		defer srv.ClearFaults()
+
+		cfg := srv.Config()
+		cfg.DisableRetries = true
+		c, err := apiclient.New(cfg)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		_, err = c.FetchBroker(apiclient.CIDType(&cid))
+		if !apiclient.IsRateLimited(err) {
+			t.Fatalf("expected rate limited, got (%v)", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		srv.InjectFault(Fault{Delay: time.Second, Times: 1})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := client.FetchBrokerWithContext(ctx, apiclient.CIDType(&cid))
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got (%v)", err)
+		}
+	})
+}
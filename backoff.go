@@ -0,0 +1,130 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	crand "crypto/rand"
+	"math"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BackoffPolicy decides how long to wait before retrying a failed request when
+// exponential backoff is enabled (see Config.BackoffPolicy and EnableExponentialBackoff)
+type BackoffPolicy interface {
+	// Backoff returns the wait before retry number attempt (starting at 1). prev
+	// is the previous wait (0 before the first retry) and random returns a
+	// pseudo-random number in [0.0,1.0) from the API random source (see Config.RandSource).
+	Backoff(attempt int, prev time.Duration, random func() float64) time.Duration
+}
+
+// BackoffFunc is a custom BackoffPolicy
+type BackoffFunc func(attempt int, prev time.Duration, random func() float64) time.Duration
+
+// Backoff calls f
+func (f BackoffFunc) Backoff(attempt int, prev time.Duration, random func() float64) time.Duration {
+	return f(attempt, prev, random)
+}
+
+// DefaultBackoffPolicy is used when Config.BackoffPolicy is not set, waits of
+// 2s, 4s, 8s, 16s then 32s, each reduced by up to half at random
+var DefaultBackoffPolicy = NewExponentialBackoff(2*time.Second, 32*time.Second)
+
+// NewConstantBackoff returns a policy waiting the same time before every retry
+func NewConstantBackoff(wait time.Duration) BackoffPolicy {
+	return BackoffFunc(func(int, time.Duration, func() float64) time.Duration {
+		return wait
+	})
+}
+
+// NewExponentialBackoff returns a policy doubling the wait from base for each
+// retry, up to max. Each wait is reduced by up to half at random so clients
+// retrying at the same time spread out.
+func NewExponentialBackoff(base, max time.Duration) BackoffPolicy {
+	return BackoffFunc(func(attempt int, _ time.Duration, random func() float64) time.Duration {
+		wait := max
+		if attempt < 63 {
+			if d := base * time.Duration(uint64(1)<<uint(attempt-1)); d > 0 && d < max {
+				wait = d
+			}
+		}
+		return wait/2 + time.Duration(random()*float64(wait/2))
+	})
+}
+
+// NewDecorrelatedJitterBackoff returns a policy waiting a random time between
+// base and three times the previous wait, up to max
+func NewDecorrelatedJitterBackoff(base, max time.Duration) BackoffPolicy {
+	return BackoffFunc(func(_ int, prev time.Duration, random func() float64) time.Duration {
+		upper := math.Max(float64(base), 3*float64(prev))
+		wait := time.Duration(float64(base) + random()*(upper-float64(base)))
+		if wait > max {
+			wait = max
+		}
+		return wait
+	})
+}
+
+// Clock is the time source for retry waits, the rate limiter and the circuit
+// breaker (see Config.Clock)
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d, it returns ctx.Err() if ctx is done first
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// systemClock is the real time Clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// lockedRand is a random source safe for concurrent requests
+type lockedRand struct {
+	rnd *rand.Rand
+	mu  sync.Mutex
+}
+
+func newLockedRand(src rand.Source) *lockedRand {
+	if src == nil {
+		n, err := crand.Int(crand.Reader, big.NewInt(math.MaxInt64))
+		if err != nil {
+			src = rand.NewSource(time.Now().UTC().UnixNano())
+		} else {
+			src = rand.NewSource(n.Int64())
+		}
+	}
+	return &lockedRand{rnd: rand.New(src)} //nolint:gosec //G404
+}
+
+func (r *lockedRand) Float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rnd.Float64()
+}
+
+// retryWithin reports whether a retry after wait starts within the max retry
+// duration of a request which started at start
+func (a *API) retryWithin(start time.Time, wait time.Duration) bool {
+	if a.maxRetryDuration <= 0 {
+		return true
+	}
+	return a.clock.Now().Add(wait).Sub(start) <= a.maxRetryDuration
+}
@@ -0,0 +1,194 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock advances when sleeping instead of waiting
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+	mu     sync.Mutex
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+func TestBackoffPolicies(t *testing.T) {
+	fixed := func(f float64) func() float64 { return func() float64 { return f } }
+
+	tests := []struct {
+		policy  BackoffPolicy
+		random  func() float64
+		id      string
+		attempt int
+		prev    time.Duration
+		want    time.Duration
+	}{
+		{id: "constant", policy: NewConstantBackoff(3 * time.Second), attempt: 5, random: fixed(.9), want: 3 * time.Second},
+		{id: "exponential first", policy: NewExponentialBackoff(2*time.Second, 32*time.Second), attempt: 1, random: fixed(0), want: time.Second},
+		{id: "exponential third", policy: NewExponentialBackoff(2*time.Second, 32*time.Second), attempt: 3, random: fixed(.5), want: 6 * time.Second},
+		{id: "exponential max", policy: NewExponentialBackoff(2*time.Second, 32*time.Second), attempt: 9, random: fixed(0), want: 16 * time.Second},
+		{id: "exponential overflow", policy: NewExponentialBackoff(2*time.Second, 32*time.Second), attempt: 100, random: fixed(0), want: 16 * time.Second},
+		{id: "decorrelated first", policy: NewDecorrelatedJitterBackoff(time.Second, time.Minute), attempt: 1, random: fixed(.5), want: time.Second},
+		{id: "decorrelated next", policy: NewDecorrelatedJitterBackoff(time.Second, time.Minute), attempt: 2, prev: 3 * time.Second, random: fixed(.5), want: 5 * time.Second},
+		{id: "decorrelated max", policy: NewDecorrelatedJitterBackoff(time.Second, time.Minute), attempt: 5, prev: time.Minute, random: fixed(.9), want: time.Minute},
+		{id: "custom", policy: BackoffFunc(func(attempt int, _ time.Duration, _ func() float64) time.Duration {
+			return time.Duration(attempt) * time.Millisecond
+		}), attempt: 7, random: fixed(0), want: 7 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			if got := test.policy.Backoff(test.attempt, test.prev, test.random); got != test.want {
+				t.Fatalf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestBackoffRequest(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if r.URL.Path == "/recover" && calls > 3 {
+			fmt.Fprintln(w, `{"ok":true}`)
+			return
+		}
+		if r.URL.Path == "/limited" {
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(429)
+			return
+		}
+		w.WriteHeader(500)
+		fmt.Fprintln(w, "error")
+	}))
+	defer server.Close()
+
+	newAPI := func(t *testing.T, cfg *Config) (*API, *fakeClock) {
+		t.Helper()
+		clock := &fakeClock{now: time.Unix(0, 0)}
+		cfg.TokenKey = "foo"
+		cfg.URL = server.URL
+		cfg.ExponentialBackoff = true
+		cfg.Clock = clock
+		apih, err := NewAPI(cfg)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		return apih, clock
+	}
+
+	t.Run("policy", func(t *testing.T) {
+		calls = 0
+		apih, clock := newAPI(t, &Config{BackoffPolicy: NewConstantBackoff(time.Hour)})
+
+		start := time.Now()
+		if _, err := apih.Get("/recover"); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("expected no real waits (%s)", elapsed)
+		}
+		if want := []time.Duration{time.Hour, time.Hour, time.Hour}; !reflect.DeepEqual(clock.sleeps, want) {
+			t.Fatalf("expected waits %v, got %v", want, clock.sleeps)
+		}
+	})
+
+	t.Run("max retry duration", func(t *testing.T) {
+		calls = 0
+		apih, clock := newAPI(t, &Config{BackoffPolicy: NewConstantBackoff(time.Minute), MaxRetryDuration: "3m30s"})
+
+		_, err := apih.Get("/fail")
+		if !IsServerError(err) {
+			t.Fatalf("expected server error, got (%v)", err)
+		}
+		apiErr, _ := AsAPIError(err)
+		if apiErr.Retries != 3 || len(clock.sleeps) != 3 || calls != 4 {
+			t.Fatalf("expected 3 retries, got %d (%d waits, %d calls)", apiErr.Retries, len(clock.sleeps), calls)
+		}
+	})
+
+	t.Run("random source", func(t *testing.T) {
+		var waits [][]time.Duration
+		for i := 0; i < 2; i++ {
+			calls = 0
+			apih, clock := newAPI(t, &Config{RandSource: rand.NewSource(42)})
+			if _, err := apih.Get("/recover"); err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			waits = append(waits, clock.sleeps)
+		}
+		if !reflect.DeepEqual(waits[0], waits[1]) {
+			t.Fatalf("expected the same waits, got %v and %v", waits[0], waits[1])
+		}
+		for i, wait := range waits[0] {
+			max := 2 * time.Second << uint(i)
+			if wait < max/2 || wait >= max {
+				t.Fatalf("wait %d (%s) not in [%s,%s)", i, wait, max/2, max)
+			}
+		}
+	})
+
+	t.Run("without exponential backoff", func(t *testing.T) {
+		tests := []struct {
+			cfg   *Config
+			path  string
+			waits []time.Duration
+		}{
+			{&Config{}, "/recover", []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+			{&Config{MaxRetries: 2}, "/limited", []time.Duration{3 * time.Second, 3 * time.Second}},
+			{&Config{MaxRetryDuration: "2s"}, "/fail", []time.Duration{time.Second}},
+		}
+
+		for _, test := range tests {
+			calls = 0
+			apih, clock := newAPI(t, test.cfg)
+			apih.DisableExponentialBackoff()
+
+			start := time.Now()
+			_, _ = apih.Get(test.path)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("%s: expected no real waits (%s)", test.path, elapsed)
+			}
+			if !reflect.DeepEqual(clock.sleeps, test.waits) {
+				t.Fatalf("%s: expected waits %v, got %v", test.path, test.waits, clock.sleeps)
+			}
+		}
+	})
+
+	t.Run("invalid max retry duration", func(t *testing.T) {
+		if _, err := NewAPI(&Config{TokenKey: "foo", MaxRetryDuration: "soon"}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -8,14 +8,9 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
-	"github.com/pkg/errors"
 )
 
 // BrokerDetail defines instance attributes
@@ -44,96 +39,57 @@ type Broker struct {
 	Details   []BrokerDetail `json:"_details"`   // [] len >= 1
 }
 
-// FetchBroker retrieves broker with passed cid.
-func (a *API) FetchBroker(cid CIDType) (*Broker, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.Errorf("invalid broker CID (none)")
-	}
-
-	var brokerCID string
-	if !strings.HasPrefix(*cid, config.BrokerPrefix) {
-		brokerCID = fmt.Sprintf("%s/%s", config.BrokerPrefix, *cid)
-	} else {
-		brokerCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.BrokerCIDRegex, brokerCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid broker CID (%s)", brokerCID)
-	}
-
-	result, err := a.Get(brokerCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching broker")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch broker, received JSON: %s", string(result))
-	}
+// brokerResource describes the broker endpoint
+var brokerResource = RegisterResource(&Resource[Broker]{
+	Name:     "broker",
+	Plural:   "brokers",
+	Prefix:   config.BrokerPrefix,
+	CIDRegex: config.BrokerCIDRegex,
+	CID:      func(o *Broker) string { return o.CID },
+	Tags:     func(o *Broker) *[]string { return &o.Tags },
+})
 
-	response := new(Broker)
-	if err := json.Unmarshal(result, &response); err != nil {
-		return nil, errors.Wrap(err, "parsing broker")
-	}
-
-	return response, nil
+// FetchBroker retrieves broker with passed cid.
+func (a *API) FetchBroker(cid CIDType, opts ...CallOption) (*Broker, error) {
+	return a.FetchBrokerWithContext(context.Background(), cid, opts...)
+}
 
+// FetchBrokerWithContext is FetchBroker with a context for cancellation and deadlines.
+func (a *API) FetchBrokerWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*Broker, error) {
+	return brokerResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchBrokers returns all brokers available to the API Token.
-func (a *API) FetchBrokers() (*[]Broker, error) {
-	result, err := a.Get(config.BrokerPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching brokers")
-	}
-
-	var response []Broker
-	if err := json.Unmarshal(result, &response); err != nil {
-		return nil, errors.Wrap(err, "parsing brokers")
-	}
+func (a *API) FetchBrokers(opts ...CallOption) (*[]Broker, error) {
+	return a.FetchBrokersWithContext(context.Background(), opts...)
+}
 
-	return &response, nil
+// FetchBrokersWithContext is FetchBrokers with a context for cancellation and deadlines.
+func (a *API) FetchBrokersWithContext(ctx context.Context, opts ...CallOption) (*[]Broker, error) {
+	return brokerResource.FetchAll(ctx, a, opts...)
 }
 
 // SearchBrokers returns brokers matching the specified search
 // query and/or filter. If nil is passed for both parameters
 // all brokers will be returned.
-func (a *API) SearchBrokers(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]Broker, error) {
-	q := url.Values{}
-
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
-
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
-
-	if q.Encode() == "" {
-		return a.FetchBrokers()
-	}
-
-	reqURL := url.URL{
-		Path:     config.BrokerPrefix,
-		RawQuery: q.Encode(),
-	}
+func (a *API) SearchBrokers(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Broker, error) {
+	return a.SearchBrokersWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching brokers")
-	}
+// SearchBrokersWithContext is SearchBrokers with a context for cancellation and deadlines.
+func (a *API) SearchBrokersWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Broker, error) {
+	return brokerResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	var brokers []Broker
-	if err := json.Unmarshal(result, &brokers); err != nil {
-		return nil, errors.Wrap(err, "parsing brokers")
-	}
+// IterateBrokers calls fn for each broker matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateBrokers(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Broker) error) error {
+	return a.IterateBrokersWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	return &brokers, nil
+// IterateBrokersWithContext is IterateBrokers with a context for cancellation and deadlines.
+func (a *API) IterateBrokersWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Broker) error) error {
+	return brokerResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
 }
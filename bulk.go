@@ -0,0 +1,164 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// defaultBulkConcurrency number of concurrent requests made by bulk operations
+const defaultBulkConcurrency = 4
+
+// ErrBulkSkipped is the error for items not attempted because a bulk
+// operation stopped on an earlier error (see BulkOptions.StopOnError)
+var ErrBulkSkipped = errors.New("skipped, bulk operation stopped")
+
+// BulkOptions control bulk operations, nil uses the defaults
+type BulkOptions struct {
+	// Progress is called after each item completes, calls are not concurrent
+	Progress func(BulkProgress)
+	// Concurrency number of concurrent requests - default 4. Requests also
+	// share the API rate limiter (see Config.RateLimit).
+	Concurrency int
+	// StopOnError do not start any more items after the first failure, the
+	// remaining items fail with ErrBulkSkipped
+	StopOnError bool
+}
+
+// BulkProgress reports the progress of a bulk operation
+type BulkProgress struct {
+	Total     int
+	Completed int // succeeded and failed
+	Failed    int
+}
+
+// BulkResult is the result for one item of a bulk operation
+type BulkResult[T any] struct {
+	Value T
+	Err   error
+	Index int // index of the item in the bulk request
+}
+
+// BulkResults are the results of a bulk operation, in item order
+type BulkResults[T any] []BulkResult[T]
+
+// Err returns a *MultiError with an *ItemError for each failed item (not
+// including skipped items), nil if all items succeeded
+func (r BulkResults[T]) Err() error {
+	var errs MultiError
+	for _, res := range r {
+		if res.Err != nil && !errors.Is(res.Err, ErrBulkSkipped) {
+			errs = append(errs, &ItemError{Index: res.Index, Err: res.Err})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &errs
+}
+
+// ItemError is a failed item of a bulk operation
+type ItemError struct {
+	Err   error
+	Index int
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("item %d: %s", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// Bulk calls fn for each item using a pool of workers, it is the basis of the
+// Bulk* methods and can be used for any other call, e.g.
+//
+//	results := apiclient.Bulk(ctx, cids, nil, func(ctx context.Context, cid string) (*apiclient.CheckBundle, error) {
+//		return client.FetchCheckBundleWithContext(ctx, &cid)
+//	})
+func Bulk[In, Out any](ctx context.Context, items []In, opts *BulkOptions, fn func(ctx context.Context, item In) (Out, error)) BulkResults[Out] {
+	if opts == nil {
+		opts = &BulkOptions{}
+	}
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = defaultBulkConcurrency
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	results := make(BulkResults[Out], len(items))
+	for i := range results {
+		results[i].Index = i
+	}
+
+	var (
+		mu       sync.Mutex
+		progress = BulkProgress{Total: len(items)}
+		stopped  bool
+		wg       sync.WaitGroup
+		next     = make(chan int)
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				mu.Lock()
+				stop := stopped
+				mu.Unlock()
+				if stop {
+					results[i].Err = ErrBulkSkipped
+					continue
+				}
+
+				value, err := fn(ctx, items[i])
+
+				mu.Lock()
+				results[i].Value, results[i].Err = value, err
+				progress.Completed++
+				if err != nil {
+					progress.Failed++
+					if opts.StopOnError {
+						stopped = true
+					}
+				}
+				if opts.Progress != nil {
+					opts.Progress(progress)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := range items {
+		mu.Lock()
+		stop := stopped
+		mu.Unlock()
+		if stop || ctx.Err() != nil {
+			for ; i < len(items); i++ {
+				if stop {
+					results[i].Err = ErrBulkSkipped
+				} else {
+					results[i].Err = errors.Wrap(ctx.Err(), "bulk operation")
+				}
+			}
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
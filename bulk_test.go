@@ -0,0 +1,201 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBulk(t *testing.T) {
+	errOdd := errors.New("odd")
+
+	tests := []struct {
+		opts        BulkOptions
+		fail        func(int) bool
+		completed   int
+		failed      int
+		skipped     int
+		description string
+	}{
+		{BulkOptions{}, func(int) bool { return false }, 20, 0, 0, "all succeed"},
+		{BulkOptions{Concurrency: 3}, func(i int) bool { return i%2 == 1 }, 20, 10, 0, "continue past failures"},
+		{BulkOptions{Concurrency: 1, StopOnError: true}, func(i int) bool { return i == 5 }, 6, 1, 14, "stop on first error"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			items := make([]int, 20)
+			for i := range items {
+				items[i] = i
+			}
+
+			var running, maxRunning int32
+			var progress []BulkProgress
+			opts := test.opts
+			opts.Progress = func(p BulkProgress) { progress = append(progress, p) }
+
+			results := Bulk(context.Background(), items, &opts, func(ctx context.Context, i int) (string, error) {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				if test.fail(i) {
+					return "", errOdd
+				}
+				return fmt.Sprintf("item %d", i), nil
+			})
+
+			limit := int32(test.opts.Concurrency)
+			if limit == 0 {
+				limit = defaultBulkConcurrency
+			}
+			if maxRunning > limit {
+				t.Fatalf("expected at most %d concurrent, got %d", limit, maxRunning)
+			}
+
+			skipped := 0
+			for i, res := range results {
+				if res.Index != i {
+					t.Fatalf("result %d has index %d", i, res.Index)
+				}
+				switch {
+				case errors.Is(res.Err, ErrBulkSkipped):
+					skipped++
+				case res.Err == nil && res.Value != fmt.Sprintf("item %d", i):
+					t.Fatalf("unexpected value (%s) for item %d", res.Value, i)
+				}
+			}
+			if skipped != test.skipped {
+				t.Fatalf("expected %d skipped, got %d", test.skipped, skipped)
+			}
+
+			if len(progress) != test.completed {
+				t.Fatalf("expected %d progress calls, got %d", test.completed, len(progress))
+			}
+			last := progress[len(progress)-1]
+			if last.Total != 20 || last.Completed != test.completed || last.Failed != test.failed {
+				t.Fatalf("unexpected progress %#v", last)
+			}
+
+			err := results.Err()
+			if test.failed == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error (%s)", err)
+				}
+				return
+			}
+			if !errors.Is(err, errOdd) {
+				t.Fatalf("expected item errors, got (%v)", err)
+			}
+			if n := len(*err.(*MultiError)); n != test.failed {
+				t.Fatalf("expected %d errors, got %d", test.failed, n)
+			}
+			var itemErr *ItemError
+			if !errors.As(err, &itemErr) || !test.fail(itemErr.Index) {
+				t.Fatalf("unexpected item error (%v)", itemErr)
+			}
+		})
+	}
+}
+
+func TestBulkCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := Bulk(ctx, []string{"a", "b"}, nil, func(ctx context.Context, s string) (string, error) {
+		t.Fatal("unexpected call")
+		return s, nil
+	})
+	for _, res := range results {
+		if !errors.Is(res.Err, context.Canceled) {
+			t.Fatalf("expected canceled, got (%v)", res.Err)
+		}
+	}
+}
+
+func TestBulkResourceMethods(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		switch {
+		case r.Method == "POST" && strings.Contains(string(body), "bad"):
+			w.WriteHeader(400)
+			fmt.Fprintln(w, `{"code":"Validation","message":"bad rule set"}`)
+		case r.Method == "POST":
+			var rs RuleSet
+			_ = json.Unmarshal(body, &rs)
+			rs.CID = "/rule_set/1_" + rs.MetricName
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(rs)
+		case r.Method == "DELETE":
+			w.WriteHeader(204)
+		}
+	}))
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", TokenApp: "bar", URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	t.Run("create", func(t *testing.T) {
+		cfgs := []*RuleSet{{MetricName: "cpu"}, {MetricName: "bad"}, {MetricName: "mem"}}
+		results := apih.BulkCreateRuleSets(cfgs, nil)
+		if results[0].Err != nil || results[0].Value.MetricName != "cpu" {
+			t.Fatalf("unexpected result %#v", results[0])
+		}
+		if !IsBadRequest(results[1].Err) {
+			t.Fatalf("expected bad request, got (%v)", results[1].Err)
+		}
+		if results[2].Err != nil || results[2].Value.MetricName != "mem" {
+			t.Fatalf("unexpected result %#v", results[2])
+		}
+		if !IsBadRequest(results.Err()) {
+			t.Fatalf("expected bad request, got (%v)", results.Err())
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		results := apih.BulkDeleteCheckBundles([]string{"/check_bundle/1", "2", ""}, &BulkOptions{Concurrency: 2})
+		if results[0].Err != nil || results[1].Err != nil {
+			t.Fatalf("unexpected error (%v)", results.Err())
+		}
+		if results[2].Err == nil {
+			t.Fatal("expected invalid CID error")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		found := 0
+		for _, req := range requests {
+			if req == "DELETE /check_bundle/1" || req == "DELETE /check_bundle/2" {
+				found++
+			}
+		}
+		if found != 2 {
+			t.Fatalf("expected 2 deletes, got %v", requests)
+		}
+	})
+}
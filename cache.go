@@ -0,0 +1,243 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/go-apiclient/config"
+	"github.com/pkg/errors"
+)
+
+// defaultCacheMaxEntries bounds the response cache when Config.CacheMaxEntries is not set
+const defaultCacheMaxEntries = 1000
+
+// cacheablePrefixes are the endpoints whose Fetch method uses the response cache
+var cacheablePrefixes = map[string]bool{
+	config.AccountPrefix:      true,
+	config.BrokerPrefix:       true,
+	config.ContactGroupPrefix: true,
+	config.UserPrefix:         true,
+}
+
+// CacheStats are response cache statistics
+type CacheStats struct {
+	Hits          uint64 // fetches served from the cache
+	Misses        uint64 // fetches sent to the API (not cached or expired)
+	Evictions     uint64 // entries removed to stay within the size bound
+	Invalidations uint64 // entries removed by updates/deletes
+	Entries       int    // current number of entries
+}
+
+// responseCache is a size bounded, least recently used, cache of raw API
+// responses with a TTL per endpoint prefix
+type responseCache struct {
+	ttls    map[string]time.Duration
+	entries map[string]*list.Element
+	lru     *list.List
+	gens    map[string]uint64 // invalidations per key, see generation
+	now     func() time.Time
+	stats   CacheStats
+	flushes uint64
+	max     int
+	mu      sync.Mutex
+}
+
+type cacheEntry struct {
+	expires time.Time
+	key     string
+	data    []byte
+}
+
+func newResponseCache(ttls map[string]string, maxEntries int) (*responseCache, error) {
+	c := &responseCache{
+		ttls:    make(map[string]time.Duration),
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		gens:    make(map[string]uint64),
+		now:     time.Now,
+		max:     defaultCacheMaxEntries,
+	}
+	if maxEntries > 0 {
+		c.max = maxEntries
+	}
+
+	for prefix, ttl := range ttls {
+		if !cacheablePrefixes[prefix] {
+			return nil, errors.Errorf("caching not supported for %s", prefix)
+		}
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing cache ttl for %s", prefix)
+		}
+		if d > 0 {
+			c.ttls[prefix] = d
+		}
+	}
+
+	return c, nil
+}
+
+// cacheKeyPrefix returns the endpoint prefix of an object cid (e.g. /broker/1234 -> /broker)
+func cacheKeyPrefix(cid string) string {
+	if i := strings.Index(cid[1:], "/"); i >= 0 {
+		return cid[:i+1]
+	}
+	return cid
+}
+
+// ttl returns the ttl for cid, zero if it is not cached
+func (c *responseCache) ttl(cid string) time.Duration {
+	if !strings.HasPrefix(cid, "/") || strings.Contains(cid, "?") {
+		return 0
+	}
+	return c.ttls[cacheKeyPrefix(cid)]
+}
+
+func (c *responseCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cacheEntry)
+		if c.now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.stats.Hits++
+			return e.data, true
+		}
+		c.remove(el)
+	}
+
+	c.stats.Misses++
+	return nil, false
+}
+
+// generation returns a value which changes whenever key is invalidated or the
+// cache is flushed
+func (c *responseCache) generation(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.gens[key] + c.flushes
+}
+
+// set caches data for key, unless key was invalidated since gen was taken,
+// the data may be older than the modification then
+func (c *responseCache) set(key string, data []byte, ttl time.Duration, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gens[key]+c.flushes != gen {
+		return
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, data: data, expires: c.now().Add(ttl)})
+
+	for c.lru.Len() > c.max {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// invalidate removes the entry for cid, and the entry for <prefix>/current
+// which may be the same object (e.g. /user/current)
+func (c *responseCache) invalidate(cid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range []string{cid, cacheKeyPrefix(cid) + "/current"} {
+		c.gens[key]++
+		if el, ok := c.entries[key]; ok {
+			c.remove(el)
+			c.stats.Invalidations++
+		}
+	}
+}
+
+func (c *responseCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.flushes++
+}
+
+// remove deletes an entry, the caller must hold the lock
+func (c *responseCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+func (c *responseCache) getStats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats
+	s.Entries = c.lru.Len()
+	return s
+}
+
+// cachedGet fetches cid through the response cache, when it is enabled for
+// the endpoint. Each caller decodes its own copy of the cached response.
+func (a *API) cachedGet(ctx context.Context, cid string, opts ...CallOption) ([]byte, error) {
+	ctx = ContextWithCallOptions(ctx, opts...)
+	if a.cache == nil || getCallOptions(ctx).changesResponse() {
+		return a.GetWithContext(ctx, cid)
+	}
+
+	ttl := a.cache.ttl(cid)
+	if ttl == 0 {
+		return a.GetWithContext(ctx, cid)
+	}
+
+	if data, ok := a.cache.get(cid); ok {
+		a.logDebug("cache hit", "cid", cid)
+		return data, nil
+	}
+
+	// a response to a request racing an update is not cached
+	gen := a.cache.generation(cid)
+	data, err := a.GetWithContext(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	a.cache.set(cid, data, ttl, gen)
+
+	return data, nil
+}
+
+// invalidateCache removes a (possibly) modified object from the response cache
+func (a *API) invalidateCache(reqPath string) {
+	if a.cache == nil || a.cache.ttl(reqPath) == 0 {
+		return
+	}
+	a.cache.invalidate(reqPath)
+}
+
+// CacheStats returns response cache statistics (zero when the cache is not enabled)
+func (a *API) CacheStats() CacheStats {
+	if a.cache == nil {
+		return CacheStats{}
+	}
+	return a.cache.getStats()
+}
+
+// FlushCache removes all entries from the response cache
+func (a *API) FlushCache() {
+	if a.cache == nil {
+		return
+	}
+	a.cache.flush()
+}
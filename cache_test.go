@@ -0,0 +1,283 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/go-apiclient/config"
+)
+
+// cacheServer serves brokers and users, counting GET requests per path
+func cacheServer() (*httptest.Server, func(string) int) {
+	var mu sync.Mutex
+	gets := map[string]int{}
+	names := map[string]string{}
+	f := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case "GET":
+			gets[r.URL.Path]++
+			name := names[r.URL.Path]
+			if name == "" {
+				name = "initial"
+			}
+			if r.URL.Path == "/user/current" {
+				fmt.Fprintf(w, `{"_cid":"/user/1","firstname":"%s"}`, names["/user/1"])
+				return
+			}
+			fmt.Fprintf(w, `{"_cid":"%s","_name":"%s","firstname":"%s"}`, r.URL.Path, name, name)
+		case "PUT":
+			body, _ := io.ReadAll(r.Body)
+			names[r.URL.Path] = "updated"
+			fmt.Fprint(w, string(body))
+		case "DELETE":
+			w.WriteHeader(204)
+		}
+	}
+
+	count := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return gets[path]
+	}
+
+	return httptest.NewServer(http.HandlerFunc(f)), count
+}
+
+func TestCache(t *testing.T) {
+	server, gets := cacheServer()
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{
+		TokenKey: "foo",
+		TokenApp: "bar",
+		URL:      server.URL,
+		CacheTTLs: map[string]string{
+			config.BrokerPrefix:       "1m",
+			config.UserPrefix:         "1m",
+			config.ContactGroupPrefix: "1m",
+		},
+		CacheMaxEntries: 3,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	now := time.Now()
+	apih.cache.now = func() time.Time { return now }
+
+	t.Run("hit", func(t *testing.T) {
+		cid := "/broker/1"
+		b1, err := apih.FetchBroker(CIDType(&cid))
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		b1.Name = "modified by caller"
+		b2, err := apih.FetchBroker(CIDType(&cid))
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if b2.Name != "initial" {
+			t.Fatalf("cached object shared between callers, got (%s)", b2.Name)
+		}
+		if n := gets(cid); n != 1 {
+			t.Fatalf("expected 1 request, got %d", n)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		cid := "/broker/1"
+		now = now.Add(2 * time.Minute)
+		if _, err := apih.FetchBroker(CIDType(&cid)); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if n := gets(cid); n != 2 {
+			t.Fatalf("expected 2 requests, got %d", n)
+		}
+	})
+
+	t.Run("invalidate on update", func(t *testing.T) {
+		cid := "/user/1"
+		if _, err := apih.FetchUser(nil); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		user, err := apih.FetchUser(CIDType(&cid))
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if _, err := apih.UpdateUser(user); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		user, err = apih.FetchUser(CIDType(&cid))
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if user.Firstname != "updated" {
+			t.Fatalf("expected updated user, got (%s)", user.Firstname)
+		}
+		current, err := apih.FetchUser(nil)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if current.Firstname != "updated" {
+			t.Fatalf("expected updated current user, got (%s)", current.Firstname)
+		}
+		if n := gets(cid); n != 2 {
+			t.Fatalf("expected 2 requests, got %d", n)
+		}
+	})
+
+	t.Run("invalidate on delete", func(t *testing.T) {
+		cid := "/contact_group/1"
+		if _, err := apih.FetchContactGroup(CIDType(&cid)); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if _, err := apih.DeleteContactGroupByCID(CIDType(&cid)); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if _, err := apih.FetchContactGroup(CIDType(&cid)); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if n := gets(cid); n != 2 {
+			t.Fatalf("expected 2 requests, got %d", n)
+		}
+	})
+
+	t.Run("not cached", func(t *testing.T) {
+		cid := "/account/1"
+		for i := 0; i < 2; i++ {
+			if _, err := apih.FetchAccount(CIDType(&cid)); err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+		}
+		if n := gets(cid); n != 2 {
+			t.Fatalf("expected 2 requests, got %d", n)
+		}
+	})
+
+	t.Run("size bound", func(t *testing.T) {
+		for i := 10; i < 15; i++ {
+			cid := fmt.Sprintf("/broker/%d", i)
+			if _, err := apih.FetchBroker(CIDType(&cid)); err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+		}
+		stats := apih.CacheStats()
+		if stats.Entries != 3 {
+			t.Fatalf("expected 3 entries, got %d", stats.Entries)
+		}
+		if stats.Evictions == 0 {
+			t.Fatal("expected evictions")
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		stats := apih.CacheStats()
+		if stats.Hits != 1 {
+			t.Fatalf("expected 1 hit, got %d", stats.Hits)
+		}
+		if stats.Misses != 13 {
+			t.Fatalf("expected 13 misses, got %d", stats.Misses)
+		}
+		if stats.Invalidations != 3 {
+			t.Fatalf("expected 3 invalidations, got %d", stats.Invalidations)
+		}
+		apih.FlushCache()
+		if n := apih.CacheStats().Entries; n != 0 {
+			t.Fatalf("expected empty cache, got %d entries", n)
+		}
+	})
+}
+
+func TestCacheUpdateDuringFetch(t *testing.T) {
+	var mu sync.Mutex
+	name := "initial"
+	fetching := make(chan struct{})
+	updated := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case "GET":
+			mu.Lock()
+			n := name
+			mu.Unlock()
+			if n == "initial" {
+				// respond with the object read before the update, after the update
+				close(fetching)
+				<-updated
+			}
+			fmt.Fprintf(w, `{"_cid":"/broker/1","_name":"%s"}`, n)
+		case "PUT":
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			name = "updated"
+			mu.Unlock()
+			fmt.Fprint(w, string(body))
+		}
+	}))
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL, CacheTTLs: map[string]string{config.BrokerPrefix: "1m"}})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	cid := "/broker/1"
+	done := make(chan error)
+	go func() {
+		_, err := apih.FetchBroker(CIDType(&cid))
+		done <- err
+	}()
+
+	<-fetching
+	if _, err := apih.Put(cid, []byte(`{"_cid":"/broker/1","_name":"updated"}`)); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	close(updated)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	b, err := apih.FetchBroker(CIDType(&cid))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if b.Name != "updated" {
+		t.Fatalf("expected updated broker, got stale (%s)", b.Name)
+	}
+}
+
+func TestCacheConfig(t *testing.T) {
+	tests := []struct {
+		ttls        map[string]string
+		shouldFail  bool
+		description string
+	}{
+		{map[string]string{config.BrokerPrefix: "5m"}, false, "valid"},
+		{map[string]string{config.BrokerPrefix: "five minutes"}, true, "invalid ttl"},
+		{map[string]string{config.CheckBundlePrefix: "5m"}, true, "unsupported endpoint"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			_, err := NewAPI(&Config{TokenKey: "foo", CacheTTLs: test.ttls})
+			if test.shouldFail && err == nil {
+				t.Fatal("expected error")
+			}
+			if !test.shouldFail && err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// CallOption overrides client settings for a single call, without affecting
+// other users (goroutines) of the API. Options are accepted by the raw verbs
+// (Get, Post, ...) and the Fetch*, Search*, Create*, Update* and Delete*
+// methods, other methods (e.g. Iterate*, Bulk*) take them from the context
+// (see ContextWithCallOptions).
+type CallOption func(*callOptions)
+
+// callOptions are the overrides for a call, carried in the request context
+type callOptions struct {
+	headers     http.Header
+	query       url.Values
+	backoff     BackoffPolicy
+	retries     *uint
+	exponential *bool
+	accountID   *string
+	timeout     time.Duration
+}
+
+type callOptionsKey struct{}
+
+// WithRetries sets the maximum number of retries for the call, 0 disables retries
+func WithRetries(n uint) CallOption {
+	return func(o *callOptions) {
+		o.retries = &n
+	}
+}
+
+// WithBackoff retries the call with exponential backoff (see EnableExponentialBackoff)
+// using policy, nil uses the client's policy (see Config.BackoffPolicy)
+func WithBackoff(policy BackoffPolicy) CallOption {
+	return func(o *callOptions) {
+		enabled := true
+		o.exponential = &enabled
+		o.backoff = policy
+	}
+}
+
+// WithoutBackoff retries the call between the min and max retry delay, even
+// when exponential backoff is enabled for the client
+func WithoutBackoff() CallOption {
+	return func(o *callOptions) {
+		enabled := false
+		o.exponential = &enabled
+		o.backoff = nil
+	}
+}
+
+// WithTimeout limits the call, including retries, to d
+func WithTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = d
+	}
+}
+
+// WithAccountID sends the call for another account (X-Circonus-Account-ID header),
+// "" sends the call without an account ID
+func WithAccountID(id string) CallOption {
+	return func(o *callOptions) {
+		o.accountID = &id
+	}
+}
+
+// WithQueryParam adds a query parameter to the request URL
+func WithQueryParam(key, value string) CallOption {
+	return func(o *callOptions) {
+		if o.query == nil {
+			o.query = url.Values{}
+		}
+		o.query.Add(key, value)
+	}
+}
+
+// WithHeader sets a request header
+func WithHeader(key, value string) CallOption {
+	return func(o *callOptions) {
+		if o.headers == nil {
+			o.headers = http.Header{}
+		}
+		o.headers.Set(key, value)
+	}
+}
+
+// ContextWithCallOptions returns a context applying opts to every call made
+// with it, in addition to any options already in ctx
+func ContextWithCallOptions(ctx context.Context, opts ...CallOption) context.Context {
+	if len(opts) == 0 {
+		return ctx
+	}
+
+	o := &callOptions{}
+	if prev := getCallOptions(ctx); prev != nil {
+		*o = *prev
+		o.headers = prev.headers.Clone()
+		if prev.query != nil {
+			o.query = url.Values{}
+			for k, v := range prev.query {
+				o.query[k] = append([]string(nil), v...)
+			}
+		}
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+// getCallOptions returns the call options in ctx, nil if there are none
+func getCallOptions(ctx context.Context) *callOptions {
+	o, _ := ctx.Value(callOptionsKey{}).(*callOptions)
+	return o
+}
+
+// changesResponse reports whether the options can change the API response, so
+// the call must not share a cached response
+func (o *callOptions) changesResponse() bool {
+	return o != nil && (len(o.headers) > 0 || len(o.query) > 0 || o.accountID != nil)
+}
+
+// useBackoff reports whether apiRequest retries the call with exponential backoff
+func (a *API) useBackoff(ctx context.Context) bool {
+	if ctx.Value(noRetryKey{}) != nil {
+		return false
+	}
+	if o := getCallOptions(ctx); o != nil && o.exponential != nil {
+		return *o.exponential
+	}
+	return a.exponentialBackoff()
+}
+
+// callBackoffPolicy returns the backoff policy for the call
+func (a *API) callBackoffPolicy(ctx context.Context) BackoffPolicy {
+	if o := getCallOptions(ctx); o != nil && o.backoff != nil {
+		return o.backoff
+	}
+	return a.backoffPolicy
+}
+
+// callMaxRetries returns the maximum retries for the call, ok is false when
+// it is unlimited (exponential backoff without WithRetries)
+func (a *API) callMaxRetries(ctx context.Context, backoff bool) (max uint, ok bool) {
+	if o := getCallOptions(ctx); o != nil && o.retries != nil {
+		return *o.retries, true
+	}
+	if backoff {
+		return 0, false
+	}
+	return a.maxRetries, true
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCallOptionsRequest(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		last *http.Request
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		last = r
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"_cid":"/graph/1"}`)
+	}))
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", TokenAccountID: "1", URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	ctx := ContextWithCallOptions(context.Background(), WithHeader("X-From-Context", "yes"))
+
+	tests := []struct {
+		call    func() error
+		headers map[string]string
+		query   url.Values
+		id      string
+	}{
+		{
+			id: "raw verb",
+			call: func() error {
+				_, err := apih.Get("/graph/1?a=1", WithAccountID("2"), WithHeader("X-Test", "a"), WithQueryParam("b", "2"))
+				return err
+			},
+			headers: map[string]string{"X-Circonus-Account-ID": "2", "X-Test": "a"},
+			query:   url.Values{"a": {"1"}, "b": {"2"}},
+		},
+		{
+			id: "resource method",
+			call: func() error {
+				cid := "/graph/1"
+				_, err := apih.FetchGraph(CIDType(&cid), WithAccountID(""), WithQueryParam("c", "3"))
+				return err
+			},
+			headers: map[string]string{"X-Circonus-Account-ID": "", "X-Test": ""},
+			query:   url.Values{"c": {"3"}},
+		},
+		{
+			id: "context and call",
+			call: func() error {
+				_, err := apih.PutWithContext(ctx, "/graph/1", []byte(`{}`), WithHeader("X-Test", "b"))
+				return err
+			},
+			headers: map[string]string{"X-Circonus-Account-ID": "1", "X-Test": "b", "X-From-Context": "yes"},
+			query:   url.Values{},
+		},
+		{
+			id: "no options",
+			call: func() error {
+				_, err := apih.Get("/graph/1")
+				return err
+			},
+			headers: map[string]string{"X-Circonus-Account-ID": "1", "X-Test": "", "X-From-Context": ""},
+			query:   url.Values{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			if err := test.call(); err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for key, want := range test.headers {
+				if got := last.Header.Get(key); got != want {
+					t.Fatalf("expected %s %q, got %q", key, want, got)
+				}
+			}
+			if got := last.URL.Query(); !reflect.DeepEqual(got, test.query) {
+				t.Fatalf("expected query %v, got %v", test.query, got)
+			}
+		})
+	}
+}
+
+func TestCallOptionsRetries(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.WriteHeader(500)
+		fmt.Fprintln(w, "error")
+	}))
+	defer server.Close()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL, MaxRetries: 2, MinRetryDelay: "1ms", MaxRetryDelay: "2ms", Clock: clock})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	tests := []struct {
+		opts    []CallOption
+		id      string
+		calls   int
+		backoff bool
+	}{
+		{id: "client default", calls: 3},
+		{id: "fewer retries", opts: []CallOption{WithRetries(1)}, calls: 2},
+		{id: "no retries", opts: []CallOption{WithRetries(0)}, calls: 1},
+		{id: "more retries", opts: []CallOption{WithRetries(5)}, calls: 6},
+		{id: "backoff", opts: []CallOption{WithBackoff(NewConstantBackoff(time.Hour)), WithRetries(3)}, calls: 4},
+		{id: "without backoff", opts: []CallOption{WithoutBackoff()}, calls: 3, backoff: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			if test.backoff {
+				apih.EnableExponentialBackoff()
+				defer apih.DisableExponentialBackoff()
+			}
+			calls = 0
+			clock.sleeps = nil
+
+			_, err := apih.Get("/fail", test.opts...)
+			if !IsServerError(err) {
+				t.Fatalf("expected server error, got (%v)", err)
+			}
+			if apiErr, _ := AsAPIError(err); apiErr.Retries != test.calls-1 {
+				t.Fatalf("expected %d retries, got %d", test.calls-1, apiErr.Retries)
+			}
+			if calls != test.calls {
+				t.Fatalf("expected %d calls, got %d", test.calls, calls)
+			}
+			// all retries wait on the clock, with or without exponential backoff
+			if len(clock.sleeps) != test.calls-1 {
+				t.Fatalf("expected %d retry waits, got %v", test.calls-1, clock.sleeps)
+			}
+		})
+	}
+}
+
+func TestCallOptionsTimeout(t *testing.T) {
+	hung := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-hung:
+		}
+	}))
+	defer server.Close()
+	defer close(hung)
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	start := time.Now()
+	_, err = apih.Post("/hang", []byte(`{}`), WithTimeout(50*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got (%v)", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("request not canceled promptly (%s)", elapsed)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CassetteMode selects recording or replaying API interactions (see Config.CassetteMode)
+type CassetteMode string
+
+const (
+	// CassetteRecord sends requests to the API and writes each request/response pair to the cassette
+	CassetteRecord CassetteMode = "record"
+	// CassetteReplay serves responses from the cassette, no requests are sent to the API
+	CassetteReplay CassetteMode = "replay"
+)
+
+// ErrCassetteMiss is returned in replay mode when the cassette has no
+// interaction matching a request. It is not retried.
+var ErrCassetteMiss = errors.New("no matching cassette interaction")
+
+// Cassette is the file format for recorded API interactions
+type Cassette struct {
+	Interactions []CassetteInteraction `json:"interactions"`
+}
+
+// CassetteInteraction is a recorded request and its response
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteRequest is a recorded request, the path is relative to the API URL
+// (e.g. /check_bundle/1234) and the auth token is redacted.
+type CassetteRequest struct {
+	Headers http.Header `json:"headers,omitempty"`
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Query   string      `json:"query,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// CassetteResponse is a recorded response
+type CassetteResponse struct {
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body"`
+	StatusCode int         `json:"status_code"`
+}
+
+// cassetteTransport records interactions to, or replays them from, a cassette file
+type cassetteTransport struct {
+	next     http.RoundTripper
+	matches  map[string][]int
+	played   map[string]int
+	path     string
+	basePath string
+	cassette Cassette
+	mode     CassetteMode
+	recorded int   // interactions written to the cassette
+	end      int64 // offset of cassetteTail in the cassette
+	mu       sync.Mutex
+}
+
+// cassetteHead and cassetteTail enclose the recorded interactions, which are
+// appended in place of the tail so the cassette stays valid json
+const (
+	cassetteHead = "{\n  \"interactions\": ["
+	cassetteTail = "\n  ]\n}\n"
+)
+
+func newCassetteTransport(mode CassetteMode, file, basePath string, next http.RoundTripper) (*cassetteTransport, error) {
+	if file == "" {
+		return nil, errors.New("cassette file required for cassette mode")
+	}
+
+	t := &cassetteTransport{
+		next:     next,
+		path:     file,
+		basePath: basePath,
+		mode:     mode,
+		matches:  make(map[string][]int),
+		played:   make(map[string]int),
+	}
+
+	switch mode {
+	case CassetteRecord:
+		// start a new cassette, interactions are appended as they are recorded
+		if err := os.WriteFile(file, []byte(cassetteHead+cassetteTail), 0o600); err != nil {
+			return nil, errors.Wrap(err, "writing cassette")
+		}
+		t.end = int64(len(cassetteHead))
+	case CassetteReplay:
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading cassette")
+		}
+		if err := json.Unmarshal(data, &t.cassette); err != nil {
+			return nil, errors.Wrap(err, "parsing cassette")
+		}
+		for i, in := range t.cassette.Interactions {
+			key := cassetteKey(in.Request.Method, in.Request.Path, in.Request.Query, []byte(in.Request.Body))
+			t.matches[key] = append(t.matches[key], i)
+		}
+	default:
+		return nil, errors.Errorf("invalid cassette mode (%s)", mode)
+	}
+
+	return t, nil
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := RequestBody(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading request body")
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, t.basePath)
+	query := req.URL.Query().Encode() // sorted
+
+	if t.mode == CassetteReplay {
+		return t.replay(req, path, query, body)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading response body")
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	in := CassetteInteraction{
+		Request: CassetteRequest{
+			Method:  req.Method,
+			Path:    path,
+			Query:   query,
+			Headers: redactHeaders(req.Header),
+			Body:    string(canonicalJSON(body)),
+		},
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    redactHeaders(resp.Header),
+			Body:       string(redactJSON(respBody)),
+		},
+	}
+
+	t.mu.Lock()
+	err = t.save(in)
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// replay serves the next recorded response for the request, repeating the
+// last one once all matching interactions have been played
+func (t *cassetteTransport) replay(req *http.Request, path, query string, body []byte) (*http.Response, error) {
+	key := cassetteKey(req.Method, path, query, body)
+
+	t.mu.Lock()
+	idxs := t.matches[key]
+	if len(idxs) == 0 {
+		t.mu.Unlock()
+		return nil, errors.Wrapf(ErrCassetteMiss, "%s %s?%s", req.Method, path, query)
+	}
+	n := t.played[key]
+	if n >= len(idxs) {
+		n = len(idxs) - 1
+	}
+	t.played[key] = n + 1
+	rec := t.cassette.Interactions[idxs[n]].Response
+	t.mu.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.StatusCode, http.StatusText(rec.StatusCode)),
+		StatusCode:    rec.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.Headers.Clone(),
+		Body:          io.NopCloser(strings.NewReader(rec.Body)),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}, nil
+}
+
+// save appends an interaction to the cassette, the caller must hold the lock
+func (t *cassetteTransport) save(in CassetteInteraction) error {
+	data, err := json.MarshalIndent(in, "    ", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding cassette")
+	}
+
+	sep := "\n    "
+	if t.recorded > 0 {
+		sep = "," + sep
+	}
+	entry := append([]byte(sep), data...)
+
+	f, err := os.OpenFile(t.path, os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "writing cassette")
+	}
+	_, err = f.WriteAt(append(entry, cassetteTail...), t.end)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrap(err, "writing cassette")
+	}
+
+	t.end += int64(len(entry))
+	t.recorded++
+	return nil
+}
+
+// cassetteKey identifies a request for matching, json bodies are compared
+// after normalization (key order, whitespace, redaction)
+func cassetteKey(method, path, query string, body []byte) string {
+	return method + " " + path + "?" + query + "\n" + string(canonicalJSON(body))
+}
+
+// canonicalJSON returns json data re-encoded with sorted keys, no extra
+// whitespace and secrets redacted. Other data is returned as is.
+func canonicalJSON(data []byte) []byte {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return data
+	}
+	redactValue(v)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return data
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
@@ -0,0 +1,230 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func cassetteServer() *httptest.Server {
+	var posts int
+	f := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=c00k13")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v2/user/current":
+			fmt.Fprintf(w, `{"_cid":"/user/1","email":"%s"}`, r.URL.Query().Get("f_email"))
+		case r.Method == "POST" && r.URL.Path == "/v2/check_bundle":
+			posts++
+			body, _ := io.ReadAll(r.Body)
+			w.WriteHeader(200)
+			fmt.Fprintf(w, `{"_cid":"/check_bundle/%d","post":%s}`, posts, body)
+		default:
+			w.WriteHeader(404)
+			fmt.Fprintln(w, `{"code":"ObjectError.NotFound"}`)
+		}
+	}
+
+	return httptest.NewServer(http.HandlerFunc(f))
+}
+
+func TestCassette(t *testing.T) {
+	server := cassetteServer()
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "cassette.json")
+
+	post := map[string]interface{}{"type": "httptrap", "config": map[string]string{"secret": "s3cr3t", "asynch_metrics": "true"}}
+	postData, err := json.Marshal(post)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	record, err := New(&Config{
+		TokenKey:     "abc123",
+		TokenApp:     "test",
+		URL:          server.URL + "/v2",
+		CassetteMode: CassetteRecord,
+		CassetteFile: file,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	recorded := map[string]string{}
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/user/current?f_email=a%40b.com&f_a=1"},
+		{"POST", "/check_bundle"},
+		{"POST", "/check_bundle"},
+	} {
+		var data []byte
+		if req.method == "POST" {
+			data = postData
+		}
+		resp, err := record.apiRequest(context.Background(), req.method, req.path, data)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		recorded[req.method] = string(resp)
+	}
+	if _, err := record.Get("/missing"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if strings.Contains(string(raw), "abc123") {
+		t.Fatalf("token recorded in cassette\n%s", raw)
+	}
+	if strings.Contains(string(raw), "s3cr3t") {
+		t.Fatalf("secret recorded in cassette\n%s", raw)
+	}
+	if strings.Contains(string(raw), "c00k13") {
+		t.Fatalf("response cookie recorded in cassette\n%s", raw)
+	}
+
+	var c Cassette
+	if err := json.Unmarshal(raw, &c); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if len(c.Interactions) != 4 {
+		t.Fatalf("expected 4 interactions, got %d", len(c.Interactions))
+	}
+	if got := c.Interactions[0].Request; got.Path != "/user/current" || got.Query != "f_a=1&f_email=a%40b.com" {
+		t.Fatalf("unexpected request path (%s) query (%s)", got.Path, got.Query)
+	}
+	if got := c.Interactions[0].Request.Headers.Get("X-Circonus-Auth-Token"); got != Redacted {
+		t.Fatalf("expected redacted token, got (%s)", got)
+	}
+	if got := c.Interactions[0].Response.Headers.Get("Content-Type"); got != "application/json" {
+		t.Fatalf("expected response headers, got (%s)", got)
+	}
+	if got := c.Interactions[3].Response.StatusCode; got != 404 {
+		t.Fatalf("expected 404, got %d", got)
+	}
+
+	server.Close() // replay must not contact the API
+
+	replay, err := New(&Config{
+		TokenKey:     "xyz789",
+		TokenApp:     "test",
+		URL:          server.URL + "/v2",
+		CassetteMode: CassetteReplay,
+		CassetteFile: file,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	t.Run("query order", func(t *testing.T) {
+		resp, err := replay.Get("/user/current?f_a=1&f_email=a%40b.com")
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if string(resp) != recorded["GET"] {
+			t.Fatalf("unexpected response (%s)", resp)
+		}
+	})
+
+	t.Run("body match in order", func(t *testing.T) {
+		// key order and whitespace differ from the recorded body
+		body := []byte(`{ "config": {"asynch_metrics":"true", "secret":"s3cr3t"}, "type":"httptrap" }`)
+		for _, cid := range []string{"/check_bundle/1", "/check_bundle/2", "/check_bundle/2"} {
+			resp, err := replay.Post("/check_bundle", body)
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			if !strings.Contains(string(resp), cid) {
+				t.Fatalf("expected %s, got (%s)", cid, resp)
+			}
+		}
+	})
+
+	t.Run("recorded error", func(t *testing.T) {
+		_, err := replay.Get("/missing")
+		if !IsNotFound(err) {
+			t.Fatalf("expected not found, got (%v)", err)
+		}
+	})
+
+	t.Run("miss", func(t *testing.T) {
+		start := time.Now()
+		_, err := replay.Post("/check_bundle", []byte(`{"type":"json"}`))
+		if !errors.Is(err, ErrCassetteMiss) {
+			t.Fatalf("expected cassette miss, got (%v)", err)
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("cassette miss should not be retried")
+		}
+	})
+}
+
+func TestCassetteMissExponentialBackoff(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cassette.json")
+	if err := os.WriteFile(file, []byte(`{"interactions":[]}`), 0o600); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	clock := &fakeClock{now: time.Now()}
+	apih, err := New(&Config{
+		TokenKey:           "foo",
+		CassetteMode:       CassetteReplay,
+		CassetteFile:       file,
+		ExponentialBackoff: true,
+		Clock:              clock,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := apih.GetWithContext(ctx, "/user/current"); !errors.Is(err, ErrCassetteMiss) {
+		t.Fatalf("expected cassette miss, got (%v)", err)
+	}
+	if len(clock.sleeps) != 0 {
+		t.Fatalf("expected no retries, got %d backoff waits", len(clock.sleeps))
+	}
+}
+
+func TestCassetteConfig(t *testing.T) {
+	tests := []struct {
+		cfg         *Config
+		shouldFail  bool
+		description string
+	}{
+		{&Config{CassetteMode: CassetteReplay}, true, "no file"},
+		{&Config{CassetteMode: CassetteReplay, CassetteFile: filepath.Join(t.TempDir(), "none.json")}, true, "missing file"},
+		{&Config{CassetteMode: "rewind", CassetteFile: filepath.Join(t.TempDir(), "c.json")}, true, "invalid mode"},
+		{&Config{CassetteMode: CassetteRecord, CassetteFile: filepath.Join(t.TempDir(), "c.json")}, false, "record"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			test.cfg.TokenKey = "foo"
+			_, err := New(test.cfg)
+			if test.shouldFail && err == nil {
+				t.Fatal("expected error")
+			}
+			if !test.shouldFail && err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+		})
+	}
+}
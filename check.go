@@ -9,14 +9,9 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
-	"github.com/pkg/errors"
 )
 
 // CheckDetails contains [undocumented] check type specific information
@@ -33,95 +28,56 @@ type Check struct {
 	Active         bool         `json:"_active"`       // bool
 }
 
-// FetchCheck retrieves check with passed cid.
-func (a *API) FetchCheck(cid CIDType) (*Check, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid check CID (none)")
-	}
-
-	var checkCID string
-	if !strings.HasPrefix(*cid, config.CheckPrefix) {
-		checkCID = fmt.Sprintf("%s/%s", config.CheckPrefix, *cid)
-	} else {
-		checkCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.CheckCIDRegex, checkCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid check CID (%s)", checkCID)
-	}
-
-	result, err := a.Get(checkCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching check")
-	}
+// checkResource describes the check endpoint
+var checkResource = RegisterResource(&Resource[Check]{
+	Name:     "check",
+	Plural:   "checks",
+	Prefix:   config.CheckPrefix,
+	CIDRegex: config.CheckCIDRegex,
+	CID:      func(o *Check) string { return o.CID },
+})
 
-	if a.Debug {
-		a.Log.Printf("fetch check, received JSON: %s", string(result))
-	}
-
-	check := new(Check)
-	if err := json.Unmarshal(result, check); err != nil {
-		return nil, errors.Wrap(err, "parsing check")
-	}
+// FetchCheck retrieves check with passed cid.
+func (a *API) FetchCheck(cid CIDType, opts ...CallOption) (*Check, error) {
+	return a.FetchCheckWithContext(context.Background(), cid, opts...)
+}
 
-	return check, nil
+// FetchCheckWithContext is FetchCheck with a context for cancellation and deadlines.
+func (a *API) FetchCheckWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*Check, error) {
+	return checkResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchChecks retrieves all checks available to the API Token.
-func (a *API) FetchChecks() (*[]Check, error) {
-	result, err := a.Get(config.CheckPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching checks")
-	}
-
-	var checks []Check
-	if err := json.Unmarshal(result, &checks); err != nil {
-		return nil, errors.Wrap(err, "parsing checks")
-	}
+func (a *API) FetchChecks(opts ...CallOption) (*[]Check, error) {
+	return a.FetchChecksWithContext(context.Background(), opts...)
+}
 
-	return &checks, nil
+// FetchChecksWithContext is FetchChecks with a context for cancellation and deadlines.
+func (a *API) FetchChecksWithContext(ctx context.Context, opts ...CallOption) (*[]Check, error) {
+	return checkResource.FetchAll(ctx, a, opts...)
 }
 
 // SearchChecks returns checks matching the specified search query
 // and/or filter. If nil is passed for both parameters all checks
 // will be returned.
-func (a *API) SearchChecks(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]Check, error) {
-	q := url.Values{}
-
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
-
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
-
-	if q.Encode() == "" {
-		return a.FetchChecks()
-	}
-
-	reqURL := url.URL{
-		Path:     config.CheckPrefix,
-		RawQuery: q.Encode(),
-	}
+func (a *API) SearchChecks(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Check, error) {
+	return a.SearchChecksWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching checks")
-	}
+// SearchChecksWithContext is SearchChecks with a context for cancellation and deadlines.
+func (a *API) SearchChecksWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Check, error) {
+	return checkResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	var checks []Check
-	if err := json.Unmarshal(result, &checks); err != nil {
-		return nil, errors.Wrap(err, "parsing checks")
-	}
+// IterateChecks calls fn for each check matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateChecks(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Check) error) error {
+	return a.IterateChecksWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	return &checks, nil
+// IterateChecksWithContext is IterateChecks with a context for cancellation and deadlines.
+func (a *API) IterateChecksWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Check) error) error {
+	return checkResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
 }
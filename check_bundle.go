@@ -8,12 +8,7 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"sort"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -58,6 +53,18 @@ type CheckBundle struct {
 	MetricLimit        int                 `json:"metric_limit,omitempty"`             // int
 }
 
+// checkBundleResource describes the check bundle endpoint
+var checkBundleResource = RegisterResource(&Resource[CheckBundle]{
+	Name:            "check bundle",
+	Plural:          "check bundles",
+	Prefix:          config.CheckBundlePrefix,
+	CIDRegex:        config.CheckBundleCIDRegex,
+	CID:             func(o *CheckBundle) string { return o.CID },
+	LastModified:    func(o *CheckBundle) uint { return o.LastModified },
+	SetLastModified: func(o *CheckBundle, lastModified uint) { o.LastModified = lastModified },
+	Tags:            func(o *CheckBundle) *[]string { return &o.Tags },
+})
+
 // NewCheckBundle returns new CheckBundle (with defaults, if applicable)
 func NewCheckBundle() *CheckBundle {
 	return &CheckBundle{
@@ -70,236 +77,139 @@ func NewCheckBundle() *CheckBundle {
 }
 
 // FetchCheckBundle retrieves check bundle with passed cid.
-func (a *API) FetchCheckBundle(cid CIDType) (*CheckBundle, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid check bundle CID (none)")
-	}
-
-	var bundleCID string
-	if !strings.HasPrefix(*cid, config.CheckBundlePrefix) {
-		bundleCID = fmt.Sprintf("%s/%s", config.CheckBundlePrefix, *cid)
-	} else {
-		bundleCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.CheckBundleCIDRegex, bundleCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid check bundle CID (%v)", bundleCID)
-	}
-
-	result, err := a.Get(bundleCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching check bundle")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch check bundle, received JSON: %s", string(result))
-	}
-
-	checkBundle := &CheckBundle{}
-	if err := json.Unmarshal(result, checkBundle); err != nil {
-		return nil, errors.Wrap(err, "parsing check bundle")
-	}
+func (a *API) FetchCheckBundle(cid CIDType, opts ...CallOption) (*CheckBundle, error) {
+	return a.FetchCheckBundleWithContext(context.Background(), cid, opts...)
+}
 
-	return checkBundle, nil
+// FetchCheckBundleWithContext is FetchCheckBundle with a context for cancellation and deadlines.
+func (a *API) FetchCheckBundleWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*CheckBundle, error) {
+	return checkBundleResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchCheckBundles retrieves all check bundles available to the API Token.
-func (a *API) FetchCheckBundles() (*[]CheckBundle, error) {
-	result, err := a.Get(config.CheckBundlePrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching check bundles")
-	}
-
-	var checkBundles []CheckBundle
-	if err := json.Unmarshal(result, &checkBundles); err != nil {
-		return nil, errors.Wrap(err, "parsing check bundles")
-	}
+func (a *API) FetchCheckBundles(opts ...CallOption) (*[]CheckBundle, error) {
+	return a.FetchCheckBundlesWithContext(context.Background(), opts...)
+}
 
-	return &checkBundles, nil
+// FetchCheckBundlesWithContext is FetchCheckBundles with a context for cancellation and deadlines.
+func (a *API) FetchCheckBundlesWithContext(ctx context.Context, opts ...CallOption) (*[]CheckBundle, error) {
+	return checkBundleResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateCheckBundle updates passed check bundle.
-func (a *API) UpdateCheckBundle(cfg *CheckBundle) (*CheckBundle, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid check bundle config (nil)")
-	}
-
-	bundleCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.CheckBundleCIDRegex, bundleCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid check bundle CID (%s)", bundleCID)
-	}
-
-	if len(cfg.Tags) > 0 {
-		cfg.Tags = fixTags(cfg.Tags)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update check bundle, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) UpdateCheckBundle(cfg *CheckBundle, opts ...CallOption) (*CheckBundle, error) {
+	return a.UpdateCheckBundleWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Put(bundleCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating check bundle")
-	}
+// UpdateCheckBundleWithContext is UpdateCheckBundle with a context for cancellation and deadlines.
+func (a *API) UpdateCheckBundleWithContext(ctx context.Context, cfg *CheckBundle, opts ...CallOption) (*CheckBundle, error) {
+	return checkBundleResource.Update(ctx, a, cfg, opts...)
+}
 
-	checkBundle := &CheckBundle{}
-	if err := json.Unmarshal(result, checkBundle); err != nil {
-		return nil, errors.Wrap(err, "parsing check bundle")
-	}
+// PatchCheckBundle applies patch (see Patcher) to the check bundle with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchCheckBundle(cid CIDType, patch Patcher, opts ...CallOption) (*CheckBundle, error) {
+	return a.PatchCheckBundleWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return checkBundle, nil
+// PatchCheckBundleWithContext is PatchCheckBundle with a context for cancellation and deadlines.
+func (a *API) PatchCheckBundleWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*CheckBundle, error) {
+	return checkBundleResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateCheckBundle creates a new check bundle (check).
-func (a *API) CreateCheckBundle(cfg *CheckBundle) (*CheckBundle, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid check bundle config (nil)")
-	}
-
-	if len(cfg.Tags) > 0 {
-		cfg.Tags = fixTags(cfg.Tags)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create check bundle, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Post(config.CheckBundlePrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating check bundle")
-	}
-
-	checkBundle := &CheckBundle{}
-	if err := json.Unmarshal(result, checkBundle); err != nil {
-		return nil, errors.Wrap(err, "parsing check bundle")
-	}
+func (a *API) CreateCheckBundle(cfg *CheckBundle, opts ...CallOption) (*CheckBundle, error) {
+	return a.CreateCheckBundleWithContext(context.Background(), cfg, opts...)
+}
 
-	return checkBundle, nil
+// CreateCheckBundleWithContext is CreateCheckBundle with a context for cancellation and deadlines.
+func (a *API) CreateCheckBundleWithContext(ctx context.Context, cfg *CheckBundle, opts ...CallOption) (*CheckBundle, error) {
+	return checkBundleResource.Create(ctx, a, cfg, opts...)
 }
 
 // DeleteCheckBundle deletes passed check bundle.
-func (a *API) DeleteCheckBundle(cfg *CheckBundle) (bool, error) {
+func (a *API) DeleteCheckBundle(cfg *CheckBundle, opts ...CallOption) (bool, error) {
+	return a.DeleteCheckBundleWithContext(context.Background(), cfg, opts...)
+}
+
+// DeleteCheckBundleWithContext is DeleteCheckBundle with a context for cancellation and deadlines.
+func (a *API) DeleteCheckBundleWithContext(ctx context.Context, cfg *CheckBundle, opts ...CallOption) (bool, error) {
 	if cfg == nil {
 		return false, errors.New("invalid check bundle config (nil)")
 	}
-	return a.DeleteCheckBundleByCID(CIDType(&cfg.CID))
+	return a.DeleteCheckBundleByCIDWithContext(ctx, CIDType(&cfg.CID), opts...)
 }
 
 // DeleteCheckBundleByCID deletes check bundle with passed cid.
-func (a *API) DeleteCheckBundleByCID(cid CIDType) (bool, error) {
-
-	if cid == nil || *cid == "" {
-		return false, errors.New("invalid check bundle CID (none)")
-	}
-
-	var bundleCID string
-	if !strings.HasPrefix(*cid, config.CheckBundlePrefix) {
-		bundleCID = fmt.Sprintf("%s/%s", config.CheckBundlePrefix, *cid)
-	} else {
-		bundleCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.CheckBundleCIDRegex, bundleCID)
-	if err != nil {
-		return false, err
-	}
-	if !matched {
-		return false, errors.Errorf("invalid check bundle CID (%v)", bundleCID)
-	}
-
-	_, err = a.Delete(bundleCID)
-	if err != nil {
-		return false, errors.Wrap(err, "deleting check bundle")
-	}
+func (a *API) DeleteCheckBundleByCID(cid CIDType, opts ...CallOption) (bool, error) {
+	return a.DeleteCheckBundleByCIDWithContext(context.Background(), cid, opts...)
+}
 
-	return true, nil
+// DeleteCheckBundleByCIDWithContext is DeleteCheckBundleByCID with a context for cancellation and deadlines.
+func (a *API) DeleteCheckBundleByCIDWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (bool, error) {
+	return checkBundleResource.Delete(ctx, a, cid, opts...)
 }
 
 // SearchCheckBundles returns check bundles matching the specified
 // search query and/or filter. If nil is passed for both parameters
 // all check bundles will be returned.
-func (a *API) SearchCheckBundles(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]CheckBundle, error) {
-
-	q := url.Values{}
-
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
-
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
-
-	if q.Encode() == "" {
-		return a.FetchCheckBundles()
-	}
-
-	reqURL := url.URL{
-		Path:     config.CheckBundlePrefix,
-		RawQuery: q.Encode(),
-	}
-
-	resp, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching check bundles")
-	}
+func (a *API) SearchCheckBundles(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]CheckBundle, error) {
+	return a.SearchCheckBundlesWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	var results []CheckBundle
-	if err := json.Unmarshal(resp, &results); err != nil {
-		return nil, errors.Wrap(err, "parsing check bundles")
-	}
+// SearchCheckBundlesWithContext is SearchCheckBundles with a context for cancellation and deadlines.
+func (a *API) SearchCheckBundlesWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]CheckBundle, error) {
+	return checkBundleResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	return &results, nil
+// IterateCheckBundles calls fn for each check bundle matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateCheckBundles(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*CheckBundle) error) error {
+	return a.IterateCheckBundlesWithContext(context.Background(), searchCriteria, filterCriteria, fn)
 }
 
-func fixTags(tags []string) []string {
-	if len(tags) == 0 {
-		return tags
-	}
+// IterateCheckBundlesWithContext is IterateCheckBundles with a context for cancellation and deadlines.
+func (a *API) IterateCheckBundlesWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*CheckBundle) error) error {
+	return checkBundleResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	unique := make(map[string]bool)
-	var result []string
+// BulkCreateCheckBundles creates check bundles concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateCheckBundles(cfgs []*CheckBundle, opts *BulkOptions) BulkResults[*CheckBundle] {
+	return a.BulkCreateCheckBundlesWithContext(context.Background(), cfgs, opts)
+}
 
-	for _, tag := range tags {
-		// remove blanks
-		if tag == "" {
-			continue
-		}
+// BulkCreateCheckBundlesWithContext is BulkCreateCheckBundles with a context for cancellation and deadlines.
+func (a *API) BulkCreateCheckBundlesWithContext(ctx context.Context, cfgs []*CheckBundle, opts *BulkOptions) BulkResults[*CheckBundle] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *CheckBundle) (*CheckBundle, error) {
+		return a.CreateCheckBundleWithContext(ctx, cfg)
+	})
+}
 
-		// lowercase
-		tag = strings.ToLower(tag)
+// BulkUpdateCheckBundles updates check bundles concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateCheckBundles(cfgs []*CheckBundle, opts *BulkOptions) BulkResults[*CheckBundle] {
+	return a.BulkUpdateCheckBundlesWithContext(context.Background(), cfgs, opts)
+}
 
-		// remove duplicates
-		if _, found := unique[tag]; !found {
-			unique[tag] = true
-			result = append(result, tag)
-		}
-	}
+// BulkUpdateCheckBundlesWithContext is BulkUpdateCheckBundles with a context for cancellation and deadlines.
+func (a *API) BulkUpdateCheckBundlesWithContext(ctx context.Context, cfgs []*CheckBundle, opts *BulkOptions) BulkResults[*CheckBundle] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *CheckBundle) (*CheckBundle, error) {
+		return a.UpdateCheckBundleWithContext(ctx, cfg)
+	})
+}
 
-	sort.Strings(result)
+// BulkDeleteCheckBundles deletes check bundles by cid concurrently (see BulkOptions),
+// the results are in the same order as cids.
+func (a *API) BulkDeleteCheckBundles(cids []string, opts *BulkOptions) BulkResults[bool] {
+	return a.BulkDeleteCheckBundlesWithContext(context.Background(), cids, opts)
+}
 
-	return result
+// BulkDeleteCheckBundlesWithContext is BulkDeleteCheckBundles with a context for cancellation and deadlines.
+func (a *API) BulkDeleteCheckBundlesWithContext(ctx context.Context, cids []string, opts *BulkOptions) BulkResults[bool] {
+	return Bulk(ctx, cids, opts, func(ctx context.Context, cid string) (bool, error) {
+		return a.DeleteCheckBundleByCIDWithContext(ctx, CIDType(&cid))
+	})
 }
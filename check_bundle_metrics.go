@@ -10,13 +10,9 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
-	"github.com/pkg/errors"
 )
 
 // CheckBundleMetrics defines metrics for a specific check bundle. See https://login.circonus.com/resources/api/calls/check_bundle_metrics for more information.
@@ -25,78 +21,55 @@ type CheckBundleMetrics struct {
 	Metrics []CheckBundleMetric `json:"metrics"`        // See check_bundle.go for CheckBundleMetric definition
 }
 
-// FetchCheckBundleMetrics retrieves metrics for the check bundle with passed cid.
-func (a *API) FetchCheckBundleMetrics(cid CIDType) (*CheckBundleMetrics, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid check bundle metrics CID (none)")
-	}
-
-	var metricsCID string
-	if !strings.HasPrefix(*cid, config.CheckBundleMetricsPrefix) {
-		metricsCID = fmt.Sprintf("%s/%s", config.CheckBundleMetricsPrefix, *cid)
-	} else {
-		metricsCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.CheckBundleMetricsCIDRegex, metricsCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid check bundle metrics CID (%s)", metricsCID)
-	}
-
-	result, err := a.Get(metricsCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching check bundle metrics")
-	}
+// checkBundleMetricsResource describes the check bundle metrics endpoint
+var checkBundleMetricsResource = RegisterResource(&Resource[CheckBundleMetrics]{
+	Name:     "check bundle metrics",
+	Plural:   "check bundle metrics",
+	Prefix:   config.CheckBundleMetricsPrefix,
+	CIDRegex: config.CheckBundleMetricsCIDRegex,
+	CID:      func(o *CheckBundleMetrics) string { return o.CID },
+})
 
-	if a.Debug {
-		a.Log.Printf("fetch check bundle metrics, received JSON: %s", string(result))
-	}
-
-	metrics := &CheckBundleMetrics{}
-	if err := json.Unmarshal(result, metrics); err != nil {
-		return nil, errors.Wrap(err, "parsing check bundle metrics")
-	}
+// FetchCheckBundleMetrics retrieves metrics for the check bundle with passed cid.
+func (a *API) FetchCheckBundleMetrics(cid CIDType, opts ...CallOption) (*CheckBundleMetrics, error) {
+	return a.FetchCheckBundleMetricsWithContext(context.Background(), cid, opts...)
+}
 
-	return metrics, nil
+// FetchCheckBundleMetricsWithContext is FetchCheckBundleMetrics with a context for cancellation and deadlines.
+func (a *API) FetchCheckBundleMetricsWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*CheckBundleMetrics, error) {
+	return checkBundleMetricsResource.Fetch(ctx, a, cid, opts...)
 }
 
 // UpdateCheckBundleMetrics updates passed metrics.
-func (a *API) UpdateCheckBundleMetrics(cfg *CheckBundleMetrics) (*CheckBundleMetrics, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid check bundle metrics config (nil)")
-	}
-
-	metricsCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.CheckBundleMetricsCIDRegex, metricsCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid check bundle metrics CID (%s)", metricsCID)
-	}
+func (a *API) UpdateCheckBundleMetrics(cfg *CheckBundleMetrics, opts ...CallOption) (*CheckBundleMetrics, error) {
+	return a.UpdateCheckBundleMetricsWithContext(context.Background(), cfg, opts...)
+}
 
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
+// UpdateCheckBundleMetricsWithContext is UpdateCheckBundleMetrics with a context for cancellation and deadlines.
+func (a *API) UpdateCheckBundleMetricsWithContext(ctx context.Context, cfg *CheckBundleMetrics, opts ...CallOption) (*CheckBundleMetrics, error) {
+	return checkBundleMetricsResource.Update(ctx, a, cfg, opts...)
+}
 
-	if a.Debug {
-		a.Log.Printf("update check bundle metrics, sending JSON: %s", string(jsonCfg))
-	}
+// PatchCheckBundleMetrics applies patch (see Patcher) to the check bundle metrics with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchCheckBundleMetrics(cid CIDType, patch Patcher, opts ...CallOption) (*CheckBundleMetrics, error) {
+	return a.PatchCheckBundleMetricsWithContext(context.Background(), cid, patch, opts...)
+}
 
-	result, err := a.Put(metricsCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating check bundle metrics")
-	}
+// PatchCheckBundleMetricsWithContext is PatchCheckBundleMetrics with a context for cancellation and deadlines.
+func (a *API) PatchCheckBundleMetricsWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*CheckBundleMetrics, error) {
+	return checkBundleMetricsResource.Patch(ctx, a, cid, patch, opts...)
+}
 
-	metrics := &CheckBundleMetrics{}
-	if err := json.Unmarshal(result, metrics); err != nil {
-		return nil, errors.Wrap(err, "parsing check bundle metrics")
-	}
+// BulkUpdateCheckBundleMetrics updates check bundle metrics concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateCheckBundleMetrics(cfgs []*CheckBundleMetrics, opts *BulkOptions) BulkResults[*CheckBundleMetrics] {
+	return a.BulkUpdateCheckBundleMetricsWithContext(context.Background(), cfgs, opts)
+}
 
-	return metrics, nil
+// BulkUpdateCheckBundleMetricsWithContext is BulkUpdateCheckBundleMetrics with a context for cancellation and deadlines.
+func (a *API) BulkUpdateCheckBundleMetricsWithContext(ctx context.Context, cfgs []*CheckBundleMetrics, opts *BulkOptions) BulkResults[*CheckBundleMetrics] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *CheckBundleMetrics) (*CheckBundleMetrics, error) {
+		return a.UpdateCheckBundleMetricsWithContext(ctx, cfg)
+	})
 }
@@ -5,7 +5,9 @@
 package apiclient
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -199,6 +201,37 @@ func TestFetchCheckBundle(t *testing.T) {
 	}
 }
 
+func TestFetchCheckBundleWithContext(t *testing.T) {
+	apih, server := checkBundleTestBootstrap(t)
+	defer server.Close()
+
+	cid := "/check_bundle/1234"
+
+	bundle, err := apih.FetchCheckBundleWithContext(context.Background(), CIDType(&cid))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if reflect.TypeOf(bundle).String() != "*apiclient.CheckBundle" {
+		t.Fatalf("unexpected type (%s)", reflect.TypeOf(bundle).String())
+	}
+
+	missing := "/check_bundle/9999"
+	if _, err := apih.FetchCheckBundleWithContext(context.Background(), CIDType(&missing)); err == nil {
+		t.Fatal("expected error")
+	} else if !IsNotFound(err) {
+		t.Fatalf("expected not found, got (%s)", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := apih.FetchCheckBundleWithContext(ctx, CIDType(&cid)); err == nil {
+		t.Fatal("expected error")
+	} else if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+}
+
 func TestFetchCheckBundles(t *testing.T) {
 	apih, server := checkBundleTestBootstrap(t)
 	defer server.Close()
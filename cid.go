@@ -0,0 +1,144 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CID is a parsed object CID, e.g. /check_bundle/1234 is
+// CID{Kind: "check_bundle", ID: "1234"}. The zero value is an empty CID. It
+// marshals to, and unmarshals from, a JSON string so it can be used for
+// reference fields (e.g. the check of a rule set) in structs.
+type CID struct {
+	// Kind of object, the endpoint path without the leading slash (e.g. "check_bundle")
+	Kind string
+	// ID of the object (e.g. "1234")
+	ID string
+}
+
+// cidKinds holds the precompiled validation regex of each kind, kinds are
+// added by RegisterResource
+var (
+	cidKinds   = map[string]*regexp.Regexp{}
+	cidKindsmu sync.RWMutex
+)
+
+// registerCIDKind compiles the validation regex for CIDs of kind
+func registerCIDKind(kind, cidRegex string) {
+	re := regexp.MustCompile(cidRegex)
+
+	cidKindsmu.Lock()
+	cidKinds[kind] = re
+	cidKindsmu.Unlock()
+}
+
+// ParseCID parses cid as a CID of kind (e.g. "check_bundle"). It accepts a
+// bare ID ("1234"), a CID ("/check_bundle/1234") or an API path
+// ("/v2/check_bundle/1234"). If kind is empty the kind is taken from cid, which
+// can not be a bare ID then. The CID is validated with the regex of its kind,
+// unknown kinds are an error.
+func ParseCID(kind, cid string) (CID, error) {
+	kind = strings.Trim(kind, "/")
+	if cid == "" {
+		return CID{}, errors.New("invalid CID (none)")
+	}
+
+	cidKindsmu.RLock()
+	defer cidKindsmu.RUnlock()
+
+	c := CID{Kind: kind, ID: cid}
+	if strings.HasPrefix(cid, "/") {
+		path := strings.TrimPrefix(strings.TrimPrefix(cid, "/v2/"), "/")
+		if kind == "" {
+			// longest match, /check_bundle_metrics/1 is not a check_bundle
+			for k := range cidKinds {
+				if strings.HasPrefix(path, k+"/") && len(k) > len(c.Kind) {
+					c.Kind = k
+				}
+			}
+			if c.Kind == "" {
+				return CID{}, errors.Errorf("invalid CID (%s), unknown kind", cid)
+			}
+		} else if !strings.HasPrefix(path, kind+"/") {
+			return CID{}, errors.Errorf("invalid %s CID (%s)", kind, cid)
+		}
+		c.ID = strings.TrimPrefix(path, c.Kind+"/")
+	} else if kind == "" {
+		return CID{}, errors.Errorf("invalid CID (%s), bare ID without kind", cid)
+	}
+
+	re, ok := cidKinds[c.Kind]
+	if !ok {
+		return CID{}, errors.Errorf("invalid CID (%s), unknown kind %q", cid, c.Kind)
+	}
+	if c.ID == "" || !re.MatchString(c.String()) {
+		return CID{}, errors.Errorf("invalid %s CID (%s)", c.Kind, cid)
+	}
+
+	return c, nil
+}
+
+// MustCID is like ParseCID but panics if cid is invalid. It simplifies safe
+// initialization of variables holding CIDs.
+func MustCID(kind, cid string) CID {
+	c, err := ParseCID(kind, cid)
+	if err != nil {
+		panic(err.Error())
+	}
+	return c
+}
+
+// String returns the CID with prefix (e.g. /check_bundle/1234), or an empty
+// string for the zero CID
+func (c CID) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	return "/" + c.Kind + "/" + c.ID
+}
+
+// IsZero reports whether c is the zero (empty) CID
+func (c CID) IsZero() bool {
+	return c.Kind == "" && c.ID == ""
+}
+
+// CIDType returns c for the methods taking a CIDType (e.g. FetchCheckBundle)
+func (c CID) CIDType() CIDType {
+	s := c.String()
+	return &s
+}
+
+// MarshalJSON encodes c as a JSON string, "" for the zero CID
+func (c CID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+// UnmarshalJSON decodes a CID from a JSON string, an empty string or null is
+// the zero CID
+func (c *CID) UnmarshalJSON(data []byte) error {
+	var s *string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, "parsing CID")
+	}
+
+	if s == nil || *s == "" {
+		*c = CID{}
+		return nil
+	}
+
+	cid, err := ParseCID("", *s)
+	if err != nil {
+		return err
+	}
+	*c = cid
+
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseCID(t *testing.T) {
+	tests := []struct {
+		expected   CID
+		id         string
+		kind       string
+		cid        string
+		shouldFail bool
+	}{
+		{id: "bare id", kind: "check_bundle", cid: "123", expected: CID{Kind: "check_bundle", ID: "123"}},
+		{id: "cid", kind: "check_bundle", cid: "/check_bundle/123", expected: CID{Kind: "check_bundle", ID: "123"}},
+		{id: "api path", kind: "check_bundle", cid: "/v2/check_bundle/123", expected: CID{Kind: "check_bundle", ID: "123"}},
+		{id: "kind with slash", kind: "/check_bundle", cid: "123", expected: CID{Kind: "check_bundle", ID: "123"}},
+		{id: "kind from cid", cid: "/rule_set/123_tt_firstbyte", expected: CID{Kind: "rule_set", ID: "123_tt_firstbyte"}},
+		{id: "kind from api path", cid: "/v2/graph/abc-123", expected: CID{Kind: "graph", ID: "abc-123"}},
+		{id: "longest kind", cid: "/check_bundle_metrics/123", expected: CID{Kind: "check_bundle_metrics", ID: "123"}},
+		{id: "prefix of other kind", kind: "check", cid: "/check_bundle/123", shouldFail: true},
+		{id: "other kind", kind: "graph", cid: "/check/123", shouldFail: true},
+		{id: "no id", kind: "graph", cid: "/graph/", shouldFail: true},
+		{id: "invalid", kind: "graph", cid: "/invalid", shouldFail: true},
+		{id: "bare id without kind", cid: "123", shouldFail: true},
+		{id: "unknown kind", cid: "/foo/123", shouldFail: true},
+		{id: "unknown kind (bare id)", kind: "foo", cid: "123", shouldFail: true},
+		{id: "none", kind: "graph", cid: "", shouldFail: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			c, err := ParseCID(test.kind, test.cid)
+			if test.shouldFail {
+				if err == nil {
+					t.Fatalf("expected error, got %#v", c)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			if c != test.expected {
+				t.Fatalf("expected %#v, got %#v", test.expected, c)
+			}
+		})
+	}
+}
+
+func TestMustCID(t *testing.T) {
+	if c := MustCID("rule_set", "1234"); c.String() != "/rule_set/1234" || *c.CIDType() != "/rule_set/1234" {
+		t.Fatalf("unexpected cid (%s)", c)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	MustCID("rule_set", "/check/1234")
+}
+
+func TestCIDJSON(t *testing.T) {
+	type ref struct {
+		CheckCID CID `json:"check"`
+	}
+
+	var r ref
+	if err := json.Unmarshal([]byte(`{"check":"/check/1234"}`), &r); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if r.CheckCID != (CID{Kind: "check", ID: "1234"}) {
+		t.Fatalf("unexpected cid %#v", r.CheckCID)
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if string(data) != `{"check":"/check/1234"}` {
+		t.Fatalf("unexpected json (%s)", data)
+	}
+
+	for _, empty := range []string{`{"check":""}`, `{"check":null}`} {
+		r = ref{CheckCID: CID{Kind: "check", ID: "1"}}
+		if err := json.Unmarshal([]byte(empty), &r); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if !r.CheckCID.IsZero() {
+			t.Fatalf("expected zero cid for %s, got %#v", empty, r.CheckCID)
+		}
+	}
+	if data, _ := json.Marshal(ref{}); string(data) != `{"check":""}` {
+		t.Fatalf("unexpected json (%s)", data)
+	}
+
+	for _, invalid := range []string{`{"check":"1234"}`, `{"check":1234}`, `{"check":"/foo/1"}`} {
+		if err := json.Unmarshal([]byte(invalid), &r); err == nil {
+			t.Fatalf("expected error for %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultBreakerCooldown how long the circuit breaker stays open before probing
+const defaultBreakerCooldown = 30 * time.Second
+
+// BreakerState is the state of the circuit breaker (see Config.CircuitBreakerThreshold)
+type BreakerState int
+
+const (
+	// BreakerClosed requests are sent
+	BreakerClosed BreakerState = iota
+	// BreakerOpen requests fail with a *CircuitOpenError without being sent
+	BreakerOpen
+	// BreakerHalfOpen one probe request is sent, its result closes or re-opens the breaker
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// CircuitOpenError is returned, without sending the request, while the circuit breaker is open
+type CircuitOpenError struct {
+	// Until is when the breaker will allow a probe request
+	Until time.Time
+	// Failures is the run of failures which opened the breaker
+	Failures int
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open after %d consecutive failures, until %s", e.Failures, e.Until.Format(time.RFC3339))
+}
+
+// IsCircuitOpen reports whether err was caused by an open circuit breaker
+func IsCircuitOpen(err error) bool {
+	var e *CircuitOpenError
+	return errors.As(err, &e)
+}
+
+// circuitBreaker opens after a run of failed (5xx, timeout, connection error)
+// request attempts
+type circuitBreaker struct {
+	onChange  func(from, to BreakerState)
+	now       func() time.Time
+	openUntil time.Time
+	threshold int
+	failures  int
+	cooldown  time.Duration
+	state     BreakerState
+	gen       uint64 // state changes, results of requests allowed before a change are ignored
+	probing   bool
+	mu        sync.Mutex
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, onChange func(from, to BreakerState), clock Clock) *circuitBreaker {
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		onChange:  onChange,
+		now:       clock.Now,
+	}
+}
+
+// allow returns an error if the request should not be sent, otherwise the
+// generation to record its result with. While half-open the only request
+// allowed is the probe.
+func (b *circuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+
+	var from BreakerState
+	changed := false
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Before(b.openUntil) {
+			err := &CircuitOpenError{Until: b.openUntil, Failures: b.failures}
+			b.mu.Unlock()
+			return 0, err
+		}
+		from, changed = b.state, true
+		b.state = BreakerHalfOpen
+		b.gen++
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			err := &CircuitOpenError{Until: b.openUntil, Failures: b.failures}
+			b.mu.Unlock()
+			return 0, err
+		}
+		b.probing = true
+	}
+	gen := b.gen
+
+	b.mu.Unlock()
+
+	if changed {
+		b.notify(from, BreakerHalfOpen)
+	}
+	return gen, nil
+}
+
+// record the result of a request allowed in generation gen
+func (b *circuitBreaker) record(gen uint64, failed bool) {
+	b.mu.Lock()
+
+	if gen != b.gen {
+		// allowed before the state changed (e.g. sent while closed, completing
+		// while half-open), only the probe ends the half-open state
+		b.mu.Unlock()
+		return
+	}
+
+	from := b.state
+	b.probing = false
+	if failed {
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+			b.state = BreakerOpen
+			b.openUntil = b.now().Add(b.cooldown)
+		}
+	} else {
+		b.failures = 0
+		b.state = BreakerClosed
+	}
+	to := b.state
+	if from != to {
+		b.gen++
+	}
+
+	b.mu.Unlock()
+
+	if from != to {
+		b.notify(from, to)
+	}
+}
+
+// release ends a request allowed in generation gen without a result (e.g.
+// canceled by the caller)
+func (b *circuitBreaker) release(gen uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen == b.gen {
+		b.probing = false
+	}
+}
+
+func (b *circuitBreaker) getState() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) notify(from, to BreakerState) {
+	if b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
+
+// breakerTransport fails fast while the breaker is open and records the
+// result of each request attempt
+type breakerTransport struct {
+	next    http.RoundTripper
+	breaker *circuitBreaker
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	gen, err := t.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		// canceled by the caller or past its deadline, not an API failure
+		t.breaker.release(gen)
+	case err != nil:
+		t.breaker.record(gen, true)
+	default:
+		t.breaker.record(gen, resp.StatusCode >= 500)
+	}
+
+	return resp, err
+}
+
+// CircuitBreakerState returns the state of the circuit breaker (closed when it is not enabled)
+func (a *API) CircuitBreakerState() BreakerState {
+	if a.breaker == nil {
+		return BreakerClosed
+	}
+	return a.breaker.getState()
+}
@@ -0,0 +1,209 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var failing int32
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(503)
+			fmt.Fprintln(w, `{"code":"Unavailable"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"_cid":"/user/1"}`)
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var changes []string
+
+	apih, err := NewAPI(&Config{
+		TokenKey:                "foo",
+		TokenApp:                "bar",
+		URL:                     server.URL,
+		MaxRetries:              4,
+		MinRetryDelay:           "1ms",
+		MaxRetryDelay:           "2ms",
+		CircuitBreakerThreshold: 3,
+		CircuitBreakerCooldown:  "1m",
+		CircuitBreakerOnStateChange: func(from, to BreakerState) {
+			mu.Lock()
+			changes = append(changes, from.String()+"->"+to.String())
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	now := time.Now()
+	apih.breaker.now = func() time.Time { return now }
+
+	// three failed attempts (first try + 2 retries) open the breaker, the
+	// third retry fails fast
+	atomic.StoreInt32(&failing, 1)
+	_, err = apih.FetchUser(nil)
+	if !IsCircuitOpen(err) {
+		t.Fatalf("expected circuit open, got (%v)", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+	if s := apih.CircuitBreakerState(); s != BreakerOpen {
+		t.Fatalf("expected open, got %s", s)
+	}
+
+	// fails fast while open
+	start := time.Now()
+	if _, err := apih.FetchUser(nil); !IsCircuitOpen(err) {
+		t.Fatalf("expected circuit open, got (%v)", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Fatal("expected open breaker to fail fast")
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Fatalf("expected no request while open, got %d", n)
+	}
+
+	// failed probe re-opens
+	now = now.Add(2 * time.Minute)
+	if _, err := apih.FetchUser(nil); !IsCircuitOpen(err) {
+		t.Fatalf("expected circuit open, got (%v)", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 4 {
+		t.Fatalf("expected 1 probe request, got %d", n-3)
+	}
+
+	// successful probe closes
+	atomic.StoreInt32(&failing, 0)
+	now = now.Add(2 * time.Minute)
+	if _, err := apih.FetchUser(nil); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if s := apih.CircuitBreakerState(); s != BreakerClosed {
+		t.Fatalf("expected closed, got %s", s)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if fmt.Sprint(changes) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v, got %v", expected, changes)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute, nil, systemClock{})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	// sent while closed, completing after the breaker opened
+	slow, err := b.allow()
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	gen, err := b.allow()
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	b.record(gen, true)
+
+	now = now.Add(2 * time.Minute)
+	probe, err := b.allow()
+	if err != nil {
+		t.Fatalf("expected probe to be allowed (%s)", err)
+	}
+	if _, err := b.allow(); !IsCircuitOpen(err) {
+		t.Fatalf("expected one probe at a time, got (%v)", err)
+	}
+
+	// results of requests sent before the probe do not end the half-open state
+	b.record(slow, false)
+	b.release(slow)
+	if s := b.getState(); s != BreakerHalfOpen {
+		t.Fatalf("expected half-open, got %s", s)
+	}
+	if _, err := b.allow(); !IsCircuitOpen(err) {
+		t.Fatalf("expected one probe at a time, got (%v)", err)
+	}
+
+	// a canceled probe does not change state, the next request probes
+	b.release(probe)
+	if s := b.getState(); s != BreakerHalfOpen {
+		t.Fatalf("expected half-open, got %s", s)
+	}
+	if probe, err = b.allow(); err != nil {
+		t.Fatalf("expected probe to be allowed (%s)", err)
+	}
+	b.record(probe, false)
+	if s := b.getState(); s != BreakerClosed {
+		t.Fatalf("expected closed, got %s", s)
+	}
+
+	// nor a closed breaker
+	b.record(slow, true)
+	if s := b.getState(); s != BreakerClosed {
+		t.Fatalf("expected closed, got %s", s)
+	}
+}
+
+func TestCircuitBreakerCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL, CircuitBreakerThreshold: 1})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	tests := []struct {
+		description string
+		call        func() error
+	}{
+		{"canceled", func() error {
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				cancel()
+			}()
+			_, err := apih.GetWithContext(ctx, "/user/current")
+			return err
+		}},
+		{"deadline", func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err := apih.GetWithContext(ctx, "/user/current")
+			return err
+		}},
+		{"call timeout", func() error {
+			_, err := apih.Get("/user/current", WithTimeout(20*time.Millisecond))
+			return err
+		}},
+	}
+
+	for _, test := range tests {
+		if err := test.call(); err == nil {
+			t.Fatalf("%s: expected error", test.description)
+		}
+		if s := apih.CircuitBreakerState(); s != BreakerClosed {
+			t.Fatalf("%s: expected the caller ending the request to leave the breaker closed, got %s", test.description, s)
+		}
+	}
+}
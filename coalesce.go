@@ -0,0 +1,105 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// flightGroup deduplicates concurrent identical GET requests
+type flightGroup struct {
+	calls map[string]*flightCall
+	mu    sync.Mutex
+}
+
+// flightCall is an in-flight GET shared by one or more callers
+type flightCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	err     error
+	result  []byte
+	waiters int
+}
+
+// detachedContext keeps the values of its parent but not its deadline or
+// cancellation, so a shared request outlives the caller which started it
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// coalescedGet sends one GET for reqPath no matter how many callers request
+// it concurrently. Each caller receives its own copy of the response, so
+// decoded objects are never shared. The request is not tied to the context of
+// any one caller, a caller whose context ends stops waiting, and the request is
+// canceled once no callers are waiting.
+func (a *API) coalescedGet(ctx context.Context, reqPath string) ([]byte, error) {
+	g := &a.flights
+
+	g.mu.Lock()
+	c, ok := g.calls[reqPath]
+	if !ok {
+		callCtx, cancel := context.WithCancel(detachedContext{ctx})
+		c = &flightCall{done: make(chan struct{}), cancel: cancel}
+		if g.calls == nil {
+			g.calls = make(map[string]*flightCall)
+		}
+		g.calls[reqPath] = c
+		go func() {
+			c.result, c.err = a.apiRequest(callCtx, "GET", reqPath, nil)
+			g.mu.Lock()
+			if g.calls[reqPath] == c {
+				delete(g.calls, reqPath)
+			}
+			g.mu.Unlock()
+			cancel()
+			close(c.done)
+		}()
+	} else {
+		a.logDebug("joining in-flight request", "path", reqPath)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		if c.err != nil {
+			return nil, c.err
+		}
+		return append([]byte(nil), c.result...), nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// nobody is waiting, later callers start a new request
+			c.cancel()
+			if g.calls[reqPath] == c {
+				delete(g.calls, reqPath)
+			}
+		}
+		g.mu.Unlock()
+		return nil, errors.Wrap(ctx.Err(), "Circonus API call")
+	}
+}
+
+// forget detaches the in-flight GET for reqPath, if any, so later callers
+// start a new request instead of receiving a response from before a change.
+// Callers already waiting still receive its response.
+func (g *flightGroup) forget(reqPath string) {
+	g.mu.Lock()
+	delete(g.calls, reqPath)
+	g.mu.Unlock()
+}
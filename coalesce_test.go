@@ -0,0 +1,226 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowServer responds to each request after release is closed, counting requests per path
+func slowServer(release chan struct{}) (*httptest.Server, *sync.Map) {
+	var counts sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := counts.LoadOrStore(r.URL.Path, new(int32))
+		atomic.AddInt32(n.(*int32), 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"_cid":"%s","display_name":"original","tags":["a","b"]}`, r.URL.Path)
+	}))
+	return server, &counts
+}
+
+func requestCount(counts *sync.Map, path string) int32 {
+	n, ok := counts.Load(path)
+	if !ok {
+		return 0
+	}
+	return atomic.LoadInt32(n.(*int32))
+}
+
+func TestCoalescedGets(t *testing.T) {
+	release := make(chan struct{})
+	server, counts := slowServer(release)
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", TokenApp: "bar", URL: server.URL, CoalesceGets: true})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	const callers = 10
+	bundles := make([]*CheckBundle, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cid := "/check_bundle/1234"
+			b, err := apih.FetchCheckBundle(CIDType(&cid))
+			if err != nil {
+				t.Errorf("unexpected error (%s)", err)
+				return
+			}
+			bundles[i] = b
+		}(i)
+	}
+
+	// a different object is not coalesced with the others
+	other := make(chan error, 1)
+	go func() {
+		_, err := apih.Get("/check_bundle/5678")
+		other <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if err := <-other; err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if n := requestCount(counts, "/check_bundle/1234"); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+	if n := requestCount(counts, "/check_bundle/5678"); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+
+	bundles[0].DisplayName = "mutated"
+	bundles[0].Tags[0] = "mutated"
+	for _, b := range bundles[1:] {
+		if b.DisplayName != "original" || b.Tags[0] != "a" {
+			t.Fatalf("mutation leaked between callers %#v", b)
+		}
+	}
+
+	// not in flight, a new request is sent
+	if _, err := apih.Get("/check_bundle/1234"); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if n := requestCount(counts, "/check_bundle/1234"); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestCoalescedGetsCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server, counts := slowServer(release)
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", TokenApp: "bar", URL: server.URL, CoalesceGets: true})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	// the first caller giving up does not fail the others
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := apih.GetWithContext(ctx, "/user/current")
+		first <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := apih.Get("/user/current")
+		second <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got (%v)", err)
+	}
+
+	close(release)
+	if err := <-second; err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if n := requestCount(counts, "/user/current"); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+func TestCoalescedGetsAfterWrite(t *testing.T) {
+	release := make(chan struct{})
+	server, counts := slowServer(release)
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", TokenApp: "bar", URL: server.URL, CoalesceGets: true})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	before := make(chan error, 1)
+	go func() {
+		_, err := apih.Get("/graph/1")
+		before <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// a GET after a PUT does not join the GET sent before it
+	put := make(chan error, 1)
+	go func() {
+		_, err := apih.Put("/graph/1", []byte(`{}`))
+		put <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	after := make(chan error, 1)
+	go func() {
+		_, err := apih.Get("/graph/1")
+		after <- err
+	}()
+
+	// call options are never coalesced
+	withOpts := make(chan error, 1)
+	go func() {
+		_, err := apih.Get("/graph/1", WithRetries(1))
+		withOpts <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for _, c := range []chan error{before, put, after, withOpts} {
+		if err := <-c; err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+
+	if n := requestCount(counts, "/graph/1"); n != 4 {
+		t.Fatalf("expected 4 requests, got %d", n)
+	}
+}
+
+func TestGetCoalescingDisabled(t *testing.T) {
+	release := make(chan struct{})
+	server, counts := slowServer(release)
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", TokenApp: "bar", URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := apih.Get("/broker/1"); err != nil {
+				t.Errorf("unexpected error (%s)", err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := requestCount(counts, "/broker/1"); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// conflictMergeAttempts is the number of times UpdateWithMerge merges with
+// the server object before giving up with a ConflictError
+const conflictMergeAttempts = 3
+
+// ConflictError is returned by updates, without updating, when the object was
+// modified on the server since it was fetched (its _last_modified differs).
+type ConflictError struct {
+	// Current is the object on the server (e.g. *Dashboard)
+	Current interface{}
+	// CID of the object
+	CID string
+	// Expected is the _last_modified of the object being updated
+	Expected uint
+	// LastModified is the _last_modified of the object on the server
+	LastModified uint
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflict updating %s, modified on the server (_last_modified %d, expected %d)", e.CID, e.LastModified, e.Expected)
+}
+
+// IsConflict reports whether err was caused by an update conflict
+func IsConflict(err error) bool {
+	var e *ConflictError
+	return errors.As(err, &e)
+}
+
+// MergeFunc resolves an update conflict, returning the object to update from
+// the object on the server (current) and the object which was to be updated
+// (desired). Returning an error aborts the update.
+type MergeFunc[T any] func(current, desired *T) (*T, error)
+
+// UpdateWithMerge updates cfg, an object of type T, if it was not modified on
+// the server since it was fetched. Otherwise merge is called with the server
+// object and the update retried with the object it returns, its _last_modified
+// set to the one of the server object. merge may be nil to fail with a
+// *ConflictError instead. Objects with a zero _last_modified (e.g. not
+// fetched from the API) are updated without checking.
+//
+//	dash, err := apiclient.UpdateWithMerge(ctx, client, dash, func(current, desired *apiclient.Dashboard) (*apiclient.Dashboard, error) {
+//		current.Widgets = append(current.Widgets, widget)
+//		return current, nil
+//	})
+func UpdateWithMerge[T any](ctx context.Context, a *API, cfg *T, merge MergeFunc[T], opts ...CallOption) (*T, error) {
+	r, err := lookupResource[T]()
+	if err != nil {
+		return nil, err
+	}
+	return r.UpdateWithMerge(ctx, a, cfg, merge, opts...)
+}
+
+// UpdateWithMerge updates an existing object, identified by its CID, if it was
+// not modified on the server since it was fetched (see UpdateWithMerge)
+func (r *Resource[T]) UpdateWithMerge(ctx context.Context, a *API, cfg *T, merge MergeFunc[T], opts ...CallOption) (*T, error) {
+	if cfg == nil {
+		return nil, errors.Errorf("invalid %s config (nil)", r.Name)
+	}
+	if r.LastModified == nil {
+		return nil, errors.Errorf("%s has no _last_modified, conflicts can not be detected", r.Name)
+	}
+
+	objCID, err := r.parseCID(r.CID(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.updateChecked(ctx, a, objCID, cfg, merge, opts...)
+}
+
+// updateChecked puts cfg to objCID if the _last_modified of the server object
+// matches the one of cfg, merging and retrying on mismatch if merge is not nil
+func (r *Resource[T]) updateChecked(ctx context.Context, a *API, objCID string, cfg *T, merge MergeFunc[T], opts ...CallOption) (*T, error) {
+	expected := r.LastModified(cfg)
+	if expected == 0 {
+		return r.put(ctx, a, objCID, cfg, opts...)
+	}
+
+	for attempt := 0; ; attempt++ {
+		// not cached or coalesced, the server object is needed
+		result, err := a.apiRequest(ContextWithCallOptions(ctx, opts...), "GET", objCID, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetching %s", r.Name)
+		}
+
+		current := new(T)
+		if err := r.decode(result, current, r.Name); err != nil {
+			return nil, err
+		}
+
+		lastModified := r.LastModified(current)
+		if lastModified == expected {
+			return r.put(ctx, a, objCID, cfg, opts...)
+		}
+
+		if merge == nil || attempt == conflictMergeAttempts {
+			return nil, &ConflictError{CID: objCID, Expected: expected, LastModified: lastModified, Current: current}
+		}
+
+		a.logDebug("update conflict, merging", "cid", objCID, "last_modified", lastModified, "expected", expected)
+
+		merged, err := merge(current, cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "merging %s", r.Name)
+		}
+		if merged == nil {
+			return nil, errors.Errorf("invalid %s config (nil)", r.Name)
+		}
+		// merged from desired, it would be put with the stale _last_modified
+		r.SetLastModified(merged, lastModified)
+		cfg, expected = merged, lastModified
+	}
+}
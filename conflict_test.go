@@ -0,0 +1,258 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// conflictServer serves a single dashboard, /dashboard/1234. Every PUT
+// increments its _last_modified, as do calls to modify (another client
+// updating it). putModified is the _last_modified sent by the last PUT.
+type conflictServer struct {
+	*httptest.Server
+	dash        Dashboard
+	puts        int
+	gets        int
+	putModified uint
+	mu          sync.Mutex
+}
+
+func newConflictServer() *conflictServer {
+	s := &conflictServer{dash: Dashboard{CID: "/dashboard/1234", Title: "foo", LastModified: 100}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if r.URL.Path != s.dash.CID {
+			w.WriteHeader(404)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			s.gets++
+		case "PUT":
+			s.puts++
+			body, _ := io.ReadAll(r.Body)
+			var dash Dashboard
+			_ = json.Unmarshal(body, &dash)
+			s.putModified = dash.LastModified
+			dash.LastModified = s.dash.LastModified + 1
+			s.dash = dash
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.dash)
+	}))
+	return s
+}
+
+func (s *conflictServer) modify(title string) {
+	s.mu.Lock()
+	s.dash.Title = title
+	s.dash.LastModified++
+	s.mu.Unlock()
+}
+
+func TestDetectConflicts(t *testing.T) {
+	server := newConflictServer()
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL, DetectConflicts: true})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	dash, err := apih.FetchDashboard(CIDType(&server.dash.CID))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	t.Run("unmodified", func(t *testing.T) {
+		dash.Title = "bar"
+		updated, err := apih.UpdateDashboard(dash)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if updated.Title != "bar" || updated.LastModified != 101 {
+			t.Fatalf("unexpected dashboard %#v", updated)
+		}
+		dash = updated
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		server.modify("baz")
+		puts := server.puts
+
+		dash.Title = "qux"
+		_, err := apih.UpdateDashboard(dash)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !IsConflict(err) {
+			t.Fatalf("expected conflict error, got (%s)", err)
+		}
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("expected *ConflictError, got %T", err)
+		}
+		if conflict.CID != "/dashboard/1234" || conflict.Expected != 101 || conflict.LastModified != 102 {
+			t.Fatalf("unexpected conflict %#v", conflict)
+		}
+		if current, ok := conflict.Current.(*Dashboard); !ok || current.Title != "baz" {
+			t.Fatalf("unexpected current %#v", conflict.Current)
+		}
+		if err.Error() != "conflict updating /dashboard/1234, modified on the server (_last_modified 102, expected 101)" {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if server.puts != puts {
+			t.Fatal("expected no update")
+		}
+	})
+
+	t.Run("not fetched", func(t *testing.T) {
+		updated, err := apih.UpdateDashboard(&Dashboard{CID: "/dashboard/1234", Title: "new"})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if updated.Title != "new" {
+			t.Fatalf("unexpected dashboard %#v", updated)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		gets := server.gets
+		if _, err := client.UpdateDashboard(&Dashboard{CID: "/dashboard/1234", Title: "stale", LastModified: 1}); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if server.gets != gets {
+			t.Fatal("expected no fetch")
+		}
+	})
+}
+
+func TestUpdateWithMerge(t *testing.T) {
+	server := newConflictServer()
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	ctx := context.Background()
+
+	dash, err := Fetch[Dashboard](ctx, apih, "/dashboard/1234")
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		server.modify("other")
+
+		dash.Title = "mine"
+		merges := 0
+		updated, err := UpdateWithMerge(ctx, apih, dash, func(current, desired *Dashboard) (*Dashboard, error) {
+			merges++
+			if current.Title != "other" || desired.Title != "mine" {
+				t.Fatalf("unexpected merge of %#v and %#v", current, desired)
+			}
+			current.Title = current.Title + "+" + desired.Title
+			return current, nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if merges != 1 {
+			t.Fatalf("expected 1 merge, got %d", merges)
+		}
+		if updated.Title != "other+mine" {
+			t.Fatalf("unexpected dashboard %#v", updated)
+		}
+		dash = updated
+	})
+
+	t.Run("merge into desired", func(t *testing.T) {
+		server.modify("other")
+		serverModified := dash.LastModified + 1
+
+		dash.Title = "mine"
+		updated, err := UpdateWithMerge(ctx, apih, dash, func(current, desired *Dashboard) (*Dashboard, error) {
+			desired.Title = current.Title + "+" + desired.Title
+			return desired, nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if server.putModified != serverModified {
+			t.Fatalf("expected the server _last_modified %d to be put, got %d", serverModified, server.putModified)
+		}
+		if updated.Title != "other+mine" {
+			t.Fatalf("unexpected dashboard %#v", updated)
+		}
+		dash = updated
+	})
+
+	t.Run("no merge", func(t *testing.T) {
+		server.modify("other")
+		if _, err := UpdateWithMerge[Dashboard](ctx, apih, dash, nil); !IsConflict(err) {
+			t.Fatalf("expected conflict error, got (%v)", err)
+		}
+	})
+
+	t.Run("merge attempts", func(t *testing.T) {
+		dash, err := dashboardResource.Fetch(ctx, apih, CIDType(&server.dash.CID))
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		server.modify("other")
+
+		merges := 0
+		_, err = dashboardResource.UpdateWithMerge(ctx, apih, dash, func(current, desired *Dashboard) (*Dashboard, error) {
+			merges++
+			server.modify("again") // modified again before the update
+			return current, nil
+		})
+		if !IsConflict(err) {
+			t.Fatalf("expected conflict error, got (%v)", err)
+		}
+		if merges != conflictMergeAttempts {
+			t.Fatalf("expected %d merges, got %d", conflictMergeAttempts, merges)
+		}
+	})
+
+	t.Run("merge error", func(t *testing.T) {
+		dash, err := Fetch[Dashboard](ctx, apih, "/dashboard/1234")
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		server.modify("other")
+
+		_, err = UpdateWithMerge(ctx, apih, dash, func(current, desired *Dashboard) (*Dashboard, error) {
+			return nil, errors.New("can not merge")
+		})
+		if err == nil || err.Error() != "merging dashboard: can not merge" {
+			t.Fatalf("unexpected error (%v)", err)
+		}
+	})
+
+	t.Run("no last modified", func(t *testing.T) {
+		if _, err := UpdateWithMerge(ctx, apih, &Graph{CID: "/graph/1"}, nil); err == nil || err.Error() != "graph has no _last_modified, conflicts can not be detected" {
+			t.Fatalf("unexpected error (%v)", err)
+		}
+	})
+}
@@ -8,11 +8,7 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -68,6 +64,18 @@ type ContactGroup struct {
 	AlwaysSendClear   bool                      `json:"always_send_clear,omitempty"`  // bool - new 2019-10-09
 }
 
+// contactGroupResource describes the contact group endpoint
+var contactGroupResource = RegisterResource(&Resource[ContactGroup]{
+	Name:            "contact group",
+	Plural:          "contact groups",
+	Prefix:          config.ContactGroupPrefix,
+	CIDRegex:        config.ContactGroupCIDRegex,
+	CID:             func(o *ContactGroup) string { return o.CID },
+	LastModified:    func(o *ContactGroup) uint { return o.LastModified },
+	SetLastModified: func(o *ContactGroup, lastModified uint) { o.LastModified = lastModified },
+	Tags:            func(o *ContactGroup) *[]string { return &o.Tags },
+})
+
 // NewContactGroup returns a ContactGroup (with defaults, if applicable)
 func NewContactGroup() *ContactGroup {
 	return &ContactGroup{
@@ -81,197 +89,139 @@ func NewContactGroup() *ContactGroup {
 }
 
 // FetchContactGroup retrieves contact group with passed cid.
-func (a *API) FetchContactGroup(cid CIDType) (*ContactGroup, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid contact group CID (none)")
-	}
-
-	var groupCID string
-	if !strings.HasPrefix(*cid, config.ContactGroupPrefix) {
-		groupCID = fmt.Sprintf("%s/%s", config.ContactGroupPrefix, *cid)
-	} else {
-		groupCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.ContactGroupCIDRegex, groupCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid contact group CID (%s)", groupCID)
-	}
-
-	result, err := a.Get(groupCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching contact group")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch contact group, received JSON: %s", string(result))
-	}
-
-	group := new(ContactGroup)
-	if err := json.Unmarshal(result, group); err != nil {
-		return nil, errors.Wrap(err, "parsing contact group")
-	}
+func (a *API) FetchContactGroup(cid CIDType, opts ...CallOption) (*ContactGroup, error) {
+	return a.FetchContactGroupWithContext(context.Background(), cid, opts...)
+}
 
-	return group, nil
+// FetchContactGroupWithContext is FetchContactGroup with a context for cancellation and deadlines.
+func (a *API) FetchContactGroupWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*ContactGroup, error) {
+	return contactGroupResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchContactGroups retrieves all contact groups available to the API Token.
-func (a *API) FetchContactGroups() (*[]ContactGroup, error) {
-	result, err := a.Get(config.ContactGroupPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching contact groups")
-	}
-
-	var groups []ContactGroup
-	if err := json.Unmarshal(result, &groups); err != nil {
-		return nil, errors.Wrap(err, "parsing contact groups")
-	}
+func (a *API) FetchContactGroups(opts ...CallOption) (*[]ContactGroup, error) {
+	return a.FetchContactGroupsWithContext(context.Background(), opts...)
+}
 
-	return &groups, nil
+// FetchContactGroupsWithContext is FetchContactGroups with a context for cancellation and deadlines.
+func (a *API) FetchContactGroupsWithContext(ctx context.Context, opts ...CallOption) (*[]ContactGroup, error) {
+	return contactGroupResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateContactGroup updates passed contact group.
-func (a *API) UpdateContactGroup(cfg *ContactGroup) (*ContactGroup, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid contact group config (nil)")
-	}
-
-	groupCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.ContactGroupCIDRegex, groupCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid contact group CID (%s)", groupCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update contact group, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) UpdateContactGroup(cfg *ContactGroup, opts ...CallOption) (*ContactGroup, error) {
+	return a.UpdateContactGroupWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Put(groupCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating contact group")
-	}
+// UpdateContactGroupWithContext is UpdateContactGroup with a context for cancellation and deadlines.
+func (a *API) UpdateContactGroupWithContext(ctx context.Context, cfg *ContactGroup, opts ...CallOption) (*ContactGroup, error) {
+	return contactGroupResource.Update(ctx, a, cfg, opts...)
+}
 
-	group := &ContactGroup{}
-	if err := json.Unmarshal(result, group); err != nil {
-		return nil, errors.Wrap(err, "parsing contact group")
-	}
+// PatchContactGroup applies patch (see Patcher) to the contact group with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchContactGroup(cid CIDType, patch Patcher, opts ...CallOption) (*ContactGroup, error) {
+	return a.PatchContactGroupWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return group, nil
+// PatchContactGroupWithContext is PatchContactGroup with a context for cancellation and deadlines.
+func (a *API) PatchContactGroupWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*ContactGroup, error) {
+	return contactGroupResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateContactGroup creates a new contact group.
-func (a *API) CreateContactGroup(cfg *ContactGroup) (*ContactGroup, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid contact group config (nil)")
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create contact group, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Post(config.ContactGroupPrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating contact group")
-	}
-
-	group := &ContactGroup{}
-	if err := json.Unmarshal(result, group); err != nil {
-		return nil, errors.Wrap(err, "parsing contact group")
-	}
+func (a *API) CreateContactGroup(cfg *ContactGroup, opts ...CallOption) (*ContactGroup, error) {
+	return a.CreateContactGroupWithContext(context.Background(), cfg, opts...)
+}
 
-	return group, nil
+// CreateContactGroupWithContext is CreateContactGroup with a context for cancellation and deadlines.
+func (a *API) CreateContactGroupWithContext(ctx context.Context, cfg *ContactGroup, opts ...CallOption) (*ContactGroup, error) {
+	return contactGroupResource.Create(ctx, a, cfg, opts...)
 }
 
 // DeleteContactGroup deletes passed contact group.
-func (a *API) DeleteContactGroup(cfg *ContactGroup) (bool, error) {
+func (a *API) DeleteContactGroup(cfg *ContactGroup, opts ...CallOption) (bool, error) {
+	return a.DeleteContactGroupWithContext(context.Background(), cfg, opts...)
+}
+
+// DeleteContactGroupWithContext is DeleteContactGroup with a context for cancellation and deadlines.
+func (a *API) DeleteContactGroupWithContext(ctx context.Context, cfg *ContactGroup, opts ...CallOption) (bool, error) {
 	if cfg == nil {
 		return false, errors.New("invalid contact group config (nil)")
 	}
-	return a.DeleteContactGroupByCID(CIDType(&cfg.CID))
+	return a.DeleteContactGroupByCIDWithContext(ctx, CIDType(&cfg.CID), opts...)
 }
 
 // DeleteContactGroupByCID deletes contact group with passed cid.
-func (a *API) DeleteContactGroupByCID(cid CIDType) (bool, error) {
-	if cid == nil || *cid == "" {
-		return false, errors.New("invalid contact group CID (none)")
-	}
-
-	var groupCID string
-	if !strings.HasPrefix(*cid, config.ContactGroupPrefix) {
-		groupCID = fmt.Sprintf("%s/%s", config.ContactGroupPrefix, *cid)
-	} else {
-		groupCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.ContactGroupCIDRegex, groupCID)
-	if err != nil {
-		return false, err
-	}
-	if !matched {
-		return false, errors.Errorf("invalid contact group CID (%s)", groupCID)
-	}
-
-	_, err = a.Delete(groupCID)
-	if err != nil {
-		return false, errors.Wrap(err, "deleting contact group")
-	}
+func (a *API) DeleteContactGroupByCID(cid CIDType, opts ...CallOption) (bool, error) {
+	return a.DeleteContactGroupByCIDWithContext(context.Background(), cid, opts...)
+}
 
-	return true, nil
+// DeleteContactGroupByCIDWithContext is DeleteContactGroupByCID with a context for cancellation and deadlines.
+func (a *API) DeleteContactGroupByCIDWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (bool, error) {
+	return contactGroupResource.Delete(ctx, a, cid, opts...)
 }
 
 // SearchContactGroups returns contact groups matching the specified
 // search query and/or filter. If nil is passed for both parameters
 // all contact groups will be returned.
-func (a *API) SearchContactGroups(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]ContactGroup, error) {
-	q := url.Values{}
+func (a *API) SearchContactGroups(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]ContactGroup, error) {
+	return a.SearchContactGroupsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
+// SearchContactGroupsWithContext is SearchContactGroups with a context for cancellation and deadlines.
+func (a *API) SearchContactGroupsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]ContactGroup, error) {
+	return contactGroupResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
+// IterateContactGroups calls fn for each contact group matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateContactGroups(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*ContactGroup) error) error {
+	return a.IterateContactGroupsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	if q.Encode() == "" {
-		return a.FetchContactGroups()
-	}
+// IterateContactGroupsWithContext is IterateContactGroups with a context for cancellation and deadlines.
+func (a *API) IterateContactGroupsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*ContactGroup) error) error {
+	return contactGroupResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	reqURL := url.URL{
-		Path:     config.ContactGroupPrefix,
-		RawQuery: q.Encode(),
-	}
+// BulkCreateContactGroups creates contact groups concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateContactGroups(cfgs []*ContactGroup, opts *BulkOptions) BulkResults[*ContactGroup] {
+	return a.BulkCreateContactGroupsWithContext(context.Background(), cfgs, opts)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching contact groups")
-	}
+// BulkCreateContactGroupsWithContext is BulkCreateContactGroups with a context for cancellation and deadlines.
+func (a *API) BulkCreateContactGroupsWithContext(ctx context.Context, cfgs []*ContactGroup, opts *BulkOptions) BulkResults[*ContactGroup] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *ContactGroup) (*ContactGroup, error) {
+		return a.CreateContactGroupWithContext(ctx, cfg)
+	})
+}
 
-	var groups []ContactGroup
-	if err := json.Unmarshal(result, &groups); err != nil {
-		return nil, errors.Wrap(err, "parsing contact groups")
-	}
+// BulkUpdateContactGroups updates contact groups concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateContactGroups(cfgs []*ContactGroup, opts *BulkOptions) BulkResults[*ContactGroup] {
+	return a.BulkUpdateContactGroupsWithContext(context.Background(), cfgs, opts)
+}
+
+// BulkUpdateContactGroupsWithContext is BulkUpdateContactGroups with a context for cancellation and deadlines.
+func (a *API) BulkUpdateContactGroupsWithContext(ctx context.Context, cfgs []*ContactGroup, opts *BulkOptions) BulkResults[*ContactGroup] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *ContactGroup) (*ContactGroup, error) {
+		return a.UpdateContactGroupWithContext(ctx, cfg)
+	})
+}
+
+// BulkDeleteContactGroups deletes contact groups by cid concurrently (see BulkOptions),
+// the results are in the same order as cids.
+func (a *API) BulkDeleteContactGroups(cids []string, opts *BulkOptions) BulkResults[bool] {
+	return a.BulkDeleteContactGroupsWithContext(context.Background(), cids, opts)
+}
 
-	return &groups, nil
+// BulkDeleteContactGroupsWithContext is BulkDeleteContactGroups with a context for cancellation and deadlines.
+func (a *API) BulkDeleteContactGroupsWithContext(ctx context.Context, cids []string, opts *BulkOptions) BulkResults[bool] {
+	return Bulk(ctx, cids, opts, func(ctx context.Context, cid string) (bool, error) {
+		return a.DeleteContactGroupByCIDWithContext(ctx, CIDType(&cid))
+	})
 }
@@ -8,11 +8,7 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -225,203 +221,156 @@ type Dashboard struct {
 	Shared       bool                `json:"shared"`
 }
 
+// dashboardResource describes the dashboard endpoint
+var dashboardResource = RegisterResource(&Resource[Dashboard]{
+	Name:            "dashboard",
+	Plural:          "dashboards",
+	Prefix:          config.DashboardPrefix,
+	CIDRegex:        config.DashboardCIDRegex,
+	CID:             func(o *Dashboard) string { return o.CID },
+	LastModified:    func(o *Dashboard) uint { return o.LastModified },
+	SetLastModified: func(o *Dashboard, lastModified uint) { o.LastModified = lastModified },
+})
+
 // NewDashboard returns a new Dashboard (with defaults, if applicable)
 func NewDashboard() *Dashboard {
 	return &Dashboard{}
 }
 
 // FetchDashboard retrieves dashboard with passed cid.
-func (a *API) FetchDashboard(cid CIDType) (*Dashboard, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid dashboard CID (none)")
-	}
-
-	var dashboardCID string
-	if !strings.HasPrefix(*cid, config.DashboardPrefix) {
-		dashboardCID = fmt.Sprintf("%s/%s", config.DashboardPrefix, *cid)
-	} else {
-		dashboardCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.DashboardCIDRegex, dashboardCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid dashboard CID (%s)", dashboardCID)
-	}
-
-	result, err := a.Get(dashboardCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching dashobard")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch dashboard, received JSON: %s", string(result))
-	}
-
-	dashboard := new(Dashboard)
-	if err := json.Unmarshal(result, dashboard); err != nil {
-		return nil, errors.Wrap(err, "parsing dashboard")
-	}
+func (a *API) FetchDashboard(cid CIDType, opts ...CallOption) (*Dashboard, error) {
+	return a.FetchDashboardWithContext(context.Background(), cid, opts...)
+}
 
-	return dashboard, nil
+// FetchDashboardWithContext is FetchDashboard with a context for cancellation and deadlines.
+func (a *API) FetchDashboardWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*Dashboard, error) {
+	return dashboardResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchDashboards retrieves all dashboards available to the API Token.
-func (a *API) FetchDashboards() (*[]Dashboard, error) {
-	result, err := a.Get(config.DashboardPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching dashboards")
-	}
-
-	var dashboards []Dashboard
-	if err := json.Unmarshal(result, &dashboards); err != nil {
-		return nil, errors.Wrap(err, "parsing dashboards")
-	}
+func (a *API) FetchDashboards(opts ...CallOption) (*[]Dashboard, error) {
+	return a.FetchDashboardsWithContext(context.Background(), opts...)
+}
 
-	return &dashboards, nil
+// FetchDashboardsWithContext is FetchDashboards with a context for cancellation and deadlines.
+func (a *API) FetchDashboardsWithContext(ctx context.Context, opts ...CallOption) (*[]Dashboard, error) {
+	return dashboardResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateDashboard updates passed dashboard.
-func (a *API) UpdateDashboard(cfg *Dashboard) (*Dashboard, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid dashboard config (nil)")
-	}
-
-	dashboardCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.DashboardCIDRegex, dashboardCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid dashboard CID (%s)", dashboardCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update dashboard, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) UpdateDashboard(cfg *Dashboard, opts ...CallOption) (*Dashboard, error) {
+	return a.UpdateDashboardWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Put(dashboardCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating dashobard")
-	}
+// UpdateDashboardWithContext is UpdateDashboard with a context for cancellation and deadlines.
+func (a *API) UpdateDashboardWithContext(ctx context.Context, cfg *Dashboard, opts ...CallOption) (*Dashboard, error) {
+	return dashboardResource.Update(ctx, a, cfg, opts...)
+}
 
-	dashboard := &Dashboard{}
-	if err := json.Unmarshal(result, dashboard); err != nil {
-		return nil, errors.Wrap(err, "parsing dashboard")
-	}
+// PatchDashboard applies patch (see Patcher) to the dashboard with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchDashboard(cid CIDType, patch Patcher, opts ...CallOption) (*Dashboard, error) {
+	return a.PatchDashboardWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return dashboard, nil
+// PatchDashboardWithContext is PatchDashboard with a context for cancellation and deadlines.
+func (a *API) PatchDashboardWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*Dashboard, error) {
+	return dashboardResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateDashboard creates a new dashboard.
-func (a *API) CreateDashboard(cfg *Dashboard) (*Dashboard, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid dashboard config (nil)")
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create dashboard, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Post(config.DashboardPrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating dashboard")
-	}
-
-	dashboard := &Dashboard{}
-	if err := json.Unmarshal(result, dashboard); err != nil {
-		return nil, errors.Wrap(err, "parsing dashboard")
-	}
+func (a *API) CreateDashboard(cfg *Dashboard, opts ...CallOption) (*Dashboard, error) {
+	return a.CreateDashboardWithContext(context.Background(), cfg, opts...)
+}
 
-	return dashboard, nil
+// CreateDashboardWithContext is CreateDashboard with a context for cancellation and deadlines.
+func (a *API) CreateDashboardWithContext(ctx context.Context, cfg *Dashboard, opts ...CallOption) (*Dashboard, error) {
+	return dashboardResource.Create(ctx, a, cfg, opts...)
 }
 
 // DeleteDashboard deletes passed dashboard.
-func (a *API) DeleteDashboard(cfg *Dashboard) (bool, error) {
+func (a *API) DeleteDashboard(cfg *Dashboard, opts ...CallOption) (bool, error) {
+	return a.DeleteDashboardWithContext(context.Background(), cfg, opts...)
+}
+
+// DeleteDashboardWithContext is DeleteDashboard with a context for cancellation and deadlines.
+func (a *API) DeleteDashboardWithContext(ctx context.Context, cfg *Dashboard, opts ...CallOption) (bool, error) {
 	if cfg == nil {
 		return false, errors.New("invalid dashboard config (nil)")
 	}
-	return a.DeleteDashboardByCID(CIDType(&cfg.CID))
+	return a.DeleteDashboardByCIDWithContext(ctx, CIDType(&cfg.CID), opts...)
 }
 
 // DeleteDashboardByCID deletes dashboard with passed cid.
-func (a *API) DeleteDashboardByCID(cid CIDType) (bool, error) {
-	if cid == nil || *cid == "" {
-		return false, errors.New("invalid dashboard CID (none)")
-	}
-
-	var dashboardCID string
-	if !strings.HasPrefix(*cid, config.DashboardPrefix) {
-		dashboardCID = fmt.Sprintf("%s/%s", config.DashboardPrefix, *cid)
-	} else {
-		dashboardCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.DashboardCIDRegex, dashboardCID)
-	if err != nil {
-		return false, err
-	}
-	if !matched {
-		return false, errors.Errorf("invalid dashboard CID (%s)", dashboardCID)
-	}
-
-	_, err = a.Delete(dashboardCID)
-	if err != nil {
-		return false, errors.Wrap(err, "deleting dashboard")
-	}
+func (a *API) DeleteDashboardByCID(cid CIDType, opts ...CallOption) (bool, error) {
+	return a.DeleteDashboardByCIDWithContext(context.Background(), cid, opts...)
+}
 
-	return true, nil
+// DeleteDashboardByCIDWithContext is DeleteDashboardByCID with a context for cancellation and deadlines.
+func (a *API) DeleteDashboardByCIDWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (bool, error) {
+	return dashboardResource.Delete(ctx, a, cid, opts...)
 }
 
 // SearchDashboards returns dashboards matching the specified
 // search query and/or filter. If nil is passed for both parameters
 // all dashboards will be returned.
-func (a *API) SearchDashboards(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]Dashboard, error) {
-	q := url.Values{}
+func (a *API) SearchDashboards(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Dashboard, error) {
+	return a.SearchDashboardsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
+// SearchDashboardsWithContext is SearchDashboards with a context for cancellation and deadlines.
+func (a *API) SearchDashboardsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Dashboard, error) {
+	return dashboardResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
+// IterateDashboards calls fn for each dashboard matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateDashboards(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Dashboard) error) error {
+	return a.IterateDashboardsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	if q.Encode() == "" {
-		return a.FetchDashboards()
-	}
+// IterateDashboardsWithContext is IterateDashboards with a context for cancellation and deadlines.
+func (a *API) IterateDashboardsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Dashboard) error) error {
+	return dashboardResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	reqURL := url.URL{
-		Path:     config.DashboardPrefix,
-		RawQuery: q.Encode(),
-	}
+// BulkCreateDashboards creates dashboards concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateDashboards(cfgs []*Dashboard, opts *BulkOptions) BulkResults[*Dashboard] {
+	return a.BulkCreateDashboardsWithContext(context.Background(), cfgs, opts)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching dashboards")
-	}
+// BulkCreateDashboardsWithContext is BulkCreateDashboards with a context for cancellation and deadlines.
+func (a *API) BulkCreateDashboardsWithContext(ctx context.Context, cfgs []*Dashboard, opts *BulkOptions) BulkResults[*Dashboard] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Dashboard) (*Dashboard, error) {
+		return a.CreateDashboardWithContext(ctx, cfg)
+	})
+}
 
-	var dashboards []Dashboard
-	if err := json.Unmarshal(result, &dashboards); err != nil {
-		return nil, errors.Wrap(err, "parsing dashobards")
-	}
+// BulkUpdateDashboards updates dashboards concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateDashboards(cfgs []*Dashboard, opts *BulkOptions) BulkResults[*Dashboard] {
+	return a.BulkUpdateDashboardsWithContext(context.Background(), cfgs, opts)
+}
+
+// BulkUpdateDashboardsWithContext is BulkUpdateDashboards with a context for cancellation and deadlines.
+func (a *API) BulkUpdateDashboardsWithContext(ctx context.Context, cfgs []*Dashboard, opts *BulkOptions) BulkResults[*Dashboard] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Dashboard) (*Dashboard, error) {
+		return a.UpdateDashboardWithContext(ctx, cfg)
+	})
+}
+
+// BulkDeleteDashboards deletes dashboards by cid concurrently (see BulkOptions),
+// the results are in the same order as cids.
+func (a *API) BulkDeleteDashboards(cids []string, opts *BulkOptions) BulkResults[bool] {
+	return a.BulkDeleteDashboardsWithContext(context.Background(), cids, opts)
+}
 
-	return &dashboards, nil
+// BulkDeleteDashboardsWithContext is BulkDeleteDashboards with a context for cancellation and deadlines.
+func (a *API) BulkDeleteDashboardsWithContext(ctx context.Context, cids []string, opts *BulkOptions) BulkResults[bool] {
+	return Bulk(ctx, cids, opts, func(ctx context.Context, cid string) (bool, error) {
+		return a.DeleteDashboardByCIDWithContext(ctx, CIDType(&cid))
+	})
 }
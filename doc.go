@@ -59,5 +59,8 @@ Verbs
 	                                       any applicable defaults defined)
 
 	Not all endpoints support all verbs.
+
+	Every method also has a WithContext variant (e.g. FetchAnnotationWithContext)
+	accepting a context.Context used to cancel the request and any retries.
 */
 package apiclient
@@ -0,0 +1,98 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DryRunCIDPrefix prefixes the id of placeholder CIDs returned by Create* in
+// dry run mode, e.g. /check_bundle/dryrun-1
+const DryRunCIDPrefix = "dryrun-"
+
+// Change is a mutation captured in dry run mode (see Config.DryRun)
+type Change struct {
+	Time   time.Time
+	Method string
+	Path   string
+	// CID of the object, the placeholder CID for creates
+	CID  string
+	Body json.RawMessage
+}
+
+func (c Change) String() string {
+	if len(c.Body) == 0 {
+		return fmt.Sprintf("%s %s", c.Method, c.Path)
+	}
+	return fmt.Sprintf("%s %s %s", c.Method, c.Path, c.Body)
+}
+
+// IsDryRunCID reports whether cid is a placeholder returned in dry run mode
+func IsDryRunCID(cid string) bool {
+	i := strings.LastIndex(cid, "/")
+	return strings.HasPrefix(cid[i+1:], DryRunCIDPrefix)
+}
+
+// DryRunChanges returns the changes captured in dry run mode, in order
+func (a *API) DryRunChanges() []Change {
+	a.dryRunmu.Lock()
+	defer a.dryRunmu.Unlock()
+	return append([]Change(nil), a.dryRunChanges...)
+}
+
+// ResetDryRunChanges clears the captured changes
+func (a *API) ResetDryRunChanges() {
+	a.dryRunmu.Lock()
+	defer a.dryRunmu.Unlock()
+	a.dryRunChanges = nil
+}
+
+// dryRunRequest captures a Post, Put or Delete instead of sending it and
+// returns a synthesized response: the posted object with a placeholder CID,
+// the updated object, or nothing for deletes.
+func (a *API) dryRunRequest(reqMethod, reqPath string, data []byte) ([]byte, error) {
+	a.dryRunmu.Lock()
+	defer a.dryRunmu.Unlock()
+
+	change := Change{
+		Time:   time.Now(),
+		Method: reqMethod,
+		Path:   reqPath,
+		CID:    strings.SplitN(reqPath, "?", 2)[0],
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		change.Body = append(json.RawMessage(nil), data...)
+	}
+
+	var result []byte
+	if reqMethod != "DELETE" && len(change.Body) > 0 {
+		var obj map[string]interface{}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, errors.Wrap(err, "dry run, parsing request")
+		}
+		if reqMethod == "POST" {
+			a.dryRunCIDs++
+			change.CID = fmt.Sprintf("%s/%s%d", change.CID, DryRunCIDPrefix, a.dryRunCIDs)
+		}
+		obj["_cid"] = change.CID
+
+		var err error
+		result, err = json.Marshal(obj)
+		if err != nil {
+			return nil, errors.Wrap(err, "dry run, encoding response")
+		}
+	}
+
+	a.dryRunChanges = append(a.dryRunChanges, change)
+	a.logDebug("dry run, request not sent", "method", reqMethod, "path", reqPath)
+
+	return result, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	var gets, mutations int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			atomic.AddInt32(&mutations, 1)
+			w.WriteHeader(500)
+			return
+		}
+		atomic.AddInt32(&gets, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"_cid":"%s","display_name":"existing"}`, r.URL.Path)
+	}))
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", TokenApp: "bar", URL: server.URL, DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	cfg := NewCheckBundle()
+	cfg.DisplayName = "new check"
+	cfg.Target = "web01"
+	created, err := apih.CreateCheckBundle(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if created.CID != "/check_bundle/dryrun-1" || !IsDryRunCID(created.CID) {
+		t.Fatalf("unexpected placeholder cid (%s)", created.CID)
+	}
+	if created.DisplayName != "new check" || created.Target != "web01" {
+		t.Fatalf("unexpected created bundle %#v", created)
+	}
+
+	cid := "/check_bundle/1234"
+	existing, err := apih.FetchCheckBundle(CIDType(&cid))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if existing.DisplayName != "existing" || IsDryRunCID(existing.CID) {
+		t.Fatalf("expected fetch to pass through, got %#v", existing)
+	}
+
+	existing.DisplayName = "renamed"
+	updated, err := apih.UpdateCheckBundle(existing)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if updated.CID != cid || updated.DisplayName != "renamed" {
+		t.Fatalf("unexpected updated bundle %#v", updated)
+	}
+
+	if ok, err := apih.DeleteCheckBundleByCID(CIDType(&cid)); err != nil || !ok {
+		t.Fatalf("unexpected delete result %v (%v)", ok, err)
+	}
+
+	if n := atomic.LoadInt32(&mutations); n != 0 {
+		t.Fatalf("expected no mutations sent, got %d", n)
+	}
+	if n := atomic.LoadInt32(&gets); n != 1 {
+		t.Fatalf("expected 1 get, got %d", n)
+	}
+
+	changes := apih.DryRunChanges()
+	expected := []struct{ method, path, cid string }{
+		{"POST", "/check_bundle", "/check_bundle/dryrun-1"},
+		{"PUT", cid, cid},
+		{"DELETE", cid, cid},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %v", len(expected), changes)
+	}
+	for i, e := range expected {
+		c := changes[i]
+		if c.Method != e.method || c.Path != e.path || c.CID != e.cid {
+			t.Fatalf("unexpected change %d (%s) cid (%s)", i, c, c.CID)
+		}
+	}
+	if len(changes[0].Body) == 0 || len(changes[2].Body) != 0 {
+		t.Fatalf("unexpected change bodies (%s) (%s)", changes[0].Body, changes[2].Body)
+	}
+	if s := changes[2].String(); s != "DELETE "+cid {
+		t.Fatalf("unexpected change string (%s)", s)
+	}
+
+	apih.ResetDryRunChanges()
+	if n := len(apih.DryRunChanges()); n != 0 {
+		t.Fatalf("expected no changes after reset, got %d", n)
+	}
+}
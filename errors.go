@@ -0,0 +1,112 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// APIError is returned (wrapped) for any request the Circonus API responded to
+// with a non-2xx status. Use errors.As to retrieve it, or one of the Is* helpers.
+type APIError struct {
+	// Method is the HTTP method of the request (GET, PUT, POST, DELETE)
+	Method string `json:"-"`
+	// Path is the API path of the request (e.g. /check_bundle/1234)
+	Path string `json:"-"`
+	// Body is the raw response body
+	Body string `json:"-"`
+	// Code is the Circonus error code (e.g. Forbidden.BadToken)
+	Code string `json:"code"`
+	// Message is the Circonus error message
+	Message string `json:"message"`
+	// Explanation is the Circonus explanation of the error
+	Explanation string `json:"explanation"`
+	// Reference is the Circonus reference id for the error
+	Reference string `json:"reference"`
+	// StatusCode is the HTTP response status code
+	StatusCode int `json:"-"`
+	// Retries is the number of times the request was retried before giving up
+	Retries int `json:"-"`
+	// header is the response header, for Retry-After
+	header http.Header
+}
+
+// newAPIError builds an APIError, parsing the Circonus error details out of
+// the response body when it is JSON.
+func newAPIError(method, path string, statusCode int, body []byte) *APIError {
+	e := &APIError{}
+	if len(body) > 0 {
+		_ = json.Unmarshal(body, e) // not all error responses are json
+	}
+	e.Method = method
+	e.Path = path
+	e.StatusCode = statusCode
+	e.Body = strings.TrimSpace(string(body))
+	return e
+}
+
+// Error returns the error string, the format is compatible with previous
+// versions: "API response code <status>: <body>".
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API response code %d: %s", e.StatusCode, e.Body)
+}
+
+// AsAPIError returns the APIError in err's chain, if there is one.
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+func hasStatus(err error, codes ...int) bool {
+	apiErr, ok := AsAPIError(err)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBadRequest reports whether err is an API 400 response.
+func IsBadRequest(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
+
+// IsUnauthorized reports whether err is an API 401 response.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden reports whether err is an API 403 response (e.g. bad token or app).
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsNotFound reports whether err is an API 404 response.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsRateLimited reports whether err is an API 429 response.
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+// IsServerError reports whether err is an API 5xx response.
+func IsServerError(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.StatusCode >= 500
+}
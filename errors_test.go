@@ -0,0 +1,129 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func errorServer() *httptest.Server {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bad_token":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(403)
+			fmt.Fprintln(w, `{"reference":"abc123","explanation":"The authentication token you supplied is invalid","server":"foo","tag":"bar","message":"The password doesn't match the right format.","code":"Forbidden.BadToken"}`)
+		case "/bad_request":
+			w.WriteHeader(400)
+			fmt.Fprintln(w, "bad request")
+		case "/rate_limit":
+			w.WriteHeader(429)
+			fmt.Fprintln(w, "rate limit")
+		case "/server_error":
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "server error")
+		default:
+			w.WriteHeader(404)
+			fmt.Fprintf(w, "not found: %s %s\n", r.Method, r.URL.Path)
+		}
+	}
+
+	return httptest.NewServer(http.HandlerFunc(f))
+}
+
+func TestAPIError(t *testing.T) {
+	server := errorServer()
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{
+		TokenKey:      "foo",
+		TokenApp:      "bar",
+		URL:           server.URL,
+		MaxRetries:    2,
+		MinRetryDelay: "1ms",
+		MaxRetryDelay: "2ms",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	tests := []struct {
+		check         func(error) bool
+		id            string
+		path          string
+		code          string
+		statusCode    int
+		retries       int
+		exponentialBO bool
+	}{
+		{id: "bad request", path: "/bad_request", statusCode: 400, check: IsBadRequest},
+		{id: "forbidden", path: "/bad_token", statusCode: 403, code: "Forbidden.BadToken", check: IsForbidden},
+		{id: "not found", path: "/check_bundle/1234", statusCode: 404, check: IsNotFound},
+		{id: "rate limited", path: "/rate_limit", statusCode: 429, retries: 2, check: IsRateLimited},
+		{id: "server error", path: "/server_error", statusCode: 500, retries: 2, check: IsServerError},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			_, err := apih.Get(test.path)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+
+			wrapped := pkgerrors.Wrap(err, "fetching thing")
+
+			var apiErr *APIError
+			if !errors.As(wrapped, &apiErr) {
+				t.Fatalf("expected *APIError, got %T (%s)", err, err)
+			}
+			if apiErr.StatusCode != test.statusCode {
+				t.Fatalf("expected status %d, got %d", test.statusCode, apiErr.StatusCode)
+			}
+			if apiErr.Method != "GET" {
+				t.Fatalf("expected method GET, got %s", apiErr.Method)
+			}
+			if apiErr.Path != test.path {
+				t.Fatalf("expected path %s, got %s", test.path, apiErr.Path)
+			}
+			if apiErr.Code != test.code {
+				t.Fatalf("expected code %q, got %q", test.code, apiErr.Code)
+			}
+			if apiErr.Retries != test.retries {
+				t.Fatalf("expected %d retries, got %d", test.retries, apiErr.Retries)
+			}
+			if !test.check(wrapped) {
+				t.Fatalf("expected helper to match (%s)", wrapped)
+			}
+		})
+	}
+
+	t.Run("not an api error", func(t *testing.T) {
+		err := errors.New("foo")
+		if IsNotFound(err) || IsForbidden(err) || IsRateLimited(err) || IsServerError(err) {
+			t.Fatal("expected no match")
+		}
+		if _, ok := AsAPIError(nil); ok {
+			t.Fatal("expected no match for nil")
+		}
+	})
+}
+
+func TestAPIErrorString(t *testing.T) {
+	e := newAPIError("GET", "/user/current", 403, []byte(`{"code":"Forbidden.BadApp","message":"App 'foobar' not allowed","explanation":"There is a problem","reference":"abc123"}`+"\n"))
+	expected := `API response code 403: {"code":"Forbidden.BadApp","message":"App 'foobar' not allowed","explanation":"There is a problem","reference":"abc123"}`
+	if e.Error() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, e.Error())
+	}
+	if e.Code != "Forbidden.BadApp" || e.Message != "App 'foobar' not allowed" || e.Explanation != "There is a problem" || e.Reference != "abc123" {
+		t.Fatalf("unexpected parsed body %#v", e)
+	}
+}
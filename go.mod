@@ -1,6 +1,6 @@
 module github.com/circonus-labs/go-apiclient
 
-go 1.17
+go 1.18
 
 require (
 	github.com/hashicorp/go-retryablehttp v0.7.5
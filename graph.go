@@ -8,11 +8,7 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -167,206 +163,155 @@ type Graph struct {
 	MetricClusters []GraphMetricCluster        `json:"metric_clusters"`     // [] len >= 0
 }
 
+// graphResource describes the graph endpoint
+var graphResource = RegisterResource(&Resource[Graph]{
+	Name:     "graph",
+	Plural:   "graphs",
+	Prefix:   config.GraphPrefix,
+	CIDRegex: config.GraphCIDRegex,
+	CID:      func(o *Graph) string { return o.CID },
+	Tags:     func(o *Graph) *[]string { return &o.Tags },
+})
+
 // NewGraph returns a Graph (with defaults, if applicable)
 func NewGraph() *Graph {
 	return &Graph{}
 }
 
 // FetchGraph retrieves graph with passed cid.
-func (a *API) FetchGraph(cid CIDType) (*Graph, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid graph CID (none)")
-	}
-
-	var graphCID string
-	if !strings.HasPrefix(*cid, config.GraphPrefix) {
-		graphCID = fmt.Sprintf("%s/%s", config.GraphPrefix, *cid)
-	} else {
-		graphCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.GraphCIDRegex, graphCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid graph CID (%s)", graphCID)
-	}
-
-	result, err := a.Get(graphCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching graph")
-	}
-	if a.Debug {
-		a.Log.Printf("fetch graph, received JSON: %s", string(result))
-	}
-
-	graph := new(Graph)
-	if err := json.Unmarshal(result, graph); err != nil {
-		return nil, errors.Wrap(err, "parsing graph")
-	}
+func (a *API) FetchGraph(cid CIDType, opts ...CallOption) (*Graph, error) {
+	return a.FetchGraphWithContext(context.Background(), cid, opts...)
+}
 
-	return graph, nil
+// FetchGraphWithContext is FetchGraph with a context for cancellation and deadlines.
+func (a *API) FetchGraphWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*Graph, error) {
+	return graphResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchGraphs retrieves all graphs available to the API Token.
-func (a *API) FetchGraphs() (*[]Graph, error) {
-	result, err := a.Get(config.GraphPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching graphs")
-	}
-
-	var graphs []Graph
-	if err := json.Unmarshal(result, &graphs); err != nil {
-		return nil, errors.Wrap(err, "parsing graphs")
-	}
+func (a *API) FetchGraphs(opts ...CallOption) (*[]Graph, error) {
+	return a.FetchGraphsWithContext(context.Background(), opts...)
+}
 
-	return &graphs, nil
+// FetchGraphsWithContext is FetchGraphs with a context for cancellation and deadlines.
+func (a *API) FetchGraphsWithContext(ctx context.Context, opts ...CallOption) (*[]Graph, error) {
+	return graphResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateGraph updates passed graph.
-func (a *API) UpdateGraph(cfg *Graph) (*Graph, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid graph config (nil)")
-	}
-
-	graphCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.GraphCIDRegex, graphCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid graph CID (%s)", graphCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update graph, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) UpdateGraph(cfg *Graph, opts ...CallOption) (*Graph, error) {
+	return a.UpdateGraphWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Put(graphCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating graph")
-	}
+// UpdateGraphWithContext is UpdateGraph with a context for cancellation and deadlines.
+func (a *API) UpdateGraphWithContext(ctx context.Context, cfg *Graph, opts ...CallOption) (*Graph, error) {
+	return graphResource.Update(ctx, a, cfg, opts...)
+}
 
-	graph := &Graph{}
-	if err := json.Unmarshal(result, graph); err != nil {
-		return nil, errors.Wrap(err, "parsing graph")
-	}
+// PatchGraph applies patch (see Patcher) to the graph with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchGraph(cid CIDType, patch Patcher, opts ...CallOption) (*Graph, error) {
+	return a.PatchGraphWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return graph, nil
+// PatchGraphWithContext is PatchGraph with a context for cancellation and deadlines.
+func (a *API) PatchGraphWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*Graph, error) {
+	return graphResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateGraph creates a new graph.
-func (a *API) CreateGraph(cfg *Graph) (*Graph, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid graph config (nil)")
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create graph, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Post(config.GraphPrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating graph")
-	}
-
-	if a.Debug {
-		a.Log.Printf("create graph, received JSON: %s", string(result))
-	}
-
-	graph := &Graph{}
-	if err := json.Unmarshal(result, graph); err != nil {
-		return nil, errors.Wrap(err, "parsing graph")
-	}
+func (a *API) CreateGraph(cfg *Graph, opts ...CallOption) (*Graph, error) {
+	return a.CreateGraphWithContext(context.Background(), cfg, opts...)
+}
 
-	return graph, nil
+// CreateGraphWithContext is CreateGraph with a context for cancellation and deadlines.
+func (a *API) CreateGraphWithContext(ctx context.Context, cfg *Graph, opts ...CallOption) (*Graph, error) {
+	return graphResource.Create(ctx, a, cfg, opts...)
 }
 
 // DeleteGraph deletes passed graph.
-func (a *API) DeleteGraph(cfg *Graph) (bool, error) {
+func (a *API) DeleteGraph(cfg *Graph, opts ...CallOption) (bool, error) {
+	return a.DeleteGraphWithContext(context.Background(), cfg, opts...)
+}
+
+// DeleteGraphWithContext is DeleteGraph with a context for cancellation and deadlines.
+func (a *API) DeleteGraphWithContext(ctx context.Context, cfg *Graph, opts ...CallOption) (bool, error) {
 	if cfg == nil {
 		return false, errors.New("invalid graph config (nil)")
 	}
-	return a.DeleteGraphByCID(CIDType(&cfg.CID))
+	return a.DeleteGraphByCIDWithContext(ctx, CIDType(&cfg.CID), opts...)
 }
 
 // DeleteGraphByCID deletes graph with passed cid.
-func (a *API) DeleteGraphByCID(cid CIDType) (bool, error) {
-	if cid == nil || *cid == "" {
-		return false, errors.New("invalid graph CID (none)")
-	}
-
-	var graphCID string
-	if !strings.HasPrefix(*cid, config.GraphPrefix) {
-		graphCID = fmt.Sprintf("%s/%s", config.GraphPrefix, *cid)
-	} else {
-		graphCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.GraphCIDRegex, graphCID)
-	if err != nil {
-		return false, err
-	}
-	if !matched {
-		return false, errors.Errorf("invalid graph CID (%s)", graphCID)
-	}
-
-	_, err = a.Delete(graphCID)
-	if err != nil {
-		return false, errors.Wrap(err, "deleting graph")
-	}
+func (a *API) DeleteGraphByCID(cid CIDType, opts ...CallOption) (bool, error) {
+	return a.DeleteGraphByCIDWithContext(context.Background(), cid, opts...)
+}
 
-	return true, nil
+// DeleteGraphByCIDWithContext is DeleteGraphByCID with a context for cancellation and deadlines.
+func (a *API) DeleteGraphByCIDWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (bool, error) {
+	return graphResource.Delete(ctx, a, cid, opts...)
 }
 
 // SearchGraphs returns graphs matching the specified search query
 // and/or filter. If nil is passed for both parameters all graphs
 // will be returned.
-func (a *API) SearchGraphs(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]Graph, error) {
-	q := url.Values{}
+func (a *API) SearchGraphs(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Graph, error) {
+	return a.SearchGraphsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
+// SearchGraphsWithContext is SearchGraphs with a context for cancellation and deadlines.
+func (a *API) SearchGraphsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Graph, error) {
+	return graphResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
+// IterateGraphs calls fn for each graph matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateGraphs(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Graph) error) error {
+	return a.IterateGraphsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	if q.Encode() == "" {
-		return a.FetchGraphs()
-	}
+// IterateGraphsWithContext is IterateGraphs with a context for cancellation and deadlines.
+func (a *API) IterateGraphsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Graph) error) error {
+	return graphResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	reqURL := url.URL{
-		Path:     config.GraphPrefix,
-		RawQuery: q.Encode(),
-	}
+// BulkCreateGraphs creates graphs concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateGraphs(cfgs []*Graph, opts *BulkOptions) BulkResults[*Graph] {
+	return a.BulkCreateGraphsWithContext(context.Background(), cfgs, opts)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching graphs")
-	}
+// BulkCreateGraphsWithContext is BulkCreateGraphs with a context for cancellation and deadlines.
+func (a *API) BulkCreateGraphsWithContext(ctx context.Context, cfgs []*Graph, opts *BulkOptions) BulkResults[*Graph] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Graph) (*Graph, error) {
+		return a.CreateGraphWithContext(ctx, cfg)
+	})
+}
 
-	var graphs []Graph
-	if err := json.Unmarshal(result, &graphs); err != nil {
-		return nil, errors.Wrap(err, "parsing graphs")
-	}
+// BulkUpdateGraphs updates graphs concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateGraphs(cfgs []*Graph, opts *BulkOptions) BulkResults[*Graph] {
+	return a.BulkUpdateGraphsWithContext(context.Background(), cfgs, opts)
+}
+
+// BulkUpdateGraphsWithContext is BulkUpdateGraphs with a context for cancellation and deadlines.
+func (a *API) BulkUpdateGraphsWithContext(ctx context.Context, cfgs []*Graph, opts *BulkOptions) BulkResults[*Graph] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Graph) (*Graph, error) {
+		return a.UpdateGraphWithContext(ctx, cfg)
+	})
+}
+
+// BulkDeleteGraphs deletes graphs by cid concurrently (see BulkOptions),
+// the results are in the same order as cids.
+func (a *API) BulkDeleteGraphs(cids []string, opts *BulkOptions) BulkResults[bool] {
+	return a.BulkDeleteGraphsWithContext(context.Background(), cids, opts)
+}
 
-	return &graphs, nil
+// BulkDeleteGraphsWithContext is BulkDeleteGraphs with a context for cancellation and deadlines.
+func (a *API) BulkDeleteGraphsWithContext(ctx context.Context, cids []string, opts *BulkOptions) BulkResults[bool] {
+	return Bulk(ctx, cids, opts, func(ctx context.Context, cid string) (bool, error) {
+		return a.DeleteGraphByCIDWithContext(ctx, CIDType(&cid))
+	})
 }
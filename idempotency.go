@@ -0,0 +1,194 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/circonus-labs/go-apiclient/config"
+	"github.com/pkg/errors"
+)
+
+// IdempotencyTagCategory is the tag category of the marker tag added to objects
+// created with Config.IdempotentCreates, e.g. apiclient-create:4f2a...
+const IdempotencyTagCategory = "apiclient-create"
+
+// naturalKeys are the fields identifying a new object for endpoints without
+// tags, other endpoints use a marker tag
+var naturalKeys = map[string][]string{
+	config.AcknowledgementPrefix: {"alert"},
+	config.AnnotationPrefix:      {"title", "start"},
+	config.DashboardPrefix:       {"title"},
+}
+
+// noRetryKey in a request context disables retries by apiRequest
+type noRetryKey struct{}
+
+// createKey in a request context marks a create by Resource.Create, the value
+// reports whether the object has tags. Raw POST requests are not changed.
+type createKey struct{}
+
+// idempotentPost creates an object without leaving duplicates behind when an
+// attempt fails ambiguously (5xx, timeout, connection error) after the API may
+// have created it. Before each retry the API is searched for the object, by a
+// marker tag added to it or by its natural key, and it is only posted again
+// when it does not exist.
+func (a *API) idempotentPost(ctx context.Context, reqPath string, data []byte, tagged bool) ([]byte, error) {
+	keys, hasKeys := naturalKeys[reqPath]
+	if !tagged && !hasKeys {
+		// nothing to find the object by
+		return a.backoffRequest(ctx, "POST", reqPath, data)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil || obj == nil {
+		// not an object, nothing to search for
+		return a.backoffRequest(ctx, "POST", reqPath, data)
+	}
+
+	var query url.Values
+	existing := map[string]bool{}
+
+	if !tagged {
+		query = url.Values{}
+		for _, key := range keys {
+			v, ok := obj[key]
+			if !ok || v == nil {
+				// without the whole key the object cannot be found
+				return a.backoffRequest(ctx, "POST", reqPath, data)
+			}
+			query.Set("f_"+key, fmt.Sprint(v))
+		}
+		// objects matching the key before the create are not ours
+		matches, err := a.findCreated(ctx, reqPath, query)
+		if err != nil {
+			return nil, errors.Wrap(err, "idempotent create, searching existing")
+		}
+		for _, m := range matches {
+			existing[m.cid] = true
+		}
+	} else {
+		marker, err := idempotencyMarker()
+		if err != nil {
+			return nil, err
+		}
+		var tags []interface{}
+		if t, ok := obj["tags"].([]interface{}); ok {
+			tags = t
+		}
+		obj["tags"] = append(tags, marker)
+		if data, err = json.Marshal(obj); err != nil {
+			return nil, errors.Wrap(err, "idempotent create, adding marker tag")
+		}
+		query = url.Values{"f_tags_has": []string{marker}}
+	}
+
+	// retried here, with the retry settings of the call, instead of by apiRequest
+	backoff := a.useBackoff(ctx)
+	maxRetries, limited := a.callMaxRetries(ctx, backoff)
+	postCtx := context.WithValue(ctx, noRetryKey{}, true)
+	start := a.clock.Now()
+	var wait time.Duration
+
+	for attempt := 0; ; attempt++ {
+		result, err := a.apiRequest(postCtx, "POST", reqPath, data)
+		if err == nil {
+			return result, nil
+		}
+
+		ambiguous := isAmbiguousError(err)
+		if ctx.Err() != nil || (!ambiguous && !IsRateLimited(err)) {
+			return nil, err
+		}
+
+		if ambiguous {
+			matches, serr := a.findCreated(ctx, reqPath, query)
+			if serr != nil {
+				return nil, errors.Wrapf(err, "idempotent create, search failed (%s)", serr)
+			}
+			for _, m := range matches {
+				if !existing[m.cid] {
+					a.logWarn("create failed but object exists, not posting again", "cid", m.cid, "err", err)
+					return m.data, nil
+				}
+			}
+		}
+
+		if limited && uint(attempt) >= maxRetries {
+			return nil, err
+		}
+
+		if backoff {
+			wait = a.callBackoffPolicy(ctx).Backoff(attempt+1, wait, a.random.Float64)
+		} else {
+			wait = a.retryDelay(attempt, err)
+		}
+		if !a.retryWithin(start, wait) {
+			return nil, err
+		}
+		a.logWarn("create failed, object does not exist, retrying", "path", reqPath, "err", err, "wait", wait)
+		if serr := a.clock.Sleep(ctx, wait); serr != nil {
+			return nil, errors.Wrap(serr, "Circonus API call")
+		}
+	}
+}
+
+type createdObject struct {
+	cid  string
+	data json.RawMessage
+}
+
+// findCreated returns the objects at reqPath matching query
+func (a *API) findCreated(ctx context.Context, reqPath string, query url.Values) ([]createdObject, error) {
+	reqURL := url.URL{Path: reqPath, RawQuery: query.Encode()}
+	result, err := a.GetWithContext(ctx, reqURL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(result, &raw); err != nil {
+		return nil, errors.Wrap(err, "parsing search results")
+	}
+
+	objs := make([]createdObject, 0, len(raw))
+	for _, r := range raw {
+		var o struct {
+			CID string `json:"_cid"`
+		}
+		if err := json.Unmarshal(r, &o); err != nil {
+			return nil, errors.Wrap(err, "parsing search results")
+		}
+		objs = append(objs, createdObject{cid: o.CID, data: r})
+	}
+
+	return objs, nil
+}
+
+// isAmbiguousError reports whether a failed create may have been applied by the API
+func isAmbiguousError(err error) bool {
+	if apiErr, ok := AsAPIError(err); ok {
+		return apiErr.StatusCode == 0 || apiErr.StatusCode >= 500
+	}
+	// transport errors, e.g. timeouts or connections closed before a response
+	return !IsCircuitOpen(err) && !errors.Is(err, ErrCassetteMiss)
+}
+
+func idempotencyMarker() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generating idempotency marker")
+	}
+	return IdempotencyTagCategory + ":" + hex.EncodeToString(b), nil
+}
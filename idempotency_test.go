@@ -0,0 +1,293 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// createServer stores created objects, failAfter is called for each POST
+// with the number of the attempt and returns the status to respond with
+// after (200 or 5xx) or before (429) creating the object
+type createServer struct {
+	respond func(attempt int) int
+	objects map[string][]map[string]interface{}
+	posts   int
+	mu      sync.Mutex
+}
+
+func (s *createServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		matches := []map[string]interface{}{}
+		for _, obj := range s.objects[r.URL.Path] {
+			ok := true
+			for key, vals := range r.URL.Query() {
+				switch {
+				case key == "f_tags_has":
+					tags, _ := obj["tags"].([]interface{})
+					found := false
+					for _, tag := range tags {
+						found = found || tag == vals[0]
+					}
+					ok = ok && found
+				case strings.HasPrefix(key, "f_"):
+					ok = ok && fmt.Sprint(obj[strings.TrimPrefix(key, "f_")]) == vals[0]
+				}
+			}
+			if ok {
+				matches = append(matches, obj)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(matches)
+	case "POST":
+		s.posts++
+		status := s.respond(s.posts)
+		if status == 429 {
+			w.WriteHeader(status)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var obj map[string]interface{}
+		_ = json.Unmarshal(body, &obj)
+		obj["_cid"] = fmt.Sprintf("%s/%d", r.URL.Path, len(s.objects[r.URL.Path])+1)
+		s.objects[r.URL.Path] = append(s.objects[r.URL.Path], obj)
+		w.WriteHeader(status)
+		if status == 200 {
+			_ = json.NewEncoder(w).Encode(obj)
+		}
+	}
+}
+
+func TestIdempotentCreates(t *testing.T) {
+	tests := []struct {
+		respond     func(int) int
+		description string
+		posts       int
+		objects     int
+	}{
+		{func(int) int { return 200 }, "success", 1, 1},
+		{func(n int) int {
+			if n == 1 {
+				return 503
+			}
+			return 200
+		}, "created before failure", 1, 1},
+		{func(n int) int {
+			if n == 1 {
+				return 429
+			}
+			return 200
+		}, "rate limited, not created", 2, 1},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			s := &createServer{respond: test.respond, objects: map[string][]map[string]interface{}{}}
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL, IdempotentCreates: true, MinRetryDelay: "1ms", MaxRetryDelay: "2ms"})
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+
+			t.Run("marker tag", func(t *testing.T) {
+				cfg := &Graph{Title: "cpu", Tags: []string{"Env:Prod"}}
+				g, err := apih.CreateGraph(cfg)
+				if err != nil {
+					t.Fatalf("unexpected error (%s)", err)
+				}
+				if len(cfg.Tags) != 1 || cfg.Tags[0] != "Env:Prod" {
+					t.Fatalf("expected caller's tags to be unchanged, got %v", cfg.Tags)
+				}
+				if g.CID != "/graph/1" {
+					t.Fatalf("unexpected cid (%s)", g.CID)
+				}
+				if len(g.Tags) != 2 || g.Tags[0] != "env:prod" || !strings.HasPrefix(g.Tags[1], IdempotencyTagCategory+":") {
+					t.Fatalf("expected marker tag, got %v", g.Tags)
+				}
+				if len(s.objects["/graph"]) != test.objects || s.posts != test.posts {
+					t.Fatalf("expected %d objects from %d posts, got %d from %d", test.objects, test.posts, len(s.objects["/graph"]), s.posts)
+				}
+			})
+
+			s.posts = 0
+
+			t.Run("natural key", func(t *testing.T) {
+				// an existing dashboard with the same title is not mistaken for ours
+				s.objects["/dashboard"] = []map[string]interface{}{{"_cid": "/dashboard/1", "title": "overview"}}
+
+				d, err := apih.CreateDashboard(&Dashboard{Title: "overview"})
+				if err != nil {
+					t.Fatalf("unexpected error (%s)", err)
+				}
+				if d.CID != "/dashboard/2" {
+					t.Fatalf("unexpected cid (%s)", d.CID)
+				}
+				if len(s.objects["/dashboard"]) != test.objects+1 || s.posts != test.posts {
+					t.Fatalf("expected %d objects from %d posts, got %d from %d", test.objects+1, test.posts, len(s.objects["/dashboard"]), s.posts)
+				}
+			})
+		})
+	}
+}
+
+func TestIdempotentCreatesNotCreated(t *testing.T) {
+	var posts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			fmt.Fprintln(w, "[]")
+			return
+		}
+		posts++
+		w.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL, IdempotentCreates: true, MaxRetries: 2, MinRetryDelay: "1ms", MaxRetryDelay: "2ms"})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if _, err := apih.CreateRuleSet(&RuleSet{CheckCID: "/check/1", MetricName: "cpu"}); !IsServerError(err) {
+		t.Fatalf("expected server error, got (%v)", err)
+	}
+	if posts != 3 {
+		t.Fatalf("expected 3 posts, got %d", posts)
+	}
+}
+
+func TestIdempotentCreatesMissingKey(t *testing.T) {
+	var gets, posts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			gets++
+			fmt.Fprintln(w, "[]")
+			return
+		}
+		posts++
+		fmt.Fprintln(w, `{"_cid":"/acknowledgement/1"}`)
+	}))
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL, IdempotentCreates: true})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	// alert is omitted when empty, there is nothing to search by
+	if _, err := apih.CreateAcknowledgement(&Acknowledgement{Notes: "maintenance"}); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if gets != 0 || posts != 1 {
+		t.Fatalf("expected a plain post, got %d searches and %d posts", gets, posts)
+	}
+}
+
+func TestIdempotentCreatesRetrySettings(t *testing.T) {
+	var posts int
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			fmt.Fprintln(w, "[]")
+			return
+		}
+		mu.Lock()
+		posts++
+		mu.Unlock()
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(429)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		description string
+		opts        []CallOption
+		sleeps      []time.Duration
+	}{
+		{"retry after", nil, []time.Duration{3 * time.Second, 3 * time.Second}},
+		{"with retries", []CallOption{WithRetries(1)}, []time.Duration{3 * time.Second}},
+		{"with backoff", []CallOption{WithBackoff(NewConstantBackoff(7 * time.Second)), WithRetries(2)}, []time.Duration{7 * time.Second, 7 * time.Second}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			clock := &fakeClock{now: time.Now()}
+			apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL, IdempotentCreates: true, MaxRetries: 2, MaxRetryDelay: "5s", Clock: clock})
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			posts = 0
+
+			if _, err := apih.CreateGraph(&Graph{Title: "cpu"}, test.opts...); !IsRateLimited(err) {
+				t.Fatalf("expected rate limited, got (%v)", err)
+			}
+			if posts != len(test.sleeps)+1 {
+				t.Fatalf("expected %d posts, got %d", len(test.sleeps)+1, posts)
+			}
+			if !reflect.DeepEqual(clock.sleeps, test.sleeps) {
+				t.Fatalf("expected waits %v, got %v", test.sleeps, clock.sleeps)
+			}
+		})
+	}
+}
+
+func TestIdempotentCreatesRawPost(t *testing.T) {
+	var gets int
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" {
+			gets++
+		} else {
+			body, _ = io.ReadAll(r.Body)
+		}
+		fmt.Fprintln(w, "[]")
+	}))
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL, IdempotentCreates: true})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	tests := []struct {
+		path string
+		data string
+	}{
+		{"/graph", `{"title":"cpu","tags":[]}`},
+		{"/dashboard", `{"title":"overview"}`},
+		{"/graph", `[]`},
+	}
+
+	for _, test := range tests {
+		if _, err := apih.Post(test.path, []byte(test.data)); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if string(body) != test.data || gets != 0 {
+			t.Fatalf("expected %s sent unchanged without searches, got %s after %d searches", test.data, body, gets)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// defaultPageSize number of objects requested per page by the Iterate* methods
+const defaultPageSize = 100
+
+// ErrStopIteration can be returned by an Iterate* callback to stop iterating
+// without an error.
+var ErrStopIteration = errors.New("stop iteration")
+
+// searchValues returns the query for a search query and/or filter
+func searchValues(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) url.Values {
+	q := url.Values{}
+
+	if searchCriteria != nil && *searchCriteria != "" {
+		q.Set("search", string(*searchCriteria))
+	}
+
+	if filterCriteria != nil && len(*filterCriteria) > 0 {
+		for filter, criteria := range *filterCriteria {
+			for _, val := range criteria {
+				q.Add(filter, val)
+			}
+		}
+	}
+
+	return q
+}
+
+// iterate pages through the objects at prefix matching q, using the size and
+// from parameters, and calls fn for each object with the decoder positioned at
+// the object. Only one page is held in memory at a time, the page is read whole
+// (through GetWithContext, with its retries) and decoded an object at a time.
+// Iteration stops at the first error, ErrStopIteration stops it without an error.
+func (a *API) iterate(ctx context.Context, prefix string, q url.Values, fn func(dec *json.Decoder) error) error {
+	size := a.pageSize
+	for from := 0; ; from += size {
+		q.Set("size", strconv.Itoa(size))
+		q.Set("from", strconv.Itoa(from))
+
+		reqURL := url.URL{
+			Path:     prefix,
+			RawQuery: q.Encode(),
+		}
+
+		page, err := a.GetWithContext(ctx, reqURL.String())
+		if err != nil {
+			return err
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(page))
+		if tok, err := dec.Token(); err != nil {
+			return errors.Wrap(err, "parsing page")
+		} else if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return errors.Errorf("parsing page, expected array got %v", tok)
+		}
+
+		n := 0
+		for dec.More() {
+			n++
+			if err := fn(dec); err != nil {
+				if errors.Is(err, ErrStopIteration) {
+					return nil
+				}
+				return err
+			}
+		}
+
+		if n < size {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// pagingServer serves n metrics, honoring size/from, and records the queries
+func pagingServer(n int) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var queries []string
+	f := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queries = append(queries, r.URL.RawQuery)
+		mu.Unlock()
+
+		if r.URL.Path != "/metric" {
+			w.WriteHeader(404)
+			fmt.Fprintln(w, `{"code":"ObjectError.NotFound"}`)
+			return
+		}
+
+		q := r.URL.Query()
+		size, _ := strconv.Atoi(q.Get("size"))
+		from, _ := strconv.Atoi(q.Get("from"))
+
+		var page []Metric
+		for i := from; i < n && i < from+size; i++ {
+			page = append(page, Metric{CID: fmt.Sprintf("/metric/%d", i), MetricName: q.Get("search")})
+		}
+		if page == nil {
+			page = []Metric{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(page)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(f)), &queries
+}
+
+func TestIterateMetrics(t *testing.T) {
+	tests := []struct {
+		total    int
+		stopAt   int
+		expected int
+		requests int
+		desc     string
+	}{
+		{0, -1, 0, 1, "empty"},
+		{25, -1, 25, 3, "partial last page"},
+		{30, -1, 30, 4, "full last page"},
+		{30, 12, 12, 2, "stop early"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			server, queries := pagingServer(test.total)
+			defer server.Close()
+
+			apih, err := NewAPI(&Config{TokenKey: "foo", TokenApp: "bar", URL: server.URL, PageSize: 10})
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+
+			search := SearchQueryType("cpu")
+			var got []string
+			err = apih.IterateMetrics(&search, nil, func(m *Metric) error {
+				if len(got) == test.stopAt {
+					return ErrStopIteration
+				}
+				if m.MetricName != "cpu" {
+					t.Fatalf("search not passed, got (%s)", m.MetricName)
+				}
+				got = append(got, m.CID)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+
+			if len(got) != test.expected {
+				t.Fatalf("expected %d metrics, got %d", test.expected, len(got))
+			}
+			for i, cid := range got {
+				if cid != fmt.Sprintf("/metric/%d", i) {
+					t.Fatalf("unexpected order %v", got)
+				}
+			}
+			if len(*queries) != test.requests {
+				t.Fatalf("expected %d requests, got %d %v", test.requests, len(*queries), *queries)
+			}
+			if (*queries)[0] != "from=0&search=cpu&size=10" {
+				t.Fatalf("unexpected query (%s)", (*queries)[0])
+			}
+		})
+	}
+}
+
+func TestIterateErrors(t *testing.T) {
+	server, _ := pagingServer(30)
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", TokenApp: "bar", URL: server.URL, PageSize: 10})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	t.Run("callback error", func(t *testing.T) {
+		errCallback := errors.New("callback failed")
+		n := 0
+		err := apih.IterateMetrics(nil, nil, func(m *Metric) error {
+			n++
+			if n == 15 {
+				return errCallback
+			}
+			return nil
+		})
+		if !errors.Is(err, errCallback) {
+			t.Fatalf("expected callback error, got (%v)", err)
+		}
+		if n != 15 {
+			t.Fatalf("expected iteration to stop at 15, got %d", n)
+		}
+	})
+
+	t.Run("api error", func(t *testing.T) {
+		err := apih.IterateGraphs(nil, nil, func(g *Graph) error {
+			t.Fatal("unexpected graph")
+			return nil
+		})
+		if !IsNotFound(err) {
+			t.Fatalf("expected not found, got (%v)", err)
+		}
+	})
+}
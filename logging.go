@@ -0,0 +1,229 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/circonus-labs/go-apiclient/config"
+)
+
+// StructuredLogger is an optional leveled logger accepting key/value pairs,
+// e.g. Debug("fetching", "cid", "/check_bundle/123"). A *slog.Logger satisfies
+// it directly, see the zaplogger and logruslogger packages for zap and logrus.
+// When set (Config.StructuredLogger) it is used instead of Config.Log.
+type StructuredLogger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// Redacted replaces secret values in log messages
+const Redacted = "<redacted>"
+
+// secretHeaders are never logged
+var secretHeaders = map[string]bool{
+	"X-Circonus-Auth-Token": true,
+	"Authorization":         true,
+	"Proxy-Authorization":   true,
+	"Cookie":                true,
+	"Set-Cookie":            true,
+}
+
+// secretConfigKeys are check bundle config keys holding credentials
+var secretConfigKeys = map[config.Key]bool{
+	config.APIKey:            true,
+	config.APISecret:         true,
+	config.AuthPassphrase:    true,
+	config.AuthPassword:      true,
+	config.LicenseKey:        true,
+	config.OAuthToken:        true,
+	config.OAuthTokenSecret:  true,
+	config.Password:          true,
+	config.PrivacyPassphrase: true,
+	config.ReverseSecretKey:  true,
+	config.SASLPassword:      true,
+	config.Secret:            true,
+}
+
+// isSecretKey reports whether a json key (or log field) holds a secret
+func isSecretKey(key string) bool {
+	if secretConfigKeys[config.Key(strings.ToLower(key))] {
+		return true
+	}
+	if secretHeaders[http.CanonicalHeaderKey(key)] {
+		return true
+	}
+	// header_Authorization et al. in http/json check configs
+	if strings.HasPrefix(key, string(config.HeaderPrefix)) {
+		return secretHeaders[http.CanonicalHeaderKey(strings.TrimPrefix(key, string(config.HeaderPrefix)))]
+	}
+	return false
+}
+
+// redactHeaders returns a copy of h with secret header values replaced
+func redactHeaders(h http.Header) http.Header {
+	r := h.Clone()
+	for k := range r {
+		if secretHeaders[http.CanonicalHeaderKey(k)] {
+			r[k] = []string{Redacted}
+		}
+	}
+	return r
+}
+
+// redactJSON returns data with the values of secret keys (at any depth) replaced.
+// Data which is not valid json is returned as is.
+func redactJSON(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return data
+	}
+	if !redactValue(v) {
+		return data
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return data
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// redactValue replaces secrets in a decoded json value, reporting whether anything changed
+func redactValue(v interface{}) bool {
+	changed := false
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if isSecretKey(k) {
+				if s, ok := val.(string); !ok || s != "" {
+					t[k] = Redacted
+					changed = true
+				}
+				continue
+			}
+			if redactValue(val) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, val := range t {
+			if redactValue(val) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// redactFields returns a copy of key/value pairs with secret values replaced
+func redactFields(keysAndValues []interface{}) []interface{} {
+	r := make([]interface{}, len(keysAndValues))
+	copy(r, keysAndValues)
+	for i := 0; i < len(r); i++ {
+		if i%2 == 0 {
+			if k, ok := r[i].(string); ok && isSecretKey(k) && i+1 < len(r) {
+				r[i+1] = Redacted
+				i++
+			}
+			continue
+		}
+		switch v := r[i].(type) {
+		case http.Header:
+			r[i] = redactHeaders(v)
+		case json.RawMessage:
+			r[i] = string(redactJSON(v))
+		}
+	}
+	return r
+}
+
+// formatFields renders key/value pairs for a Printf logger
+func formatFields(keysAndValues []interface{}) string {
+	var sb strings.Builder
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 < len(keysAndValues) {
+			fmt.Fprintf(&sb, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+		} else {
+			fmt.Fprintf(&sb, " %v", keysAndValues[i])
+		}
+	}
+	return sb.String()
+}
+
+func (a *API) logDebug(msg string, keysAndValues ...interface{}) {
+	if !a.Debug {
+		return
+	}
+	kv := redactFields(keysAndValues)
+	if a.structuredLog != nil {
+		a.structuredLog.Debug(msg, kv...)
+		return
+	}
+	a.Log.Printf("[DEBUG] %s%s", msg, formatFields(kv))
+}
+
+func (a *API) logWarn(msg string, keysAndValues ...interface{}) {
+	kv := redactFields(keysAndValues)
+	if a.structuredLog != nil {
+		a.structuredLog.Warn(msg, kv...)
+		return
+	}
+	a.Log.Printf("[WARN] %s%s", msg, formatFields(kv))
+}
+
+func (a *API) logError(msg string, keysAndValues ...interface{}) {
+	kv := redactFields(keysAndValues)
+	if a.structuredLog != nil {
+		a.structuredLog.Error(msg, kv...)
+		return
+	}
+	a.Log.Printf("[ERR] %s%s", msg, formatFields(kv))
+}
+
+// debugJSON logs a json payload sent to, or received from, the API (debug only),
+// with secrets such as check config passwords redacted.
+func (a *API) debugJSON(msg string, data []byte) {
+	if !a.Debug {
+		return
+	}
+	redacted := redactJSON(data)
+	if a.structuredLog != nil {
+		a.structuredLog.Debug(msg, "json", string(redacted))
+		return
+	}
+	a.Log.Printf("%s: %s", msg, string(redacted))
+}
+
+// retryLogger passes retryablehttp log messages through to the API logger, only when debugging
+type retryLogger struct {
+	a *API
+}
+
+func (l retryLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.a.logDebug(msg, keysAndValues...)
+}
+
+func (l retryLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.a.logDebug(msg, keysAndValues...)
+}
+
+func (l retryLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.a.logDebug(msg, keysAndValues...)
+}
+
+func (l retryLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.a.logDebug(msg, keysAndValues...)
+}
@@ -0,0 +1,13 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package apiclient
+
+import "log/slog"
+
+// a *slog.Logger can be used directly as Config.StructuredLogger
+var _ StructuredLogger = (*slog.Logger)(nil)
@@ -0,0 +1,44 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package apiclient
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	server := callServer()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	apih, err := NewAPI(&Config{
+		TokenKey:         "abc123-token",
+		TokenApp:         "bar",
+		URL:              server.URL,
+		Debug:            true,
+		StructuredLogger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if _, err := apih.Put("/check_bundle/1", []byte(`{"config":{"password":"sekr1t"}}`)); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "abc123-token") || strings.Contains(out, "sekr1t") {
+		t.Fatalf("secret leaked to log:\n%s", out)
+	}
+	if !strings.Contains(out, `"level":"DEBUG","msg":"sending request","method":"PUT"`) {
+		t.Fatalf("expected structured request entry:\n%s", out)
+	}
+}
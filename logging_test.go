@@ -0,0 +1,197 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type logEntry struct {
+	level  string
+	msg    string
+	fields []interface{}
+}
+
+type testStructuredLogger struct {
+	entries []logEntry
+	mu      sync.Mutex
+}
+
+func (l *testStructuredLogger) add(level, msg string, kv []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: kv})
+}
+
+func (l *testStructuredLogger) Debug(msg string, kv ...interface{}) { l.add("debug", msg, kv) }
+func (l *testStructuredLogger) Info(msg string, kv ...interface{})  { l.add("info", msg, kv) }
+func (l *testStructuredLogger) Warn(msg string, kv ...interface{})  { l.add("warn", msg, kv) }
+func (l *testStructuredLogger) Error(msg string, kv ...interface{}) { l.add("error", msg, kv) }
+
+func (l *testStructuredLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var sb strings.Builder
+	for _, e := range l.entries {
+		fmt.Fprintf(&sb, "%s %s%s\n", e.level, e.msg, formatFields(e.fields))
+	}
+	return sb.String()
+}
+
+func TestRedactJSON(t *testing.T) {
+	tests := []struct {
+		id       string
+		data     string
+		expected string
+	}{
+		{
+			id:       "check bundle config",
+			data:     `{"config":{"auth_password":"p1","password":"p2","secret":"s3","url":"https://example.com","header_Authorization":"Bearer xyz"},"display_name":"foo"}`,
+			expected: `{"config":{"auth_password":"<redacted>","header_Authorization":"<redacted>","password":"<redacted>","secret":"<redacted>","url":"https://example.com"},"display_name":"foo"}`,
+		},
+		{
+			id:       "list",
+			data:     `[{"config":{"secret":"abc"}},{"config":{"api_key":"def"}}]`,
+			expected: `[{"config":{"secret":"<redacted>"}},{"config":{"api_key":"<redacted>"}}]`,
+		},
+		{
+			id:       "empty secret left alone",
+			data:     `{"config":{"secret":""}}`,
+			expected: `{"config":{"secret":""}}`,
+		},
+		{
+			id:       "nothing to redact",
+			data:     `{"b":1,"a":2}`,
+			expected: `{"b":1,"a":2}`,
+		},
+		{
+			id:       "not json",
+			data:     `blah blah blah`,
+			expected: `blah blah blah`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			if r := string(redactJSON([]byte(test.data))); r != test.expected {
+				t.Fatalf("expected\n%s\ngot\n%s", test.expected, r)
+			}
+		})
+	}
+}
+
+func TestRedactFields(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Circonus-Auth-Token", "abc123")
+	h.Set("X-Circonus-App-Name", "test")
+
+	kv := redactFields([]interface{}{"headers", h, "X-Circonus-Auth-Token", "abc123", "password", "foo", "cid", "/check_bundle/1"})
+
+	rh := kv[1].(http.Header)
+	if rh.Get("X-Circonus-Auth-Token") != Redacted {
+		t.Fatalf("expected token header redacted, got %q", rh.Get("X-Circonus-Auth-Token"))
+	}
+	if rh.Get("X-Circonus-App-Name") != "test" {
+		t.Fatalf("expected app header unchanged, got %q", rh.Get("X-Circonus-App-Name"))
+	}
+	if h.Get("X-Circonus-Auth-Token") != "abc123" {
+		t.Fatal("original headers modified")
+	}
+	if kv[3] != Redacted || kv[5] != Redacted {
+		t.Fatalf("expected secret fields redacted, got %v", kv)
+	}
+	if kv[7] != "/check_bundle/1" {
+		t.Fatalf("expected cid unchanged, got %v", kv[7])
+	}
+}
+
+func TestLoggingRedaction(t *testing.T) {
+	server := callServer()
+	defer server.Close()
+
+	payload := []byte(`{"type":"httptrap","config":{"secret":"sekr1t","asynch_metrics":"true"}}`)
+
+	t.Run("printf logger", func(t *testing.T) {
+		var buf bytes.Buffer
+		apih, err := NewAPI(&Config{
+			TokenKey: "abc123-token",
+			TokenApp: "bar",
+			URL:      server.URL,
+			Debug:    true,
+			Log:      log.New(&buf, "", 0),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if _, err := apih.Post("/check_bundle", payload); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+
+		out := buf.String()
+		if strings.Contains(out, "abc123-token") || strings.Contains(out, "sekr1t") {
+			t.Fatalf("secret leaked to log:\n%s", out)
+		}
+		if !strings.Contains(out, "sending json: ") || !strings.Contains(out, `"secret":"<redacted>"`) {
+			t.Fatalf("expected redacted json in log:\n%s", out)
+		}
+		if !strings.Contains(out, "[DEBUG] sending request") {
+			t.Fatalf("expected request in log:\n%s", out)
+		}
+	})
+
+	t.Run("printf logger, debug off", func(t *testing.T) {
+		var buf bytes.Buffer
+		apih, err := NewAPI(&Config{
+			TokenKey: "abc123-token",
+			TokenApp: "bar",
+			URL:      server.URL,
+			Log:      log.New(&buf, "", 0),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if _, err := apih.Post("/check_bundle", payload); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("expected no log output, got:\n%s", buf.String())
+		}
+	})
+
+	t.Run("structured logger", func(t *testing.T) {
+		sl := &testStructuredLogger{}
+		apih, err := NewAPI(&Config{
+			TokenKey:         "abc123-token",
+			TokenApp:         "bar",
+			URL:              server.URL,
+			Debug:            true,
+			StructuredLogger: sl,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if _, err := apih.Post("/check_bundle", payload); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+
+		out := sl.String()
+		if strings.Contains(out, "abc123-token") || strings.Contains(out, "sekr1t") {
+			t.Fatalf("secret leaked to log:\n%s", out)
+		}
+		if !strings.Contains(out, "debug sending json json=") {
+			t.Fatalf("expected json entry in log:\n%s", out)
+		}
+		if !strings.Contains(out, "debug sending request method=POST") {
+			t.Fatalf("expected request entry in log:\n%s", out)
+		}
+	})
+}
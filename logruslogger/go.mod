@@ -0,0 +1,17 @@
+module github.com/circonus-labs/go-apiclient/logruslogger
+
+go 1.17
+
+require (
+	github.com/circonus-labs/go-apiclient v0.0.0-00010101000000-000000000000
+	github.com/sirupsen/logrus v1.9.3
+)
+
+require (
+	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
+	github.com/hashicorp/go-retryablehttp v0.7.5 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+)
+
+replace github.com/circonus-labs/go-apiclient => ../
@@ -0,0 +1,67 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package logruslogger adapts a logrus logger for use as an apiclient.StructuredLogger
+//
+//	client, err := apiclient.New(&apiclient.Config{
+//		TokenKey:         "...",
+//		StructuredLogger: logruslogger.New(logrus.StandardLogger()),
+//	})
+package logruslogger
+
+import (
+	"fmt"
+
+	apiclient "github.com/circonus-labs/go-apiclient"
+	"github.com/sirupsen/logrus"
+)
+
+// Logger is an apiclient.StructuredLogger logging to logrus
+type Logger struct {
+	l logrus.FieldLogger
+}
+
+var _ apiclient.StructuredLogger = (*Logger)(nil)
+
+// New returns a StructuredLogger using the passed logrus logger (or entry)
+func New(l logrus.FieldLogger) *Logger {
+	return &Logger{l: l}
+}
+
+// Debug logs a message with key/value pairs at debug level
+func (lr *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	lr.l.WithFields(fields(keysAndValues)).Debug(msg)
+}
+
+// Info logs a message with key/value pairs at info level
+func (lr *Logger) Info(msg string, keysAndValues ...interface{}) {
+	lr.l.WithFields(fields(keysAndValues)).Info(msg)
+}
+
+// Warn logs a message with key/value pairs at warn level
+func (lr *Logger) Warn(msg string, keysAndValues ...interface{}) {
+	lr.l.WithFields(fields(keysAndValues)).Warn(msg)
+}
+
+// Error logs a message with key/value pairs at error level
+func (lr *Logger) Error(msg string, keysAndValues ...interface{}) {
+	lr.l.WithFields(fields(keysAndValues)).Error(msg)
+}
+
+// fields converts key/value pairs to logrus fields, a trailing key without a value is kept as "!BADKEY"
+func fields(keysAndValues []interface{}) logrus.Fields {
+	f := make(logrus.Fields, len(keysAndValues)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 >= len(keysAndValues) {
+			f["!BADKEY"] = keysAndValues[i]
+			break
+		}
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		f[key] = keysAndValues[i+1]
+	}
+	return f
+}
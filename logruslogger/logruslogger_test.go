@@ -0,0 +1,53 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package logruslogger
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLogger(t *testing.T) {
+	base, hook := test.NewNullLogger()
+	base.SetLevel(logrus.DebugLevel)
+	l := New(base)
+
+	l.Debug("debug msg", "cid", "/check_bundle/1")
+	l.Info("info msg", "n", 1)
+	l.Warn("warn msg")
+	l.Error("error msg", "err", "boom", "dangling")
+
+	entries := hook.AllEntries()
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+
+	expected := []struct {
+		msg   string
+		level logrus.Level
+	}{
+		{"debug msg", logrus.DebugLevel},
+		{"info msg", logrus.InfoLevel},
+		{"warn msg", logrus.WarnLevel},
+		{"error msg", logrus.ErrorLevel},
+	}
+	for i, e := range expected {
+		if entries[i].Level != e.level || entries[i].Message != e.msg {
+			t.Fatalf("entry %d: expected %s %q, got %s %q", i, e.level, e.msg, entries[i].Level, entries[i].Message)
+		}
+	}
+
+	if cid := entries[0].Data["cid"]; cid != "/check_bundle/1" {
+		t.Fatalf("expected cid field, got %v", cid)
+	}
+	if n := entries[1].Data["n"]; n != 1 {
+		t.Fatalf("expected n field, got %v", n)
+	}
+	if bad := entries[3].Data["!BADKEY"]; bad != "dangling" {
+		t.Fatalf("expected dangling key, got %v", bad)
+	}
+}
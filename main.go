@@ -10,14 +10,11 @@ package apiclient
 import (
 	"bytes"
 	"context"
-	crand "crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"io"
 	"log"
-	"math"
-	"math/big"
 	"math/rand"
 	"net"
 	"net/http"
@@ -31,17 +28,6 @@ import (
 	"github.com/pkg/errors"
 )
 
-var rnd *rand.Rand
-
-func init() {
-	n, err := crand.Int(crand.Reader, big.NewInt(math.MaxInt64))
-	if err != nil {
-		rnd = rand.New(rand.NewSource(time.Now().UTC().UnixNano())) //nolint:gosec //G404
-		return
-	}
-	rand.New(rand.NewSource(n.Int64())) //nolint:gosec //G404
-}
-
 const (
 	// a few sensible defaults
 	defaultAPIURL = "https://api.circonus.com/v2"
@@ -49,6 +35,11 @@ const (
 	minRetryWait  = 1 * time.Second
 	maxRetryWait  = 15 * time.Second
 	maxRetries    = 4 // equating to 1 + maxRetries total attempts
+
+	// connection pool defaults
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = 90 * time.Second
 )
 
 // Logger facilitates use of any logger supporting the required methods
@@ -87,6 +78,8 @@ type TagType []string
 // Config options for Circonus API
 type Config struct {
 	Log Logger
+	// StructuredLogger optional leveled, key/value logger, used instead of Log when set
+	StructuredLogger StructuredLogger
 	// TLSConfig defines a custom tls configuration to use when communicating with the API
 	TLSConfig *tls.Config
 	// CACert deprecating, use TLSConfig instead
@@ -103,11 +96,95 @@ type Config struct {
 	MaxRetries     uint
 	DisableRetries bool
 	Debug          bool
+	// CoalesceGets makes concurrent identical GET requests, made without call
+	// options, share one API request. The request uses the context values
+	// (e.g. trace spans) of the first caller.
+	CoalesceGets bool
+	// IdempotentCreates avoids duplicate objects when a create (Create* methods,
+	// raw Post calls are not changed) fails ambiguously (5xx, timeout) by
+	// checking whether the object exists before posting again. Objects are found
+	// by a marker tag (see IdempotencyTagCategory) added to them or, for
+	// acknowledgements, annotations and dashboards, their natural key. Natural
+	// key creates cost an extra search request before the first attempt, to
+	// tell objects which already existed from the one created.
+	// NOTE: the marker tag is stored on the created object and is not removed.
+	IdempotentCreates bool
+	// DetectConflicts makes Update* methods of objects with a _last_modified
+	// fetch the object just before updating it and fail with a *ConflictError,
+	// without updating, if it was modified on the server since it was fetched
+	// (see also UpdateWithMerge). It covers UpdateAcknowledgement,
+	// UpdateAnnotation, UpdateCheckBundle, UpdateContactGroup, UpdateDashboard
+	// and UpdateOutlierReport, other Update* methods are not checked.
+	DetectConflicts bool
+	// DryRun captures Post, Put and Delete requests (see API.DryRunChanges) instead of sending them
+	DryRun bool
+	// ExponentialBackoff start with exponential backoff enabled (see EnableExponentialBackoff)
+	ExponentialBackoff bool
+	// BackoffPolicy the waits between retries when exponential backoff is enabled - default DefaultBackoffPolicy
+	BackoffPolicy BackoffPolicy
+	// MaxRetryDuration no retry is started after this long (e.g. "5m") from the
+	// first attempt of a request - default unlimited
+	MaxRetryDuration string
+	// Clock used for retry waits (with or without exponential backoff),
+	// MaxRetryDuration, Retry-After dates, the rate limiter and the circuit
+	// breaker cooldown - default the system clock
+	Clock Clock
+	// RandSource random source for backoff jitter - default seeded from crypto/rand
+	RandSource rand.Source
+
+	// MaxIdleConns limits idle (keep-alive) connections kept in the pool - default 100
+	MaxIdleConns int
+	// MaxIdleConnsPerHost limits idle (keep-alive) connections kept per host - default 10
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout how long an idle connection remains in the pool (e.g. "90s") - default 90s
+	IdleConnTimeout string
+	// DisableKeepAlives use a new connection for every request
+	DisableKeepAlives bool
+	// DisableHTTP2 do not attempt to negotiate HTTP/2 with the API
+	DisableHTTP2 bool
+
+	// RateLimit enables a client side rate limiter, shared by all requests
+	// (and goroutines) using the API, allowing RateLimit requests per second
+	RateLimit float64
+	// RateLimitBurst number of requests allowed to exceed RateLimit momentarily - default ceil(RateLimit)
+	RateLimitBurst int
+
+	// Middleware wraps the transport for every request (see Middleware), the first is outermost
+	Middleware []Middleware
+
+	// CircuitBreakerThreshold enables a circuit breaker which opens after this
+	// many consecutive failed (5xx, timeout, connection error) request attempts.
+	// While open, requests fail with a *CircuitOpenError without being sent.
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown how long the breaker stays open before allowing a probe request (e.g. "30s") - default 30s
+	CircuitBreakerCooldown string
+	// CircuitBreakerOnStateChange is called when the breaker changes state
+	CircuitBreakerOnStateChange func(from, to BreakerState)
+
+	// Observers are notified of the start and end of every request attempt (see Observer)
+	Observers []Observer
+
+	// CacheTTLs enables a read-through cache for FetchAccount, FetchBroker,
+	// FetchContactGroup and FetchUser. Keyed by endpoint prefix (e.g.
+	// config.BrokerPrefix) with the time an object is cached (e.g. "10m").
+	CacheTTLs map[string]string
+	// CacheMaxEntries bounds the cache, least recently used objects are evicted - default 1000
+	CacheMaxEntries int
+
+	// PageSize number of objects requested per page by the Iterate* methods,
+	// each page is read into memory whole - default 100
+	PageSize int
+
+	// CassetteMode records API interactions to, or replays them from, CassetteFile (see CassetteMode)
+	CassetteMode CassetteMode
+	// CassetteFile path of the cassette to record to or replay from
+	CassetteFile string
 }
 
 // API Circonus API
 type API struct {
 	Log                     Logger
+	structuredLog           StructuredLogger
 	caCert                  *x509.CertPool
 	tlsConfig               *tls.Config
 	apiURL                  *url.URL
@@ -116,10 +193,27 @@ type API struct {
 	accountID               TokenAccountIDType
 	minRetryDelay           time.Duration
 	maxRetryDelay           time.Duration
+	maxRetryDuration        time.Duration
+	backoffPolicy           BackoffPolicy
+	clock                   Clock
+	random                  *lockedRand
 	maxRetries              uint
+	pageSize                int
+	client                  *retryablehttp.Client
+	limiter                 *rateLimiter
+	cache                   *responseCache
+	breaker                 *circuitBreaker
+	flights                 flightGroup
+	dryRunChanges           []Change
+	dryRunCIDs              int
+	dryRun                  bool
+	coalesceGets            bool
+	detectConflicts         bool
+	idempotentCreates       bool
 	useExponentialBackoff   bool
 	Debug                   bool
 	useExponentialBackoffmu sync.Mutex
+	dryRunmu                sync.Mutex
 }
 
 // NewClient returns a new Circonus API (alias for New)
@@ -177,11 +271,19 @@ func New(ac *Config) (*API, error) {
 		tlsConfig:             ac.TLSConfig,
 		Debug:                 ac.Debug,
 		Log:                   ac.Log,
-		useExponentialBackoff: false,
+		useExponentialBackoff: ac.ExponentialBackoff,
+		dryRun:                ac.DryRun,
+		coalesceGets:          ac.CoalesceGets,
+		idempotentCreates:     ac.IdempotentCreates,
+		detectConflicts:       ac.DetectConflicts,
+		backoffPolicy:         ac.BackoffPolicy,
+		clock:                 ac.Clock,
+		random:                newLockedRand(ac.RandSource),
 	}
 
 	a.Debug = ac.Debug
 	a.Log = ac.Log
+	a.structuredLog = ac.StructuredLogger
 	if a.Debug && a.Log == nil {
 		a.Log = log.New(os.Stdout, "", log.LstdFlags)
 	}
@@ -189,6 +291,19 @@ func New(ac *Config) (*API, error) {
 		a.Log = log.New(io.Discard, "", log.LstdFlags)
 	}
 
+	if len(ac.CacheTTLs) > 0 {
+		cache, err := newResponseCache(ac.CacheTTLs, ac.CacheMaxEntries)
+		if err != nil {
+			return nil, err
+		}
+		a.cache = cache
+	}
+
+	a.pageSize = defaultPageSize
+	if ac.PageSize > 0 {
+		a.pageSize = ac.PageSize
+	}
+
 	a.maxRetries = maxRetries
 	if ac.MaxRetries > 0 {
 		a.maxRetries = ac.MaxRetries
@@ -202,7 +317,7 @@ func New(ac *Config) (*API, error) {
 	if ac.MinRetryDelay != "" {
 		mr, err := time.ParseDuration(ac.MinRetryDelay)
 		if err != nil {
-			a.Log.Printf("[ERR] min retry delay (%s): %s", ac.MinRetryDelay, err)
+			a.logError("parsing min retry delay", "value", ac.MinRetryDelay, "err", err)
 		}
 		a.minRetryDelay = mr
 	}
@@ -211,16 +326,37 @@ func New(ac *Config) (*API, error) {
 	if ac.MaxRetryDelay != "" {
 		mr, err := time.ParseDuration(ac.MaxRetryDelay)
 		if err != nil {
-			a.Log.Printf("[ERR] max retry delay (%s): %s", ac.MaxRetryDelay, err)
+			a.logError("parsing max retry delay", "value", ac.MaxRetryDelay, "err", err)
 		}
 		a.maxRetryDelay = mr
 	}
 
+	if a.backoffPolicy == nil {
+		a.backoffPolicy = DefaultBackoffPolicy
+	}
+	if a.clock == nil {
+		a.clock = systemClock{}
+	}
+	if ac.MaxRetryDuration != "" {
+		d, err := time.ParseDuration(ac.MaxRetryDuration)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing max retry duration")
+		}
+		a.maxRetryDuration = d
+	}
+
+	client, err := a.newHTTPClient(ac)
+	if err != nil {
+		return nil, err
+	}
+	a.client = client
+
 	return a, nil
 }
 
 // EnableExponentialBackoff enables use of exponential backoff for next API call(s)
 // and use exponential backoff for all API calls until exponential backoff is disabled.
+// It affects every user of the API, see WithBackoff for a single call.
 func (a *API) EnableExponentialBackoff() {
 	a.useExponentialBackoffmu.Lock()
 	a.useExponentialBackoff = true
@@ -236,79 +372,148 @@ func (a *API) DisableExponentialBackoff() {
 	a.useExponentialBackoffmu.Unlock()
 }
 
+func (a *API) exponentialBackoff() bool {
+	a.useExponentialBackoffmu.Lock()
+	defer a.useExponentialBackoffmu.Unlock()
+	return a.useExponentialBackoff
+}
+
 // Get API request
-func (a *API) Get(reqPath string) ([]byte, error) {
-	return a.apiRequest("GET", reqPath, nil)
+func (a *API) Get(reqPath string, opts ...CallOption) ([]byte, error) {
+	return a.GetWithContext(context.Background(), reqPath, opts...)
+}
+
+// GetWithContext API request, ctx cancels the request and any retries
+func (a *API) GetWithContext(ctx context.Context, reqPath string, opts ...CallOption) ([]byte, error) {
+	ctx = ContextWithCallOptions(ctx, opts...)
+	if a.coalesceGets && getCallOptions(ctx) == nil {
+		return a.coalescedGet(ctx, reqPath)
+	}
+	return a.apiRequest(ctx, "GET", reqPath, nil)
 }
 
 // Delete API request
-func (a *API) Delete(reqPath string) ([]byte, error) {
-	return a.apiRequest("DELETE", reqPath, nil)
+func (a *API) Delete(reqPath string, opts ...CallOption) ([]byte, error) {
+	return a.DeleteWithContext(context.Background(), reqPath, opts...)
+}
+
+// DeleteWithContext API request, ctx cancels the request and any retries
+func (a *API) DeleteWithContext(ctx context.Context, reqPath string, opts ...CallOption) ([]byte, error) {
+	a.flights.forget(reqPath)
+	defer a.invalidateCache(reqPath)
+	return a.apiRequest(ContextWithCallOptions(ctx, opts...), "DELETE", reqPath, nil)
 }
 
 // Post API request
-func (a *API) Post(reqPath string, data []byte) ([]byte, error) {
-	return a.apiRequest("POST", reqPath, data)
+func (a *API) Post(reqPath string, data []byte, opts ...CallOption) ([]byte, error) {
+	return a.PostWithContext(context.Background(), reqPath, data, opts...)
+}
+
+// PostWithContext API request, ctx cancels the request and any retries
+func (a *API) PostWithContext(ctx context.Context, reqPath string, data []byte, opts ...CallOption) ([]byte, error) {
+	return a.apiRequest(ContextWithCallOptions(ctx, opts...), "POST", reqPath, data)
 }
 
 // Put API request
-func (a *API) Put(reqPath string, data []byte) ([]byte, error) {
-	return a.apiRequest("PUT", reqPath, data)
+func (a *API) Put(reqPath string, data []byte, opts ...CallOption) ([]byte, error) {
+	return a.PutWithContext(context.Background(), reqPath, data, opts...)
 }
 
-func backoff(interval uint) float64 {
-	return math.Floor(((float64(interval) * (1 + rnd.Float64())) / 2) + .5) //nolint:gosec
+// PutWithContext API request, ctx cancels the request and any retries
+func (a *API) PutWithContext(ctx context.Context, reqPath string, data []byte, opts ...CallOption) ([]byte, error) {
+	a.flights.forget(reqPath)
+	defer a.invalidateCache(reqPath)
+	return a.apiRequest(ContextWithCallOptions(ctx, opts...), "PUT", reqPath, data)
 }
 
 // apiRequest manages retry strategy for exponential backoffs
-func (a *API) apiRequest(reqMethod string, reqPath string, data []byte) ([]byte, error) {
-	backoffs := []uint{2, 4, 8, 16, 32}
+func (a *API) apiRequest(ctx context.Context, reqMethod string, reqPath string, data []byte) ([]byte, error) {
+	if o := getCallOptions(ctx); o != nil && o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	if a.dryRun && reqMethod != "GET" {
+		return a.dryRunRequest(reqMethod, reqPath, data)
+	}
+	if tagged, ok := ctx.Value(createKey{}).(bool); ok && a.idempotentCreates && reqMethod == "POST" && ctx.Value(noRetryKey{}) == nil {
+		return a.idempotentPost(ctx, reqPath, data, tagged)
+	}
+
+	return a.backoffRequest(ctx, reqMethod, reqPath, data)
+}
+
+// backoffRequest retries failed calls, waiting on the API clock: according to
+// the backoff policy with exponential backoff, otherwise between the min and
+// max retry delay (or as long as a Retry-After asks)
+func (a *API) backoffRequest(ctx context.Context, reqMethod string, reqPath string, data []byte) ([]byte, error) {
 	attempts := 0
-	success := false
+	start := a.clock.Now()
+
+	ctx = context.WithValue(ctx, requestStateKey{}, &requestState{path: reqPath})
+
+	retry := ctx.Value(noRetryKey{}) == nil
+	backoff := a.useBackoff(ctx)
+	maxRetries, limited := a.callMaxRetries(ctx, backoff)
 
 	var result []byte
 	var err error
+	var wait time.Duration
 
-	for !success {
-		result, err = a.apiCall(reqMethod, reqPath, data)
-		if err == nil {
-			success = true
+	for {
+		result, err = a.apiCall(ctx, reqMethod, reqPath, data)
+		if err == nil || ctx.Err() != nil || !retry || !retryable(err, backoff) {
+			break
 		}
-
-		// break and return error if not using exponential backoff
-		if err != nil {
-			if !a.useExponentialBackoff {
-				break
-			}
-			if strings.Contains(err.Error(), "code 400") {
-				break
-			}
-			if strings.Contains(err.Error(), "code 403") {
-				break
-			}
-			if strings.Contains(err.Error(), "code 404") {
-				break
-			}
+		if limited && uint(attempts) >= maxRetries {
+			break
 		}
 
-		if !success {
-			var wait float64
-			if attempts >= len(backoffs) {
-				wait = backoff(backoffs[len(backoffs)-1])
-			} else {
-				wait = backoff(backoffs[attempts])
-			}
-			attempts++
-			a.Log.Printf("Circonus API call failed %s, retrying in %d seconds.\n", err.Error(), uint(wait))
-			time.Sleep(time.Duration(wait) * time.Second)
+		if backoff {
+			wait = a.callBackoffPolicy(ctx).Backoff(attempts+1, wait, a.random.Float64)
+		} else {
+			wait = a.retryDelay(attempts, err)
+		}
+		if !a.retryWithin(start, wait) {
+			a.logWarn("Circonus API call failed, max retry duration reached", "err", err, "max", a.maxRetryDuration)
+			break
 		}
+		attempts++
+		a.logWarn("Circonus API call failed, retrying", "err", err, "wait", wait)
+		if serr := a.clock.Sleep(ctx, wait); serr != nil {
+			return nil, errors.Wrap(serr, "Circonus API call")
+		}
+	}
+
+	if apiErr, ok := AsAPIError(err); ok {
+		apiErr.Retries = attempts
 	}
 
 	return result, err
 }
 
+// retryable reports whether a failed call is retried. With exponential backoff
+// all errors but 400, 403 and 404 are, otherwise only 429, 5xx and errors
+// without a response (e.g. timeouts or connections closed).
+func retryable(err error, backoff bool) bool {
+	if backoff {
+		return !IsBadRequest(err) && !IsForbidden(err) && !IsNotFound(err) && !IsCircuitOpen(err) && !errors.Is(err, ErrCassetteMiss)
+	}
+	return isAmbiguousError(err) || IsRateLimited(err)
+}
+
+// retryDelay returns the wait before a retry without exponential backoff,
+// attempt counts from 0 for the first retry
+func (a *API) retryDelay(attempt int, err error) time.Duration {
+	var resp *http.Response
+	if apiErr, ok := AsAPIError(err); ok {
+		resp = &http.Response{StatusCode: apiErr.StatusCode, Header: apiErr.header}
+	}
+	return a.retryBackoff(a.minRetryDelay, a.maxRetryDelay, attempt, resp)
+}
+
 // apiCall call Circonus API
-func (a *API) apiCall(reqMethod string, reqPath string, data []byte) ([]byte, error) {
+func (a *API) apiCall(ctx context.Context, reqMethod string, reqPath string, data []byte) ([]byte, error) {
 	reqURL := a.apiURL.String()
 
 	if reqPath == "" {
@@ -323,121 +528,57 @@ func (a *API) apiCall(reqMethod string, reqPath string, data []byte) ([]byte, er
 		reqURL += reqPath
 	}
 
-	// keep last HTTP error in the event of retry failure
-	var lastHTTPError error
-	retryPolicy := func(ctx context.Context, resp *http.Response, err error) (bool, error) {
-		if ctxErr := ctx.Err(); ctxErr != nil {
-			return false, errors.Wrap(ctxErr, "Circonus API call")
-		}
-
+	opts := getCallOptions(ctx)
+	if opts != nil && len(opts.query) > 0 {
+		u, err := url.Parse(reqURL)
 		if err != nil {
-			lastHTTPError = err
-			return true, errors.Wrap(err, "Circonus API call")
+			return nil, errors.Wrap(err, "parsing Circonus API URL")
 		}
-		// Check the response code. We retry on 500-range responses to allow
-		// the server time to recover, as 500's are typically not permanent
-		// errors and may relate to outages on the server side. This will catch
-		// invalid response codes as well, like 0 and 999.
-		// Retry on 429 (rate limit) as well.
-		if resp.StatusCode == 0 || // wtf?!
-			resp.StatusCode >= 500 || // rutroh
-			resp.StatusCode == 429 { // rate limit
-			body, readErr := io.ReadAll(resp.Body)
-			if readErr != nil {
-				lastHTTPError = errors.Errorf("- response: %d %s", resp.StatusCode, readErr.Error())
-			} else {
-				lastHTTPError = errors.Errorf("- response: %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		q := u.Query()
+		for key, values := range opts.query {
+			for _, v := range values {
+				q.Add(key, v)
 			}
-			return true, nil
 		}
-		return false, nil
+		u.RawQuery = q.Encode()
+		reqURL = u.String()
 	}
 
 	if len(data) > 0 {
-		a.Log.Printf("[DEBUG] sending json (%s)\n", string(data))
+		a.debugJSON("sending json", data)
 	}
 
 	dataReader := bytes.NewReader(data)
 
-	req, err := retryablehttp.NewRequest(reqMethod, reqURL, dataReader)
+	req, err := retryablehttp.NewRequestWithContext(ctx, reqMethod, reqURL, dataReader)
 	if err != nil {
 		return nil, errors.Errorf("creating Circonus API request: %s %+v", reqURL, err)
 	}
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("X-Circonus-Auth-Token", string(a.key))
 	req.Header.Add("X-Circonus-App-Name", string(a.app))
-	if string(a.accountID) != "" {
-		req.Header.Add("X-Circonus-Account-ID", string(a.accountID))
+	accountID := string(a.accountID)
+	if opts != nil && opts.accountID != nil {
+		accountID = *opts.accountID
+	}
+	if accountID != "" {
+		req.Header.Add("X-Circonus-Account-ID", accountID)
 	}
 	req.Header.Add("Cache-Control", "no-store")
-
-	client := retryablehttp.NewClient()
-	if a.apiURL.Scheme == "https" {
-		var tlscfg *tls.Config
-		if a.tlsConfig != nil { // preference full custom tls config
-			tlscfg = a.tlsConfig
-		} else if a.caCert != nil {
-			tlscfg = &tls.Config{
-				RootCAs:    a.caCert,
-				MinVersion: tls.VersionTLS12,
-			}
+	if opts != nil {
+		for key, values := range opts.headers {
+			req.Header[key] = append([]string(nil), values...)
 		}
-		client.HTTPClient.Transport = &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			Dial: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout: 10 * time.Second,
-			TLSClientConfig:     tlscfg,
-			DisableKeepAlives:   true,
-			MaxIdleConnsPerHost: -1,
-			DisableCompression:  true,
-		}
-	} else {
-		client.HTTPClient.Transport = &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			Dial: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout: 10 * time.Second,
-			DisableKeepAlives:   true,
-			MaxIdleConnsPerHost: -1,
-			DisableCompression:  true,
-		}
-	}
-
-	a.useExponentialBackoffmu.Lock()
-	eb := a.useExponentialBackoff
-	a.useExponentialBackoffmu.Unlock()
-
-	if eb {
-		// limit to one request if using exponential backoff
-		client.RetryWaitMin = 1 * time.Second
-		client.RetryWaitMax = 60 * time.Second
-		client.RetryMax = 0
-	} else {
-		client.RetryWaitMin = a.minRetryDelay
-		client.RetryWaitMax = a.maxRetryDelay
-		client.RetryMax = int(a.maxRetries)
-	}
-
-	// retryablehttp only groks log or no log
-	if a.Debug {
-		client.Logger = a.Log
-	} else {
-		client.Logger = log.New(io.Discard, "", log.LstdFlags)
 	}
 
-	client.CheckRetry = retryPolicy
+	a.logDebug("sending request", "method", reqMethod, "url", reqURL, "headers", req.Header)
 
-	resp, err := client.Do(req)
+	resp, err := a.client.Do(req)
 	if err != nil {
-		if lastHTTPError != nil {
-			return nil, lastHTTPError
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, errors.Wrap(ctxErr, "Circonus API call")
 		}
-		return nil, errors.Errorf("Circonus API call - %s: %+v", reqURL, err)
+		return nil, errors.Wrapf(err, "Circonus API call - %s", reqURL)
 	}
 
 	defer resp.Body.Close() // nolint: errcheck
@@ -447,13 +588,114 @@ func (a *API) apiCall(reqMethod string, reqPath string, data []byte) ([]byte, er
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		msg := fmt.Sprintf("API response code %d: %s", resp.StatusCode, string(body))
-		if a.Debug {
-			a.Log.Printf("%s\n", msg)
-		}
+		apiErr := newAPIError(reqMethod, reqPath, resp.StatusCode, body)
+		apiErr.header = resp.Header
+		a.logDebug("API error response", "method", reqMethod, "path", reqPath, "status", resp.StatusCode, "err", apiErr)
 
-		return nil, errors.New(msg)
+		return nil, apiErr
 	}
 
 	return body, nil
 }
+
+// retryBackoff honors a Retry-After (delay seconds or HTTP date) from the API on
+// 429 and 503 responses, up to max, otherwise it backs off exponentially between
+// min and max
+func (a *API) retryBackoff(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), a.clock.Now()); ok {
+			if after > max {
+				return max
+			}
+			return after
+		}
+	}
+	return retryablehttp.DefaultBackoff(min, max, attemptNum, nil)
+}
+
+// newHTTPClient builds the long-lived, pooled client used for all API requests
+func (a *API) newHTTPClient(ac *Config) (*retryablehttp.Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     !ac.DisableHTTP2,
+		DisableKeepAlives:     ac.DisableKeepAlives,
+		MaxIdleConns:          defaultMaxIdleConns,
+		MaxIdleConnsPerHost:   defaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       defaultIdleConnTimeout,
+		DisableCompression:    true,
+	}
+
+	if ac.MaxIdleConns > 0 {
+		transport.MaxIdleConns = ac.MaxIdleConns
+	}
+	if ac.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = ac.MaxIdleConnsPerHost
+	}
+	if ac.IdleConnTimeout != "" {
+		ict, err := time.ParseDuration(ac.IdleConnTimeout)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing idle connection timeout")
+		}
+		transport.IdleConnTimeout = ict
+	}
+	if ac.DisableHTTP2 {
+		// a non-nil, empty map disables http/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if a.apiURL.Scheme == "https" {
+		if a.tlsConfig != nil { // preference full custom tls config
+			transport.TLSClientConfig = a.tlsConfig
+		} else if a.caCert != nil {
+			transport.TLSClientConfig = &tls.Config{
+				RootCAs:    a.caCert,
+				MinVersion: tls.VersionTLS12,
+			}
+		}
+	}
+
+	var rt http.RoundTripper = transport
+	if ac.CassetteMode != "" {
+		ct, err := newCassetteTransport(ac.CassetteMode, ac.CassetteFile, a.apiURL.Path, transport)
+		if err != nil {
+			return nil, err
+		}
+		rt = ct
+	}
+
+	rt = chainMiddleware(rt, ac.Middleware)
+	if ac.RateLimit > 0 {
+		a.limiter = newRateLimiter(ac.RateLimit, ac.RateLimitBurst, a.clock)
+		rt = &rateLimitTransport{next: rt, limiter: a.limiter}
+	}
+	if ac.CircuitBreakerThreshold > 0 {
+		cooldown := defaultBreakerCooldown
+		if ac.CircuitBreakerCooldown != "" {
+			d, err := time.ParseDuration(ac.CircuitBreakerCooldown)
+			if err != nil {
+				return nil, errors.Wrap(err, "parsing circuit breaker cooldown")
+			}
+			cooldown = d
+		}
+		a.breaker = newCircuitBreaker(ac.CircuitBreakerThreshold, cooldown, ac.CircuitBreakerOnStateChange, a.clock)
+		rt = &breakerTransport{next: rt, breaker: a.breaker}
+	}
+	if len(ac.Observers) > 0 {
+		rt = &observerTransport{next: rt, observers: ac.Observers}
+	}
+
+	client := retryablehttp.NewClient()
+	client.HTTPClient = &http.Client{Transport: rt}
+	client.RetryMax = 0 // retried by apiRequest, waiting on the API clock
+	client.CheckRetry = func(context.Context, *http.Response, error) (bool, error) { return false, nil }
+	client.ErrorHandler = retryablehttp.PassthroughErrorHandler
+	client.Logger = retryLogger{a: a}
+
+	return client, nil
+}
@@ -5,13 +5,16 @@
 package apiclient
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -172,6 +175,22 @@ func TestNew(t *testing.T) {
 			},
 			shouldFail: false,
 		},
+		{
+			id: "token,idle conn timeout",
+			cfg: &Config{
+				TokenKey:        "foo",
+				IdleConnTimeout: "30s",
+			},
+			shouldFail: false,
+		},
+		{
+			id: "invalid (idle conn timeout)",
+			cfg: &Config{
+				TokenKey:        "foo",
+				IdleConnTimeout: "30",
+			},
+			shouldFail: true,
+		},
 		{
 			id: "invalid (url)",
 			cfg: &Config{
@@ -253,7 +272,7 @@ func TestApiCall(t *testing.T) {
 
 	t.Log("invalid URL path")
 	{
-		_, err := apih.apiCall("GET", "", nil)
+		_, err := apih.apiCall(context.Background(), "GET", "", nil)
 		expectedError := errors.New("invalid Circonus API URL path (empty)")
 		if err == nil {
 			t.Errorf("Expected error")
@@ -266,7 +285,7 @@ func TestApiCall(t *testing.T) {
 	t.Log("URL path fixup, prefix '/'")
 	{
 		call := "GET"
-		resp, err := apih.apiCall(call, "nothing", nil)
+		resp, err := apih.apiCall(context.Background(), call, "nothing", nil)
 		if err != nil {
 			t.Errorf("Expected no error, got '%+v'", resp)
 		}
@@ -279,7 +298,7 @@ func TestApiCall(t *testing.T) {
 	t.Log("URL path fixup, remove '/v2' prefix")
 	{
 		call := "GET"
-		resp, err := apih.apiCall(call, "/v2/nothing", nil)
+		resp, err := apih.apiCall(context.Background(), call, "/v2/nothing", nil)
 		if err != nil {
 			t.Errorf("Expected no error, got '%+v'", resp)
 		}
@@ -292,7 +311,7 @@ func TestApiCall(t *testing.T) {
 	calls := []string{"GET", "PUT", "POST", "DELETE"}
 	for _, call := range calls {
 		t.Logf("Testing %s call", call)
-		resp, err := apih.apiCall(call, "/", nil)
+		resp, err := apih.apiCall(context.Background(), call, "/", nil)
 		if err != nil {
 			t.Errorf("Expected no error, got '%+v'", resp)
 		}
@@ -330,7 +349,7 @@ func TestSSLApiCall(t *testing.T) {
 		calls := []string{"GET", "PUT", "POST", "DELETE"}
 		for _, call := range calls {
 			t.Logf("Testing %s call", call)
-			resp, err := apih.apiCall(call, "/", nil)
+			resp, err := apih.apiCall(context.Background(), call, "/", nil)
 			if err != nil {
 				t.Errorf("Expected no error, got '%+v'", resp)
 			}
@@ -364,7 +383,7 @@ func TestSSLApiCall(t *testing.T) {
 		calls := []string{"GET", "PUT", "POST", "DELETE"}
 		for _, call := range calls {
 			t.Logf("Testing %s call", call)
-			resp, err := apih.apiCall(call, "/", nil)
+			resp, err := apih.apiCall(context.Background(), call, "/", nil)
 			if err != nil {
 				t.Errorf("Expected no error, got '%+v'", resp)
 			}
@@ -519,7 +538,7 @@ func TestApiRequest(t *testing.T) {
 			t.Logf("\tTesting %d %s call(s)", maxReq, call)
 			numReq = 0
 			start := time.Now()
-			resp, err := apih.apiRequest(call, "/", nil)
+			resp, err := apih.apiRequest(context.Background(), call, "/", nil)
 			if err != nil {
 				t.Errorf("Expected no error, got '%+v'", resp)
 			}
@@ -542,7 +561,7 @@ func TestApiRequest(t *testing.T) {
 			t.Logf("\tTesting %d %s call(s)", maxReq, call)
 			numReq = 0
 			start := time.Now()
-			resp, err := apih.apiRequest(call, "/", nil)
+			resp, err := apih.apiRequest(context.Background(), call, "/", nil)
 			if err != nil {
 				t.Errorf("Expected no error, got '%+v'", resp)
 			}
@@ -565,7 +584,7 @@ func TestApiRequest(t *testing.T) {
 			t.Logf("\tTesting %d %s call(s)", 1, call)
 			numReq = 0
 			start := time.Now()
-			resp, err := apih.apiRequest(call, "/rate_limit", nil)
+			resp, err := apih.apiRequest(context.Background(), call, "/rate_limit", nil)
 			if err != nil {
 				t.Errorf("Expected no error, got '%+v'", resp)
 			}
@@ -581,7 +600,7 @@ func TestApiRequest(t *testing.T) {
 
 	t.Log("drift retry - bad token")
 	{
-		_, err := apih.apiRequest("GET", "/auth_error_token", nil)
+		_, err := apih.apiRequest(context.Background(), "GET", "/auth_error_token", nil)
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -589,7 +608,7 @@ func TestApiRequest(t *testing.T) {
 
 	t.Log("drift retry - bad app")
 	{
-		_, err := apih.apiRequest("GET", "/auth_error_app", nil)
+		_, err := apih.apiRequest(context.Background(), "GET", "/auth_error_app", nil)
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -599,7 +618,7 @@ func TestApiRequest(t *testing.T) {
 
 	t.Log("exponential backoff - bad token")
 	{
-		_, err := apih.apiRequest("GET", "/auth_error_token", nil)
+		_, err := apih.apiRequest(context.Background(), "GET", "/auth_error_token", nil)
 		if err == nil {
 			t.Fatal("expected error")
 		}
@@ -607,10 +626,173 @@ func TestApiRequest(t *testing.T) {
 
 	t.Log("exponential backoff - bad app")
 	{
-		_, err := apih.apiRequest("GET", "/auth_error_app", nil)
+		_, err := apih.apiRequest(context.Background(), "GET", "/auth_error_app", nil)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+}
+
+func TestApiRequestContext(t *testing.T) {
+	t.Log("deadline during request")
+	{
+		hung := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-hung:
+			}
+		}))
+		defer server.Close()
+		defer close(hung)
+
+		apih, err := NewAPI(&Config{TokenKey: "foo", TokenApp: "bar", URL: server.URL})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err = apih.GetWithContext(ctx, "/hang")
 		if err == nil {
 			t.Fatal("expected error")
 		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got (%s)", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("request not canceled promptly (%s)", elapsed)
+		}
 	}
 
+	t.Log("cancel during exponential backoff")
+	{
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "error")
+		}))
+		defer server.Close()
+
+		apih, err := NewAPI(&Config{TokenKey: "foo", TokenApp: "bar", URL: server.URL})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		apih.EnableExponentialBackoff()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(200*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err = apih.PostWithContext(ctx, "/fail", []byte(`{}`))
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected canceled, got (%s)", err)
+		}
+		if elapsed := time.Since(start); elapsed >= time.Second {
+			t.Fatalf("backoff not canceled promptly (%s)", elapsed)
+		}
+	}
+}
+
+func connCountServer(tlsServer bool) (*httptest.Server, *int64) {
+	var conns int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		fmt.Fprintln(w, r.Method)
+	}))
+	server.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	if tlsServer {
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	return server, &conns
+}
+
+func TestApiCallConnectionReuse(t *testing.T) {
+	tests := []struct {
+		id            string
+		keepAlives    bool
+		expectedConns int64
+	}{
+		{id: "keep-alive", keepAlives: true, expectedConns: 1},
+		{id: "no keep-alive", keepAlives: false, expectedConns: 5},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			server, conns := connCountServer(true)
+			defer server.Close()
+
+			cp := x509.NewCertPool()
+			cp.AddCert(server.Certificate())
+
+			apih, err := NewAPI(&Config{
+				TokenKey:          "foo",
+				TokenApp:          "bar",
+				URL:               server.URL,
+				TLSConfig:         &tls.Config{RootCAs: cp, MinVersion: tls.VersionTLS12},
+				DisableKeepAlives: !test.keepAlives,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+
+			for i := 0; i < 5; i++ {
+				if _, err := apih.Get("/"); err != nil {
+					t.Fatalf("unexpected error (%s)", err)
+				}
+			}
+
+			if n := atomic.LoadInt64(conns); n != test.expectedConns {
+				t.Fatalf("expected %d connection(s), got %d", test.expectedConns, n)
+			}
+		})
+	}
+}
+
+func BenchmarkApiCall(b *testing.B) {
+	server, _ := connCountServer(true)
+	defer server.Close()
+
+	cp := x509.NewCertPool()
+	cp.AddCert(server.Certificate())
+
+	for _, keepAlives := range []bool{true, false} {
+		name := "keep-alive"
+		if !keepAlives {
+			name = "no-keep-alive"
+		}
+		b.Run(name, func(b *testing.B) {
+			apih, err := NewAPI(&Config{
+				TokenKey:          "foo",
+				TokenApp:          "bar",
+				URL:               server.URL,
+				TLSConfig:         &tls.Config{RootCAs: cp, MinVersion: tls.VersionTLS12},
+				DisableKeepAlives: !keepAlives,
+			})
+			if err != nil {
+				b.Fatalf("unexpected error (%s)", err)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := apih.Get("/"); err != nil {
+						b.Errorf("unexpected error (%s)", err)
+						return
+					}
+				}
+			})
+		})
+	}
 }
@@ -8,11 +8,7 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -30,203 +26,155 @@ type Maintenance struct {
 	Stop       uint        `json:"stop,omitempty"`       // uint
 }
 
+// maintenanceResource describes the maintenance window endpoint
+var maintenanceResource = RegisterResource(&Resource[Maintenance]{
+	Name:     "maintenance window",
+	Plural:   "maintenance windows",
+	Prefix:   config.MaintenancePrefix,
+	CIDRegex: config.MaintenanceCIDRegex,
+	CID:      func(o *Maintenance) string { return o.CID },
+	Tags:     func(o *Maintenance) *[]string { return &o.Tags },
+})
+
 // NewMaintenanceWindow returns a new Maintenance window (with defaults, if applicable)
 func NewMaintenanceWindow() *Maintenance {
 	return &Maintenance{}
 }
 
 // FetchMaintenanceWindow retrieves maintenance [window] with passed cid.
-func (a *API) FetchMaintenanceWindow(cid CIDType) (*Maintenance, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid maintenance window CID (none)")
-	}
-
-	var maintenanceCID string
-	if !strings.HasPrefix(*cid, config.MaintenancePrefix) {
-		maintenanceCID = fmt.Sprintf("%s/%s", config.MaintenancePrefix, *cid)
-	} else {
-		maintenanceCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.MaintenanceCIDRegex, maintenanceCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid maintenance window CID (%s)", maintenanceCID)
-	}
-
-	result, err := a.Get(maintenanceCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching maitenance window")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch maintenance window, received JSON: %s", string(result))
-	}
-
-	window := &Maintenance{}
-	if err := json.Unmarshal(result, window); err != nil {
-		return nil, errors.Wrap(err, "parsing maintenance window")
-	}
+func (a *API) FetchMaintenanceWindow(cid CIDType, opts ...CallOption) (*Maintenance, error) {
+	return a.FetchMaintenanceWindowWithContext(context.Background(), cid, opts...)
+}
 
-	return window, nil
+// FetchMaintenanceWindowWithContext is FetchMaintenanceWindow with a context for cancellation and deadlines.
+func (a *API) FetchMaintenanceWindowWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*Maintenance, error) {
+	return maintenanceResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchMaintenanceWindows retrieves all maintenance [windows] available to API Token.
-func (a *API) FetchMaintenanceWindows() (*[]Maintenance, error) {
-	result, err := a.Get(config.MaintenancePrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching maintenance windows")
-	}
-
-	var windows []Maintenance
-	if err := json.Unmarshal(result, &windows); err != nil {
-		return nil, errors.Wrap(err, "parsing maintenance windows")
-	}
+func (a *API) FetchMaintenanceWindows(opts ...CallOption) (*[]Maintenance, error) {
+	return a.FetchMaintenanceWindowsWithContext(context.Background(), opts...)
+}
 
-	return &windows, nil
+// FetchMaintenanceWindowsWithContext is FetchMaintenanceWindows with a context for cancellation and deadlines.
+func (a *API) FetchMaintenanceWindowsWithContext(ctx context.Context, opts ...CallOption) (*[]Maintenance, error) {
+	return maintenanceResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateMaintenanceWindow updates passed maintenance [window].
-func (a *API) UpdateMaintenanceWindow(cfg *Maintenance) (*Maintenance, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid maintenance window config (nil)")
-	}
-
-	maintenanceCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.MaintenanceCIDRegex, maintenanceCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid maintenance window CID (%s)", maintenanceCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update maintenance window, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) UpdateMaintenanceWindow(cfg *Maintenance, opts ...CallOption) (*Maintenance, error) {
+	return a.UpdateMaintenanceWindowWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Put(maintenanceCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "parsing maintenance window")
-	}
+// UpdateMaintenanceWindowWithContext is UpdateMaintenanceWindow with a context for cancellation and deadlines.
+func (a *API) UpdateMaintenanceWindowWithContext(ctx context.Context, cfg *Maintenance, opts ...CallOption) (*Maintenance, error) {
+	return maintenanceResource.Update(ctx, a, cfg, opts...)
+}
 
-	window := &Maintenance{}
-	if err := json.Unmarshal(result, window); err != nil {
-		return nil, err
-	}
+// PatchMaintenanceWindow applies patch (see Patcher) to the maintenance window with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchMaintenanceWindow(cid CIDType, patch Patcher, opts ...CallOption) (*Maintenance, error) {
+	return a.PatchMaintenanceWindowWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return window, nil
+// PatchMaintenanceWindowWithContext is PatchMaintenanceWindow with a context for cancellation and deadlines.
+func (a *API) PatchMaintenanceWindowWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*Maintenance, error) {
+	return maintenanceResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateMaintenanceWindow creates a new maintenance [window].
-func (a *API) CreateMaintenanceWindow(cfg *Maintenance) (*Maintenance, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid maintenance window config (nil)")
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create maintenance window, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Post(config.MaintenancePrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating maintenance window")
-	}
-
-	window := &Maintenance{}
-	if err := json.Unmarshal(result, window); err != nil {
-		return nil, errors.Wrap(err, "parsing maintenance window")
-	}
+func (a *API) CreateMaintenanceWindow(cfg *Maintenance, opts ...CallOption) (*Maintenance, error) {
+	return a.CreateMaintenanceWindowWithContext(context.Background(), cfg, opts...)
+}
 
-	return window, nil
+// CreateMaintenanceWindowWithContext is CreateMaintenanceWindow with a context for cancellation and deadlines.
+func (a *API) CreateMaintenanceWindowWithContext(ctx context.Context, cfg *Maintenance, opts ...CallOption) (*Maintenance, error) {
+	return maintenanceResource.Create(ctx, a, cfg, opts...)
 }
 
 // DeleteMaintenanceWindow deletes passed maintenance [window].
-func (a *API) DeleteMaintenanceWindow(cfg *Maintenance) (bool, error) {
+func (a *API) DeleteMaintenanceWindow(cfg *Maintenance, opts ...CallOption) (bool, error) {
+	return a.DeleteMaintenanceWindowWithContext(context.Background(), cfg, opts...)
+}
+
+// DeleteMaintenanceWindowWithContext is DeleteMaintenanceWindow with a context for cancellation and deadlines.
+func (a *API) DeleteMaintenanceWindowWithContext(ctx context.Context, cfg *Maintenance, opts ...CallOption) (bool, error) {
 	if cfg == nil {
 		return false, errors.New("invalid maintenance window config (nil)")
 	}
-	return a.DeleteMaintenanceWindowByCID(CIDType(&cfg.CID))
+	return a.DeleteMaintenanceWindowByCIDWithContext(ctx, CIDType(&cfg.CID), opts...)
 }
 
 // DeleteMaintenanceWindowByCID deletes maintenance [window] with passed cid.
-func (a *API) DeleteMaintenanceWindowByCID(cid CIDType) (bool, error) {
-	if cid == nil || *cid == "" {
-		return false, errors.New("invalid maintenance window CID (none)")
-	}
-
-	var maintenanceCID string
-	if !strings.HasPrefix(*cid, config.MaintenancePrefix) {
-		maintenanceCID = fmt.Sprintf("%s/%s", config.MaintenancePrefix, *cid)
-	} else {
-		maintenanceCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.MaintenanceCIDRegex, maintenanceCID)
-	if err != nil {
-		return false, err
-	}
-	if !matched {
-		return false, errors.Errorf("invalid maintenance window CID (%s)", maintenanceCID)
-	}
-
-	_, err = a.Delete(maintenanceCID)
-	if err != nil {
-		return false, errors.Wrap(err, "deleting maintenance window")
-	}
+func (a *API) DeleteMaintenanceWindowByCID(cid CIDType, opts ...CallOption) (bool, error) {
+	return a.DeleteMaintenanceWindowByCIDWithContext(context.Background(), cid, opts...)
+}
 
-	return true, nil
+// DeleteMaintenanceWindowByCIDWithContext is DeleteMaintenanceWindowByCID with a context for cancellation and deadlines.
+func (a *API) DeleteMaintenanceWindowByCIDWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (bool, error) {
+	return maintenanceResource.Delete(ctx, a, cid, opts...)
 }
 
 // SearchMaintenanceWindows returns maintenance [windows] matching
 // the specified search query and/or filter. If nil is passed for
 // both parameters all maintenance [windows] will be returned.
-func (a *API) SearchMaintenanceWindows(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]Maintenance, error) {
-	q := url.Values{}
+func (a *API) SearchMaintenanceWindows(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Maintenance, error) {
+	return a.SearchMaintenanceWindowsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
+// SearchMaintenanceWindowsWithContext is SearchMaintenanceWindows with a context for cancellation and deadlines.
+func (a *API) SearchMaintenanceWindowsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Maintenance, error) {
+	return maintenanceResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
+// IterateMaintenanceWindows calls fn for each maintenance window matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateMaintenanceWindows(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Maintenance) error) error {
+	return a.IterateMaintenanceWindowsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	if q.Encode() == "" {
-		return a.FetchMaintenanceWindows()
-	}
+// IterateMaintenanceWindowsWithContext is IterateMaintenanceWindows with a context for cancellation and deadlines.
+func (a *API) IterateMaintenanceWindowsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Maintenance) error) error {
+	return maintenanceResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	reqURL := url.URL{
-		Path:     config.MaintenancePrefix,
-		RawQuery: q.Encode(),
-	}
+// BulkCreateMaintenanceWindows creates maintenance windows concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateMaintenanceWindows(cfgs []*Maintenance, opts *BulkOptions) BulkResults[*Maintenance] {
+	return a.BulkCreateMaintenanceWindowsWithContext(context.Background(), cfgs, opts)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching maintenance windows")
-	}
+// BulkCreateMaintenanceWindowsWithContext is BulkCreateMaintenanceWindows with a context for cancellation and deadlines.
+func (a *API) BulkCreateMaintenanceWindowsWithContext(ctx context.Context, cfgs []*Maintenance, opts *BulkOptions) BulkResults[*Maintenance] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Maintenance) (*Maintenance, error) {
+		return a.CreateMaintenanceWindowWithContext(ctx, cfg)
+	})
+}
 
-	var windows []Maintenance
-	if err := json.Unmarshal(result, &windows); err != nil {
-		return nil, errors.Wrap(err, "parsing maintenance windows")
-	}
+// BulkUpdateMaintenanceWindows updates maintenance windows concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateMaintenanceWindows(cfgs []*Maintenance, opts *BulkOptions) BulkResults[*Maintenance] {
+	return a.BulkUpdateMaintenanceWindowsWithContext(context.Background(), cfgs, opts)
+}
+
+// BulkUpdateMaintenanceWindowsWithContext is BulkUpdateMaintenanceWindows with a context for cancellation and deadlines.
+func (a *API) BulkUpdateMaintenanceWindowsWithContext(ctx context.Context, cfgs []*Maintenance, opts *BulkOptions) BulkResults[*Maintenance] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Maintenance) (*Maintenance, error) {
+		return a.UpdateMaintenanceWindowWithContext(ctx, cfg)
+	})
+}
+
+// BulkDeleteMaintenanceWindows deletes maintenance windows by cid concurrently (see BulkOptions),
+// the results are in the same order as cids.
+func (a *API) BulkDeleteMaintenanceWindows(cids []string, opts *BulkOptions) BulkResults[bool] {
+	return a.BulkDeleteMaintenanceWindowsWithContext(context.Background(), cids, opts)
+}
 
-	return &windows, nil
+// BulkDeleteMaintenanceWindowsWithContext is BulkDeleteMaintenanceWindows with a context for cancellation and deadlines.
+func (a *API) BulkDeleteMaintenanceWindowsWithContext(ctx context.Context, cids []string, opts *BulkOptions) BulkResults[bool] {
+	return Bulk(ctx, cids, opts, func(ctx context.Context, cid string) (bool, error) {
+		return a.DeleteMaintenanceWindowByCIDWithContext(ctx, CIDType(&cid))
+	})
 }
@@ -9,14 +9,9 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
-	"github.com/pkg/errors"
 )
 
 // Metric defines a metric. See https://login.circonus.com/resources/api/calls/metric for more information.
@@ -38,133 +33,90 @@ type Metric struct {
 	// Units          *string  `json:"units,omitempty"`         // string or null
 }
 
+// metricResource describes the metric endpoint
+var metricResource = RegisterResource(&Resource[Metric]{
+	Name:     "metric",
+	Plural:   "metrics",
+	Prefix:   config.MetricPrefix,
+	CIDRegex: config.MetricCIDRegex,
+	CID:      func(o *Metric) string { return o.CID },
+})
+
 // FetchMetric retrieves metric with passed cid.
-func (a *API) FetchMetric(cid CIDType) (*Metric, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid metric CID (none)")
-	}
-
-	var metricCID string
-	if !strings.HasPrefix(*cid, config.MetricPrefix) {
-		metricCID = fmt.Sprintf("%s/%s", config.MetricPrefix, *cid)
-	} else {
-		metricCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.MetricCIDRegex, metricCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid metric CID (%s)", metricCID)
-	}
-
-	result, err := a.Get(metricCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching metric")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch metric, received JSON: %s", string(result))
-	}
-
-	metric := &Metric{}
-	if err := json.Unmarshal(result, metric); err != nil {
-		return nil, errors.Wrap(err, "parsing metric")
-	}
-
-	return metric, nil
+func (a *API) FetchMetric(cid CIDType, opts ...CallOption) (*Metric, error) {
+	return a.FetchMetricWithContext(context.Background(), cid, opts...)
+}
+
+// FetchMetricWithContext is FetchMetric with a context for cancellation and deadlines.
+func (a *API) FetchMetricWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*Metric, error) {
+	return metricResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchMetrics retrieves all metrics available to API Token.
-func (a *API) FetchMetrics() (*[]Metric, error) {
-	result, err := a.Get(config.MetricPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching metrics")
-	}
-
-	var metrics []Metric
-	if err := json.Unmarshal(result, &metrics); err != nil {
-		return nil, errors.Wrap(err, "parsing metrics")
-	}
-
-	return &metrics, nil
+func (a *API) FetchMetrics(opts ...CallOption) (*[]Metric, error) {
+	return a.FetchMetricsWithContext(context.Background(), opts...)
+}
+
+// FetchMetricsWithContext is FetchMetrics with a context for cancellation and deadlines.
+func (a *API) FetchMetricsWithContext(ctx context.Context, opts ...CallOption) (*[]Metric, error) {
+	return metricResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateMetric updates passed metric.
-func (a *API) UpdateMetric(cfg *Metric) (*Metric, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid metric config (nil)")
-	}
-
-	metricCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.MetricCIDRegex, metricCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid metric CID (%s)", metricCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update metric, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Put(metricCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating metric")
-	}
-
-	metric := &Metric{}
-	if err := json.Unmarshal(result, metric); err != nil {
-		return nil, errors.Wrap(err, "parsing metric")
-	}
-
-	return metric, nil
+func (a *API) UpdateMetric(cfg *Metric, opts ...CallOption) (*Metric, error) {
+	return a.UpdateMetricWithContext(context.Background(), cfg, opts...)
+}
+
+// UpdateMetricWithContext is UpdateMetric with a context for cancellation and deadlines.
+func (a *API) UpdateMetricWithContext(ctx context.Context, cfg *Metric, opts ...CallOption) (*Metric, error) {
+	return metricResource.Update(ctx, a, cfg, opts...)
+}
+
+// PatchMetric applies patch (see Patcher) to the metric with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchMetric(cid CIDType, patch Patcher, opts ...CallOption) (*Metric, error) {
+	return a.PatchMetricWithContext(context.Background(), cid, patch, opts...)
+}
+
+// PatchMetricWithContext is PatchMetric with a context for cancellation and deadlines.
+func (a *API) PatchMetricWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*Metric, error) {
+	return metricResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // SearchMetrics returns metrics matching the specified search query
 // and/or filter. If nil is passed for both parameters all metrics
 // will be returned.
-func (a *API) SearchMetrics(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]Metric, error) {
-	q := url.Values{}
-
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
-
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
-
-	if q.Encode() == "" {
-		return a.FetchMetrics()
-	}
-
-	reqURL := url.URL{
-		Path:     config.MetricPrefix,
-		RawQuery: q.Encode(),
-	}
-
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching metrics")
-	}
-
-	var metrics []Metric
-	if err := json.Unmarshal(result, &metrics); err != nil {
-		return nil, errors.Wrap(err, "parsing metrics")
-	}
-
-	return &metrics, nil
+func (a *API) SearchMetrics(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Metric, error) {
+	return a.SearchMetricsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
+
+// SearchMetricsWithContext is SearchMetrics with a context for cancellation and deadlines.
+func (a *API) SearchMetricsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Metric, error) {
+	return metricResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
+
+// IterateMetrics calls fn for each metric matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateMetrics(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Metric) error) error {
+	return a.IterateMetricsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
+
+// IterateMetricsWithContext is IterateMetrics with a context for cancellation and deadlines.
+func (a *API) IterateMetricsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Metric) error) error {
+	return metricResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
+
+// BulkUpdateMetrics updates metrics concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateMetrics(cfgs []*Metric, opts *BulkOptions) BulkResults[*Metric] {
+	return a.BulkUpdateMetricsWithContext(context.Background(), cfgs, opts)
+}
+
+// BulkUpdateMetricsWithContext is BulkUpdateMetrics with a context for cancellation and deadlines.
+func (a *API) BulkUpdateMetricsWithContext(ctx context.Context, cfgs []*Metric, opts *BulkOptions) BulkResults[*Metric] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Metric) (*Metric, error) {
+		return a.UpdateMetricWithContext(ctx, cfg)
+	})
 }
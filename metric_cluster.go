@@ -8,11 +8,7 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -35,239 +31,168 @@ type MetricCluster struct {
 	Tags                []string            `json:"tags"`                             // [] len >= 0
 }
 
+// metricClusterResource describes the metric cluster endpoint
+var metricClusterResource = RegisterResource(&Resource[MetricCluster]{
+	Name:     "metric cluster",
+	Plural:   "metric clusters",
+	Prefix:   config.MetricClusterPrefix,
+	CIDRegex: config.MetricClusterCIDRegex,
+	CID:      func(o *MetricCluster) string { return o.CID },
+	Tags:     func(o *MetricCluster) *[]string { return &o.Tags },
+})
+
 // NewMetricCluster returns a new MetricCluster (with defaults, if applicable)
 func NewMetricCluster() *MetricCluster {
 	return &MetricCluster{}
 }
 
 // FetchMetricCluster retrieves metric cluster with passed cid.
-func (a *API) FetchMetricCluster(cid CIDType, extras string) (*MetricCluster, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid metric cluster CID (none)")
-	}
-
-	var clusterCID string
-	if !strings.HasPrefix(*cid, config.MetricClusterPrefix) {
-		clusterCID = fmt.Sprintf("%s/%s", config.MetricClusterPrefix, *cid)
-	} else {
-		clusterCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.MetricClusterCIDRegex, clusterCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid metric cluster CID (%s)", clusterCID)
-	}
-
-	reqURL := url.URL{
-		Path: clusterCID,
-	}
-
-	extra := ""
-	switch extras {
-	case "metrics":
-		extra = "_matching_metrics"
-	case "uuids":
-		extra = "_matching_uuid_metrics"
-	}
-
-	if extra != "" {
-		q := url.Values{}
-		q.Set("extra", extra)
-		reqURL.RawQuery = q.Encode()
-	}
-
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching metric cluster")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch metric cluster, received JSON: %s", string(result))
-	}
-
-	cluster := &MetricCluster{}
-	if err := json.Unmarshal(result, cluster); err != nil {
-		return nil, errors.Wrap(err, "parsing metric cluster")
-	}
+func (a *API) FetchMetricCluster(cid CIDType, extras string, opts ...CallOption) (*MetricCluster, error) {
+	return a.FetchMetricClusterWithContext(context.Background(), cid, extras, opts...)
+}
 
-	return cluster, nil
+// FetchMetricClusterWithContext is FetchMetricCluster with a context for cancellation and deadlines.
+func (a *API) FetchMetricClusterWithContext(ctx context.Context, cid CIDType, extras string, opts ...CallOption) (*MetricCluster, error) {
+	return metricClusterResource.Fetch(ctx, a, cid, append(metricClusterExtras(extras), opts...)...)
 }
 
 // FetchMetricClusters retrieves all metric clusters available to API Token.
-func (a *API) FetchMetricClusters(extras string) (*[]MetricCluster, error) {
-	reqURL := url.URL{
-		Path: config.MetricClusterPrefix,
-	}
+func (a *API) FetchMetricClusters(extras string, opts ...CallOption) (*[]MetricCluster, error) {
+	return a.FetchMetricClustersWithContext(context.Background(), extras, opts...)
+}
 
-	extra := ""
+// FetchMetricClustersWithContext is FetchMetricClusters with a context for cancellation and deadlines.
+func (a *API) FetchMetricClustersWithContext(ctx context.Context, extras string, opts ...CallOption) (*[]MetricCluster, error) {
+	return metricClusterResource.FetchAll(ctx, a, append(metricClusterExtras(extras), opts...)...)
+}
+
+// metricClusterExtras returns the option requesting the matching metrics
+// ("metrics") or metric uuids ("uuids") with metric clusters
+func metricClusterExtras(extras string) []CallOption {
 	switch extras {
 	case "metrics":
-		extra = "_matching_metrics"
+		return []CallOption{WithQueryParam("extra", "_matching_metrics")}
 	case "uuids":
-		extra = "_matching_uuid_metrics"
-	}
-
-	if extra != "" {
-		q := url.Values{}
-		q.Set("extra", extra)
-		reqURL.RawQuery = q.Encode()
-	}
-
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching metric clusters")
-	}
-
-	var clusters []MetricCluster
-	if err := json.Unmarshal(result, &clusters); err != nil {
-		return nil, errors.Wrap(err, "parsing metric clusters")
+		return []CallOption{WithQueryParam("extra", "_matching_uuid_metrics")}
+	default:
+		return nil
 	}
-
-	return &clusters, nil
 }
 
 // UpdateMetricCluster updates passed metric cluster.
-func (a *API) UpdateMetricCluster(cfg *MetricCluster) (*MetricCluster, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid metric cluster config (nil)")
-	}
-
-	clusterCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.MetricClusterCIDRegex, clusterCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid metric cluster CID (%s)", clusterCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update metric cluster, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) UpdateMetricCluster(cfg *MetricCluster, opts ...CallOption) (*MetricCluster, error) {
+	return a.UpdateMetricClusterWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Put(clusterCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating metric cluster")
-	}
+// UpdateMetricClusterWithContext is UpdateMetricCluster with a context for cancellation and deadlines.
+func (a *API) UpdateMetricClusterWithContext(ctx context.Context, cfg *MetricCluster, opts ...CallOption) (*MetricCluster, error) {
+	return metricClusterResource.Update(ctx, a, cfg, opts...)
+}
 
-	cluster := &MetricCluster{}
-	if err := json.Unmarshal(result, cluster); err != nil {
-		return nil, errors.Wrap(err, "parsing metric cluster")
-	}
+// PatchMetricCluster applies patch (see Patcher) to the metric cluster with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchMetricCluster(cid CIDType, patch Patcher, opts ...CallOption) (*MetricCluster, error) {
+	return a.PatchMetricClusterWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return cluster, nil
+// PatchMetricClusterWithContext is PatchMetricCluster with a context for cancellation and deadlines.
+func (a *API) PatchMetricClusterWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*MetricCluster, error) {
+	return metricClusterResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateMetricCluster creates a new metric cluster.
-func (a *API) CreateMetricCluster(cfg *MetricCluster) (*MetricCluster, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid metric cluster config (nil)")
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create metric cluster, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Post(config.MetricClusterPrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating metric cluster")
-	}
-
-	cluster := &MetricCluster{}
-	if err := json.Unmarshal(result, cluster); err != nil {
-		return nil, errors.Wrap(err, "parsing metric cluster")
-	}
+func (a *API) CreateMetricCluster(cfg *MetricCluster, opts ...CallOption) (*MetricCluster, error) {
+	return a.CreateMetricClusterWithContext(context.Background(), cfg, opts...)
+}
 
-	return cluster, nil
+// CreateMetricClusterWithContext is CreateMetricCluster with a context for cancellation and deadlines.
+func (a *API) CreateMetricClusterWithContext(ctx context.Context, cfg *MetricCluster, opts ...CallOption) (*MetricCluster, error) {
+	return metricClusterResource.Create(ctx, a, cfg, opts...)
 }
 
 // DeleteMetricCluster deletes passed metric cluster.
-func (a *API) DeleteMetricCluster(cfg *MetricCluster) (bool, error) {
+func (a *API) DeleteMetricCluster(cfg *MetricCluster, opts ...CallOption) (bool, error) {
+	return a.DeleteMetricClusterWithContext(context.Background(), cfg, opts...)
+}
+
+// DeleteMetricClusterWithContext is DeleteMetricCluster with a context for cancellation and deadlines.
+func (a *API) DeleteMetricClusterWithContext(ctx context.Context, cfg *MetricCluster, opts ...CallOption) (bool, error) {
 	if cfg == nil {
 		return false, errors.New("invalid metric cluster config (nil)")
 	}
-	return a.DeleteMetricClusterByCID(CIDType(&cfg.CID))
+	return a.DeleteMetricClusterByCIDWithContext(ctx, CIDType(&cfg.CID), opts...)
 }
 
 // DeleteMetricClusterByCID deletes metric cluster with passed cid.
-func (a *API) DeleteMetricClusterByCID(cid CIDType) (bool, error) {
-	if cid == nil || *cid == "" {
-		return false, errors.New("invalid metric cluster CID (none)")
-	}
-
-	var clusterCID string
-	if !strings.HasPrefix(*cid, config.MetricClusterPrefix) {
-		clusterCID = fmt.Sprintf("%s/%s", config.MetricClusterPrefix, *cid)
-	} else {
-		clusterCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.MetricClusterCIDRegex, clusterCID)
-	if err != nil {
-		return false, err
-	}
-	if !matched {
-		return false, errors.Errorf("invalid metric cluster CID (%s)", clusterCID)
-	}
-
-	_, err = a.Delete(clusterCID)
-	if err != nil {
-		return false, errors.Wrap(err, "deleting metric cluster")
-	}
+func (a *API) DeleteMetricClusterByCID(cid CIDType, opts ...CallOption) (bool, error) {
+	return a.DeleteMetricClusterByCIDWithContext(context.Background(), cid, opts...)
+}
 
-	return true, nil
+// DeleteMetricClusterByCIDWithContext is DeleteMetricClusterByCID with a context for cancellation and deadlines.
+func (a *API) DeleteMetricClusterByCIDWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (bool, error) {
+	return metricClusterResource.Delete(ctx, a, cid, opts...)
 }
 
 // SearchMetricClusters returns metric clusters matching the specified
 // search query and/or filter. If nil is passed for both parameters
 // all metric clusters will be returned.
-func (a *API) SearchMetricClusters(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]MetricCluster, error) {
-	q := url.Values{}
+func (a *API) SearchMetricClusters(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]MetricCluster, error) {
+	return a.SearchMetricClustersWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
+// SearchMetricClustersWithContext is SearchMetricClusters with a context for cancellation and deadlines.
+func (a *API) SearchMetricClustersWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]MetricCluster, error) {
+	return metricClusterResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
+// IterateMetricClusters calls fn for each metric cluster matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateMetricClusters(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*MetricCluster) error) error {
+	return a.IterateMetricClustersWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	if q.Encode() == "" {
-		return a.FetchMetricClusters("")
-	}
+// IterateMetricClustersWithContext is IterateMetricClusters with a context for cancellation and deadlines.
+func (a *API) IterateMetricClustersWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*MetricCluster) error) error {
+	return metricClusterResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	reqURL := url.URL{
-		Path:     config.MetricClusterPrefix,
-		RawQuery: q.Encode(),
-	}
+// BulkCreateMetricClusters creates metric clusters concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateMetricClusters(cfgs []*MetricCluster, opts *BulkOptions) BulkResults[*MetricCluster] {
+	return a.BulkCreateMetricClustersWithContext(context.Background(), cfgs, opts)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching metric clusters")
-	}
+// BulkCreateMetricClustersWithContext is BulkCreateMetricClusters with a context for cancellation and deadlines.
+func (a *API) BulkCreateMetricClustersWithContext(ctx context.Context, cfgs []*MetricCluster, opts *BulkOptions) BulkResults[*MetricCluster] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *MetricCluster) (*MetricCluster, error) {
+		return a.CreateMetricClusterWithContext(ctx, cfg)
+	})
+}
 
-	var clusters []MetricCluster
-	if err := json.Unmarshal(result, &clusters); err != nil {
-		return nil, errors.Wrap(err, "parsing metric clusters")
-	}
+// BulkUpdateMetricClusters updates metric clusters concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateMetricClusters(cfgs []*MetricCluster, opts *BulkOptions) BulkResults[*MetricCluster] {
+	return a.BulkUpdateMetricClustersWithContext(context.Background(), cfgs, opts)
+}
+
+// BulkUpdateMetricClustersWithContext is BulkUpdateMetricClusters with a context for cancellation and deadlines.
+func (a *API) BulkUpdateMetricClustersWithContext(ctx context.Context, cfgs []*MetricCluster, opts *BulkOptions) BulkResults[*MetricCluster] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *MetricCluster) (*MetricCluster, error) {
+		return a.UpdateMetricClusterWithContext(ctx, cfg)
+	})
+}
+
+// BulkDeleteMetricClusters deletes metric clusters by cid concurrently (see BulkOptions),
+// the results are in the same order as cids.
+func (a *API) BulkDeleteMetricClusters(cids []string, opts *BulkOptions) BulkResults[bool] {
+	return a.BulkDeleteMetricClustersWithContext(context.Background(), cids, opts)
+}
 
-	return &clusters, nil
+// BulkDeleteMetricClustersWithContext is BulkDeleteMetricClusters with a context for cancellation and deadlines.
+func (a *API) BulkDeleteMetricClustersWithContext(ctx context.Context, cids []string, opts *BulkOptions) BulkResults[bool] {
+	return Bulk(ctx, cids, opts, func(ctx context.Context, cid string) (bool, error) {
+		return a.DeleteMetricClusterByCIDWithContext(ctx, CIDType(&cid))
+	})
 }
@@ -0,0 +1,97 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Middleware wraps the http.RoundTripper used for every request the API makes,
+// including each retry. A middleware may inspect or modify the request (method,
+// URL, headers, body) before calling next, and the response after. Per the
+// http.RoundTripper contract, clone the request (req.Clone) before modifying it.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts an ordinary function to an http.RoundTripper
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req)
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// chainMiddleware wraps rt so that mw[0] is the outermost middleware
+func chainMiddleware(rt http.RoundTripper, mw []Middleware) http.RoundTripper {
+	for i := len(mw) - 1; i >= 0; i-- {
+		if mw[i] != nil {
+			rt = mw[i](rt)
+		}
+	}
+	return rt
+}
+
+// RequestBody returns a copy of the request body without consuming it, for use in middleware.
+func RequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody == nil {
+		return nil, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// HeaderMiddleware adds headers to every request, replacing any existing values.
+func HeaderMiddleware(headers http.Header) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			r := req.Clone(req.Context())
+			for k, v := range headers {
+				r.Header[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+			}
+			return next.RoundTrip(r)
+		})
+	}
+}
+
+// RequestTiming describes a single request attempt, passed to TimingMiddleware callbacks
+type RequestTiming struct {
+	Start      time.Time
+	Err        error
+	Method     string
+	URL        string
+	Duration   time.Duration
+	StatusCode int
+}
+
+// TimingMiddleware calls fn after every request attempt with its timing. The
+// duration covers the round trip until the response headers are received.
+func TimingMiddleware(fn func(RequestTiming)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			t := RequestTiming{
+				Start:    start,
+				Duration: time.Since(start),
+				Method:   req.Method,
+				URL:      req.URL.String(),
+				Err:      err,
+			}
+			if resp != nil {
+				t.StatusCode = resp.StatusCode
+			}
+			fn(t)
+			return resp, err
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func echoServer() *httptest.Server {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.Path, r.Header.Get("X-Custom"))
+	}
+
+	return httptest.NewServer(http.HandlerFunc(f))
+}
+
+func TestMiddleware(t *testing.T) {
+	server := echoServer()
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var bodies []string
+	var timings []RequestTiming
+
+	trace := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				body, err := RequestBody(req)
+				if err != nil {
+					return nil, err
+				}
+				mu.Lock()
+				order = append(order, name)
+				if name == "first" {
+					bodies = append(bodies, string(body))
+				}
+				mu.Unlock()
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	// rewrite requests for an unreachable host to the test server, e.g. for an internal proxy
+	rewrite := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			r := req.Clone(req.Context())
+			r.URL.Scheme = serverURL.Scheme
+			r.URL.Host = serverURL.Host
+			r.Host = serverURL.Host
+			return next.RoundTrip(r)
+		})
+	}
+
+	apih, err := NewAPI(&Config{
+		TokenKey: "foo",
+		TokenApp: "bar",
+		URL:      "http://api.invalid/v2",
+		Middleware: []Middleware{
+			trace("first"),
+			HeaderMiddleware(http.Header{"x-custom": []string{"injected"}}),
+			TimingMiddleware(func(rt RequestTiming) {
+				mu.Lock()
+				timings = append(timings, rt)
+				mu.Unlock()
+			}),
+			trace("last"),
+			rewrite,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	resp, err := apih.Post("/check_bundle", []byte(`{"foo":"bar"}`))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if expected := "POST /v2/check_bundle injected"; string(resp) != expected {
+		t.Fatalf("expected %q, got %q", expected, string(resp))
+	}
+	if strings.Join(order, ",") != "first,last" {
+		t.Fatalf("unexpected middleware order %v", order)
+	}
+	if len(bodies) != 1 || bodies[0] != `{"foo":"bar"}` {
+		t.Fatalf("unexpected bodies %v", bodies)
+	}
+	if len(timings) != 1 {
+		t.Fatalf("expected 1 timing, got %d", len(timings))
+	}
+	if timings[0].Method != "POST" || timings[0].StatusCode != 200 || timings[0].URL != "http://api.invalid/v2/check_bundle" || timings[0].Duration <= 0 {
+		t.Fatalf("unexpected timing %#v", timings[0])
+	}
+}
+
+func TestRequestBodyEmpty(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	body, err := RequestBody(req)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if body != nil {
+		t.Fatalf("expected nil body, got %q", body)
+	}
+}
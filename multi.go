@@ -0,0 +1,178 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// MultiAPI holds an API per account, for running calls across all of them (see FanOut)
+type MultiAPI struct {
+	apis     map[string]*API
+	accounts []string
+}
+
+// NewMultiAPI returns a MultiAPI with an API for each named account config
+func NewMultiAPI(configs map[string]*Config) (*MultiAPI, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("invalid multi account configuration (none)")
+	}
+
+	m := &MultiAPI{apis: make(map[string]*API, len(configs))}
+	for name, cfg := range configs {
+		a, err := New(cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "account %s", name)
+		}
+		m.apis[name] = a
+		m.accounts = append(m.accounts, name)
+	}
+	sort.Strings(m.accounts)
+
+	return m, nil
+}
+
+// NewMultiAPIFromProfiles returns a MultiAPI with an API for each named profile (see ConfigFromProfile)
+func NewMultiAPIFromProfiles(profiles ...string) (*MultiAPI, error) {
+	configs := make(map[string]*Config, len(profiles))
+	for _, name := range profiles {
+		cfg, err := ConfigFromProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		configs[name] = cfg
+	}
+	return NewMultiAPI(configs)
+}
+
+// Accounts returns the account names, sorted
+func (m *MultiAPI) Accounts() []string {
+	return append([]string(nil), m.accounts...)
+}
+
+// API returns the API for an account, nil if there is no such account
+func (m *MultiAPI) API(account string) *API {
+	return m.apis[account]
+}
+
+// AccountResult is the result of a call for one account
+type AccountResult[T any] struct {
+	Value   T
+	Err     error
+	Account string
+}
+
+// AccountResults are the results of a call for every account, in account order
+type AccountResults[T any] []AccountResult[T]
+
+// Err returns a *MultiError with an *AccountError for each failed account, nil
+// if the call succeeded for all accounts
+func (r AccountResults[T]) Err() error {
+	var errs MultiError
+	for _, res := range r {
+		if res.Err != nil {
+			errs = append(errs, &AccountError{Account: res.Account, Err: res.Err})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &errs
+}
+
+// Succeeded returns the results for accounts where the call succeeded
+func (r AccountResults[T]) Succeeded() AccountResults[T] {
+	var ok AccountResults[T]
+	for _, res := range r {
+		if res.Err == nil {
+			ok = append(ok, res)
+		}
+	}
+	return ok
+}
+
+// FanOut runs fn concurrently with the API of every account and returns the
+// results tagged with their account. A failure for one account does not stop
+// the others, use AccountResults.Err for partial failures. For example, check
+// bundles targeting a host in any account:
+//
+//	query := apiclient.SearchQueryType(`(host:"web01")`)
+//	results := apiclient.FanOut(ctx, multi, func(ctx context.Context, a *apiclient.API) (*[]apiclient.CheckBundle, error) {
+//		return a.SearchCheckBundlesWithContext(ctx, &query, nil)
+//	})
+func FanOut[T any](ctx context.Context, m *MultiAPI, fn func(ctx context.Context, a *API) (T, error)) AccountResults[T] {
+	results := make(AccountResults[T], len(m.accounts))
+
+	var wg sync.WaitGroup
+	for i, name := range m.accounts {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i].Account = name
+			results[i].Value, results[i].Err = fn(ctx, m.apis[name])
+		}(i, name)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// AccountError is a failed call for an account
+type AccountError struct {
+	Err     error
+	Account string
+}
+
+func (e *AccountError) Error() string {
+	return fmt.Sprintf("account %s: %s", e.Account, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *AccountError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError aggregates errors, errors.Is and errors.As match any of them (with
+// the Is and As methods, the go1.20 errors package also follows Unwrap)
+type MultiError []error
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(*e))
+	for i, err := range *e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d error(s): %s", len(msgs), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the aggregated errors
+func (e *MultiError) Unwrap() []error {
+	return *e
+}
+
+// Is reports whether any of the errors matches target
+func (e *MultiError) Is(target error) bool {
+	for _, err := range *e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors matching target and sets target to it
+func (e *MultiError) As(target interface{}) bool {
+	for _, err := range *e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
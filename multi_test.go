@@ -0,0 +1,126 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// accountServer serves check bundles per account, selected by the
+// X-Circonus-Account-ID header, account "broken" fails
+func accountServer(bundles map[string][]CheckBundle) *httptest.Server {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		account := r.Header.Get("X-Circonus-Account-ID")
+		if account == "broken" {
+			w.WriteHeader(403)
+			_, _ = w.Write([]byte(`{"code":"Forbidden","message":"no access"}`))
+			return
+		}
+		search := strings.Trim(r.URL.Query().Get("search"), "()")
+		host := strings.Trim(strings.TrimPrefix(search, "host:"), `"`)
+		result := []CheckBundle{}
+		for _, b := range bundles[account] {
+			if host == "" || b.Target == host {
+				result = append(result, b)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(f))
+}
+
+func TestFanOut(t *testing.T) {
+	server := accountServer(map[string][]CheckBundle{
+		"1": {{CID: "/check_bundle/1", Target: "web01"}, {CID: "/check_bundle/2", Target: "db01"}},
+		"2": {{CID: "/check_bundle/3", Target: "db01"}},
+		"3": {{CID: "/check_bundle/4", Target: "web01"}},
+	})
+	defer server.Close()
+
+	configs := map[string]*Config{}
+	for name, id := range map[string]string{"prod": "1", "staging": "2", "dev": "3", "legacy": "broken"} {
+		configs[name] = &Config{TokenKey: "foo", TokenAccountID: id, URL: server.URL, DisableRetries: true}
+	}
+	multi, err := NewMultiAPI(configs)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if got := strings.Join(multi.Accounts(), ","); got != "dev,legacy,prod,staging" {
+		t.Fatalf("unexpected accounts (%s)", got)
+	}
+
+	query := SearchQueryType(`(host:"web01")`)
+	results := FanOut(context.Background(), multi, func(ctx context.Context, a *API) (*[]CheckBundle, error) {
+		return a.SearchCheckBundlesWithContext(ctx, &query, nil)
+	})
+
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+
+	var matched []string
+	for _, res := range results.Succeeded() {
+		for _, b := range *res.Value {
+			matched = append(matched, res.Account+":"+b.CID)
+		}
+	}
+	if got := strings.Join(matched, ","); got != "dev:/check_bundle/4,prod:/check_bundle/1" {
+		t.Fatalf("unexpected matches (%s)", got)
+	}
+
+	err = results.Err()
+	if err == nil {
+		t.Fatal("expected partial failure")
+	}
+	var acctErr *AccountError
+	if !errors.As(err, &acctErr) || acctErr.Account != "legacy" {
+		t.Fatalf("expected legacy account error, got (%v)", err)
+	}
+	if !IsForbidden(err) {
+		t.Fatalf("expected forbidden, got (%v)", err)
+	}
+	if multiErr := err.(*MultiError); len(*multiErr) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(*multiErr))
+	}
+}
+
+func TestMultiErrorIsAs(t *testing.T) {
+	errOther := errors.New("other")
+	e := &MultiError{errors.New("first"), &AccountError{Account: "prod", Err: context.Canceled}}
+
+	// called directly, errors.Is/As before go1.20 do not follow Unwrap() []error
+	if !e.Is(context.Canceled) {
+		t.Fatal("expected Is to match a wrapped error")
+	}
+	if e.Is(errOther) {
+		t.Fatal("expected Is not to match")
+	}
+	var acctErr *AccountError
+	if !e.As(&acctErr) || acctErr.Account != "prod" {
+		t.Fatalf("expected As to find the account error, got (%v)", acctErr)
+	}
+	var apiErr *APIError
+	if e.As(&apiErr) {
+		t.Fatal("expected As not to match")
+	}
+}
+
+func TestNewMultiAPI(t *testing.T) {
+	if _, err := NewMultiAPI(nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := NewMultiAPI(map[string]*Config{"bad": {}}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestInfo describes a single API request attempt
+type RequestInfo struct {
+	// Method is the HTTP method (GET, PUT, POST, DELETE)
+	Method string
+	// Path is the API path requested (e.g. /check_bundle/1234?extra=foo)
+	Path string
+	// Resource is the endpoint prefix of Path (e.g. /check_bundle)
+	Resource string
+	// Attempt is the attempt number of the request, 1 for the first attempt
+	Attempt int
+}
+
+// RequestResult is the outcome of a single API request attempt
+type RequestResult struct {
+	// Err is a transport error (or context cancellation), if any
+	Err error
+	// Duration is the time from sending the request to receiving the response headers
+	Duration time.Duration
+	// StatusCode is the HTTP status of the response, 0 if there was no response
+	StatusCode int
+}
+
+// Observer receives a callback at the start and end of every API request
+// attempt (including retries), e.g. to collect metrics or tracing spans. See the
+// promobserver and otelobserver packages for ready made observers.
+type Observer interface {
+	// RequestStart is called before the attempt is sent, the returned context is
+	// used for the attempt and passed to RequestEnd (e.g. carrying a span).
+	RequestStart(ctx context.Context, info RequestInfo) context.Context
+	// RequestEnd is called after the attempt completes.
+	RequestEnd(ctx context.Context, info RequestInfo, result RequestResult)
+}
+
+// resourcePrefix returns the endpoint prefix of an API path, e.g. /check_bundle
+// for /v2/check_bundle/1234?search=foo
+func resourcePrefix(reqPath string) string {
+	p := reqPath
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p = p[:i]
+	}
+	p = strings.TrimPrefix(p, "/")
+	if strings.HasPrefix(p, "v2/") {
+		p = p[3:]
+	}
+	if i := strings.Index(p, "/"); i >= 0 {
+		p = p[:i]
+	}
+	return "/" + p
+}
+
+// observerTransport notifies observers of every request attempt
+type observerTransport struct {
+	next      http.RoundTripper
+	observers []Observer
+}
+
+func (t *observerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	info := RequestInfo{
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Resource: resourcePrefix(req.URL.Path),
+		Attempt:  1,
+	}
+	if rs, ok := req.Context().Value(requestStateKey{}).(*requestState); ok {
+		rs.attempts++
+		info.Path = rs.path
+		info.Resource = resourcePrefix(rs.path)
+		info.Attempt = rs.attempts
+	}
+
+	ctx := req.Context()
+	ctxs := make([]context.Context, len(t.observers))
+	for i, o := range t.observers {
+		ctx = o.RequestStart(ctx, info)
+		ctxs[i] = ctx
+	}
+	if ctx != req.Context() {
+		req = req.WithContext(ctx)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	result := RequestResult{
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if resp != nil {
+		result.StatusCode = resp.StatusCode
+	}
+
+	for i := len(t.observers) - 1; i >= 0; i-- {
+		t.observers[i].RequestEnd(ctxs[i], info, result)
+	}
+
+	return resp, err
+}
+
+// requestState tracks a logical API request (apiRequest) across all of its attempts
+type requestState struct {
+	path     string
+	attempts int
+}
+
+type requestStateKey struct{}
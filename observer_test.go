@@ -0,0 +1,103 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type ctxKey string
+
+type testObserver struct {
+	starts []RequestInfo
+	ends   []RequestResult
+	mu     sync.Mutex
+}
+
+func (o *testObserver) RequestStart(ctx context.Context, info RequestInfo) context.Context {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.starts = append(o.starts, info)
+	return context.WithValue(ctx, ctxKey("attempt"), info.Attempt)
+}
+
+func (o *testObserver) RequestEnd(ctx context.Context, info RequestInfo, result RequestResult) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if ctx.Value(ctxKey("attempt")) != info.Attempt {
+		panic("context from RequestStart not passed to RequestEnd")
+	}
+	o.ends = append(o.ends, result)
+}
+
+func TestResourcePrefix(t *testing.T) {
+	tests := map[string]string{
+		"/check_bundle/1234":         "/check_bundle",
+		"/v2/check_bundle/1234":      "/check_bundle",
+		"check_bundle":               "/check_bundle",
+		"/rule_set?search=foo":       "/rule_set",
+		"/metric/1234_foo%60bar":     "/metric",
+		"/account/current":           "/account",
+		"/check_bundle_metrics/1234": "/check_bundle_metrics",
+		"/":                          "/",
+	}
+	for path, expected := range tests {
+		if r := resourcePrefix(path); r != expected {
+			t.Errorf("%s: expected %s, got %s", path, expected, r)
+		}
+	}
+}
+
+func TestObserver(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			w.WriteHeader(503)
+			fmt.Fprintln(w, "unavailable")
+			return
+		}
+		w.WriteHeader(200)
+		fmt.Fprintln(w, "{}")
+	}))
+	defer server.Close()
+
+	obs := &testObserver{}
+	apih, err := NewAPI(&Config{
+		TokenKey:      "foo",
+		TokenApp:      "bar",
+		URL:           server.URL,
+		MinRetryDelay: "1ms",
+		MaxRetryDelay: "2ms",
+		Observers:     []Observer{obs},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if _, err := apih.Get("/check_bundle/1234"); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if len(obs.starts) != 2 || len(obs.ends) != 2 {
+		t.Fatalf("expected 2 attempts, got %d starts %d ends", len(obs.starts), len(obs.ends))
+	}
+	for i, info := range obs.starts {
+		if info.Method != "GET" || info.Path != "/check_bundle/1234" || info.Resource != "/check_bundle" || info.Attempt != i+1 {
+			t.Fatalf("unexpected info %d %#v", i, info)
+		}
+	}
+	if obs.ends[0].StatusCode != 503 || obs.ends[1].StatusCode != 200 {
+		t.Fatalf("unexpected results %#v", obs.ends)
+	}
+	if obs.ends[1].Duration <= 0 {
+		t.Fatalf("expected duration, got %s", obs.ends[1].Duration)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package otelobserver provides an apiclient.Observer creating an OpenTelemetry
+// client span for every API request attempt.
+//
+//	client, err := apiclient.New(&apiclient.Config{
+//		TokenKey:  "...",
+//		Observers: []apiclient.Observer{otelobserver.New(nil)},
+//	})
+package otelobserver
+
+import (
+	"context"
+
+	apiclient "github.com/circonus-labs/go-apiclient"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/circonus-labs/go-apiclient"
+
+// Observer creates a span for every API request attempt
+type Observer struct {
+	tracer trace.Tracer
+}
+
+var _ apiclient.Observer = (*Observer)(nil)
+
+// New returns an Observer using tp, if tp is nil the global TracerProvider is used
+func New(tp trace.TracerProvider) *Observer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Observer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// RequestStart starts a client span, a child of any span in ctx
+func (o *Observer) RequestStart(ctx context.Context, info apiclient.RequestInfo) context.Context {
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", info.Method),
+		attribute.String("circonus.api.resource", info.Resource),
+		attribute.String("circonus.api.path", info.Path),
+	}
+	if info.Attempt > 1 {
+		attrs = append(attrs, attribute.Int("http.request.resend_count", info.Attempt-1))
+	}
+	ctx, _ = o.tracer.Start(ctx, "Circonus API "+info.Method+" "+info.Resource,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+	return ctx
+}
+
+// RequestEnd records the response status, or error, and ends the span
+func (o *Observer) RequestEnd(ctx context.Context, info apiclient.RequestInfo, result apiclient.RequestResult) {
+	span := trace.SpanFromContext(ctx)
+	if result.StatusCode > 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", result.StatusCode))
+	}
+	switch {
+	case result.Err != nil:
+		span.RecordError(result.Err)
+		span.SetStatus(codes.Error, result.Err.Error())
+	case result.StatusCode >= 400:
+		span.SetStatus(codes.Error, "")
+	}
+	span.End()
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package otelobserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	apiclient "github.com/circonus-labs/go-apiclient"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestObserver(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "error")
+			return
+		}
+		w.WriteHeader(200)
+		fmt.Fprintln(w, "{}")
+	}))
+	defer server.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	apih, err := apiclient.New(&apiclient.Config{
+		TokenKey:      "foo",
+		URL:           server.URL,
+		MinRetryDelay: "1ms",
+		MaxRetryDelay: "2ms",
+		Observers:     []apiclient.Observer{New(tp)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if _, err := apih.GetWithContext(ctx, "/graph/abc"); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+
+	for i, span := range spans[:2] {
+		if span.Name() != "Circonus API GET /graph" {
+			t.Fatalf("unexpected span name %q", span.Name())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("span %d not a child of parent", i)
+		}
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range span.Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		if attrs["circonus.api.resource"].AsString() != "/graph" {
+			t.Fatalf("unexpected resource %v", attrs["circonus.api.resource"])
+		}
+		if i == 0 {
+			if attrs["http.response.status_code"].AsInt64() != 500 || span.Status().Code != codes.Error {
+				t.Fatalf("expected 500 error span, got %v %v", attrs["http.response.status_code"], span.Status())
+			}
+		} else {
+			if attrs["http.response.status_code"].AsInt64() != 200 || span.Status().Code == codes.Error {
+				t.Fatalf("expected 200 span, got %v %v", attrs["http.response.status_code"], span.Status())
+			}
+			if attrs["http.request.resend_count"].AsInt64() != 1 {
+				t.Fatalf("expected resend count 1, got %v", attrs["http.request.resend_count"])
+			}
+		}
+	}
+}
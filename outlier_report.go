@@ -8,11 +8,7 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -31,203 +27,157 @@ type OutlierReport struct {
 	LastModified     uint     `json:"_last_modified,omitempty"`    // uint
 }
 
+// outlierReportResource describes the outlier report endpoint
+var outlierReportResource = RegisterResource(&Resource[OutlierReport]{
+	Name:            "outlier report",
+	Plural:          "outlier reports",
+	Prefix:          config.OutlierReportPrefix,
+	CIDRegex:        config.OutlierReportCIDRegex,
+	CID:             func(o *OutlierReport) string { return o.CID },
+	LastModified:    func(o *OutlierReport) uint { return o.LastModified },
+	SetLastModified: func(o *OutlierReport, lastModified uint) { o.LastModified = lastModified },
+	Tags:            func(o *OutlierReport) *[]string { return &o.Tags },
+})
+
 // NewOutlierReport returns a new OutlierReport (with defaults, if applicable)
 func NewOutlierReport() *OutlierReport {
 	return &OutlierReport{}
 }
 
 // FetchOutlierReport retrieves outlier report with passed cid.
-func (a *API) FetchOutlierReport(cid CIDType) (*OutlierReport, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid outlier report CID (none)")
-	}
-
-	var reportCID string
-	if !strings.HasPrefix(*cid, config.OutlierReportPrefix) {
-		reportCID = fmt.Sprintf("%s/%s", config.OutlierReportPrefix, *cid)
-	} else {
-		reportCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.OutlierReportCIDRegex, reportCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid outlier report CID (%s)", reportCID)
-	}
-
-	result, err := a.Get(reportCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching outlier report")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch outlier report, received JSON: %s", string(result))
-	}
-
-	report := &OutlierReport{}
-	if err := json.Unmarshal(result, report); err != nil {
-		return nil, errors.Wrap(err, "parsing outlier report")
-	}
+func (a *API) FetchOutlierReport(cid CIDType, opts ...CallOption) (*OutlierReport, error) {
+	return a.FetchOutlierReportWithContext(context.Background(), cid, opts...)
+}
 
-	return report, nil
+// FetchOutlierReportWithContext is FetchOutlierReport with a context for cancellation and deadlines.
+func (a *API) FetchOutlierReportWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*OutlierReport, error) {
+	return outlierReportResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchOutlierReports retrieves all outlier reports available to API Token.
-func (a *API) FetchOutlierReports() (*[]OutlierReport, error) {
-	result, err := a.Get(config.OutlierReportPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching outlier reports")
-	}
-
-	var reports []OutlierReport
-	if err := json.Unmarshal(result, &reports); err != nil {
-		return nil, errors.Wrap(err, "parsing outlier reports")
-	}
+func (a *API) FetchOutlierReports(opts ...CallOption) (*[]OutlierReport, error) {
+	return a.FetchOutlierReportsWithContext(context.Background(), opts...)
+}
 
-	return &reports, nil
+// FetchOutlierReportsWithContext is FetchOutlierReports with a context for cancellation and deadlines.
+func (a *API) FetchOutlierReportsWithContext(ctx context.Context, opts ...CallOption) (*[]OutlierReport, error) {
+	return outlierReportResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateOutlierReport updates passed outlier report.
-func (a *API) UpdateOutlierReport(cfg *OutlierReport) (*OutlierReport, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid outlier report config (nil)")
-	}
-
-	reportCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.OutlierReportCIDRegex, reportCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid outlier report CID (%s)", reportCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update outlier report, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) UpdateOutlierReport(cfg *OutlierReport, opts ...CallOption) (*OutlierReport, error) {
+	return a.UpdateOutlierReportWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Put(reportCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating outlier report")
-	}
+// UpdateOutlierReportWithContext is UpdateOutlierReport with a context for cancellation and deadlines.
+func (a *API) UpdateOutlierReportWithContext(ctx context.Context, cfg *OutlierReport, opts ...CallOption) (*OutlierReport, error) {
+	return outlierReportResource.Update(ctx, a, cfg, opts...)
+}
 
-	report := &OutlierReport{}
-	if err := json.Unmarshal(result, report); err != nil {
-		return nil, errors.Wrap(err, "parsing outlier report")
-	}
+// PatchOutlierReport applies patch (see Patcher) to the outlier report with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchOutlierReport(cid CIDType, patch Patcher, opts ...CallOption) (*OutlierReport, error) {
+	return a.PatchOutlierReportWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return report, nil
+// PatchOutlierReportWithContext is PatchOutlierReport with a context for cancellation and deadlines.
+func (a *API) PatchOutlierReportWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*OutlierReport, error) {
+	return outlierReportResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateOutlierReport creates a new outlier report.
-func (a *API) CreateOutlierReport(cfg *OutlierReport) (*OutlierReport, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid outlier report config (nil)")
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create outlier report, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Post(config.OutlierReportPrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating outlier report")
-	}
-
-	report := &OutlierReport{}
-	if err := json.Unmarshal(result, report); err != nil {
-		return nil, errors.Wrap(err, "parsing outlier report")
-	}
+func (a *API) CreateOutlierReport(cfg *OutlierReport, opts ...CallOption) (*OutlierReport, error) {
+	return a.CreateOutlierReportWithContext(context.Background(), cfg, opts...)
+}
 
-	return report, nil
+// CreateOutlierReportWithContext is CreateOutlierReport with a context for cancellation and deadlines.
+func (a *API) CreateOutlierReportWithContext(ctx context.Context, cfg *OutlierReport, opts ...CallOption) (*OutlierReport, error) {
+	return outlierReportResource.Create(ctx, a, cfg, opts...)
 }
 
 // DeleteOutlierReport deletes passed outlier report.
-func (a *API) DeleteOutlierReport(cfg *OutlierReport) (bool, error) {
+func (a *API) DeleteOutlierReport(cfg *OutlierReport, opts ...CallOption) (bool, error) {
+	return a.DeleteOutlierReportWithContext(context.Background(), cfg, opts...)
+}
+
+// DeleteOutlierReportWithContext is DeleteOutlierReport with a context for cancellation and deadlines.
+func (a *API) DeleteOutlierReportWithContext(ctx context.Context, cfg *OutlierReport, opts ...CallOption) (bool, error) {
 	if cfg == nil {
 		return false, errors.New("invalid outlier report config (nil)")
 	}
-	return a.DeleteOutlierReportByCID(CIDType(&cfg.CID))
+	return a.DeleteOutlierReportByCIDWithContext(ctx, CIDType(&cfg.CID), opts...)
 }
 
 // DeleteOutlierReportByCID deletes outlier report with passed cid.
-func (a *API) DeleteOutlierReportByCID(cid CIDType) (bool, error) {
-	if cid == nil || *cid == "" {
-		return false, errors.New("invalid outlier report CID (none)")
-	}
-
-	var reportCID string
-	if !strings.HasPrefix(*cid, config.OutlierReportPrefix) {
-		reportCID = fmt.Sprintf("%s/%s", config.OutlierReportPrefix, *cid)
-	} else {
-		reportCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.OutlierReportCIDRegex, reportCID)
-	if err != nil {
-		return false, err
-	}
-	if !matched {
-		return false, errors.Errorf("invalid outlier report CID (%s)", reportCID)
-	}
-
-	_, err = a.Delete(reportCID)
-	if err != nil {
-		return false, errors.Wrap(err, "deleting outlier report")
-	}
+func (a *API) DeleteOutlierReportByCID(cid CIDType, opts ...CallOption) (bool, error) {
+	return a.DeleteOutlierReportByCIDWithContext(context.Background(), cid, opts...)
+}
 
-	return true, nil
+// DeleteOutlierReportByCIDWithContext is DeleteOutlierReportByCID with a context for cancellation and deadlines.
+func (a *API) DeleteOutlierReportByCIDWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (bool, error) {
+	return outlierReportResource.Delete(ctx, a, cid, opts...)
 }
 
 // SearchOutlierReports returns outlier report matching the
 // specified search query and/or filter. If nil is passed for
 // both parameters all outlier report will be returned.
-func (a *API) SearchOutlierReports(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]OutlierReport, error) {
-	q := url.Values{}
+func (a *API) SearchOutlierReports(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]OutlierReport, error) {
+	return a.SearchOutlierReportsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
+// SearchOutlierReportsWithContext is SearchOutlierReports with a context for cancellation and deadlines.
+func (a *API) SearchOutlierReportsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]OutlierReport, error) {
+	return outlierReportResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
+// IterateOutlierReports calls fn for each outlier report matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateOutlierReports(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*OutlierReport) error) error {
+	return a.IterateOutlierReportsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	if q.Encode() == "" {
-		return a.FetchOutlierReports()
-	}
+// IterateOutlierReportsWithContext is IterateOutlierReports with a context for cancellation and deadlines.
+func (a *API) IterateOutlierReportsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*OutlierReport) error) error {
+	return outlierReportResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	reqURL := url.URL{
-		Path:     config.OutlierReportPrefix,
-		RawQuery: q.Encode(),
-	}
+// BulkCreateOutlierReports creates outlier reports concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateOutlierReports(cfgs []*OutlierReport, opts *BulkOptions) BulkResults[*OutlierReport] {
+	return a.BulkCreateOutlierReportsWithContext(context.Background(), cfgs, opts)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching outlier reports")
-	}
+// BulkCreateOutlierReportsWithContext is BulkCreateOutlierReports with a context for cancellation and deadlines.
+func (a *API) BulkCreateOutlierReportsWithContext(ctx context.Context, cfgs []*OutlierReport, opts *BulkOptions) BulkResults[*OutlierReport] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *OutlierReport) (*OutlierReport, error) {
+		return a.CreateOutlierReportWithContext(ctx, cfg)
+	})
+}
 
-	var reports []OutlierReport
-	if err := json.Unmarshal(result, &reports); err != nil {
-		return nil, errors.Wrap(err, "parsing outlier reports")
-	}
+// BulkUpdateOutlierReports updates outlier reports concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateOutlierReports(cfgs []*OutlierReport, opts *BulkOptions) BulkResults[*OutlierReport] {
+	return a.BulkUpdateOutlierReportsWithContext(context.Background(), cfgs, opts)
+}
+
+// BulkUpdateOutlierReportsWithContext is BulkUpdateOutlierReports with a context for cancellation and deadlines.
+func (a *API) BulkUpdateOutlierReportsWithContext(ctx context.Context, cfgs []*OutlierReport, opts *BulkOptions) BulkResults[*OutlierReport] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *OutlierReport) (*OutlierReport, error) {
+		return a.UpdateOutlierReportWithContext(ctx, cfg)
+	})
+}
+
+// BulkDeleteOutlierReports deletes outlier reports by cid concurrently (see BulkOptions),
+// the results are in the same order as cids.
+func (a *API) BulkDeleteOutlierReports(cids []string, opts *BulkOptions) BulkResults[bool] {
+	return a.BulkDeleteOutlierReportsWithContext(context.Background(), cids, opts)
+}
 
-	return &reports, nil
+// BulkDeleteOutlierReportsWithContext is BulkDeleteOutlierReports with a context for cancellation and deadlines.
+func (a *API) BulkDeleteOutlierReportsWithContext(ctx context.Context, cids []string, opts *BulkOptions) BulkResults[bool] {
+	return Bulk(ctx, cids, opts, func(ctx context.Context, cid string) (bool, error) {
+		return a.DeleteOutlierReportByCIDWithContext(ctx, CIDType(&cid))
+	})
 }
@@ -0,0 +1,269 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Patcher changes the JSON of an object for the Patch* methods, which fetch
+// the object, apply the patch to its JSON and put the result back. Fields of
+// the object which are not changed by the patch, including fields not modeled
+// by the object types, are sent back as received, except tags which are
+// normalized as on update. See MergePatch and PatchFunc.
+type Patcher interface {
+	// Apply returns the JSON object doc with the changes applied
+	Apply(doc []byte) ([]byte, error)
+}
+
+// MergePatch is a JSON merge patch (RFC 7396), e.g. {"period":120} sets the
+// period of a check bundle. Objects are merged recursively, a null value
+// removes a field and any other value (including arrays) replaces it.
+type MergePatch []byte
+
+// Apply applies the merge patch to doc
+func (p MergePatch) Apply(doc []byte) ([]byte, error) {
+	target, err := decodeJSONDoc(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing document")
+	}
+	patch, err := decodeJSONDoc(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing merge patch")
+	}
+
+	return json.Marshal(mergePatch(target, patch))
+}
+
+// mergePatch applies patch to target as described in RFC 7396
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+
+	return t
+}
+
+// PatchFunc changes an object of type T, e.g.
+//
+//	apiclient.PatchFunc[apiclient.RuleSet](func(rs *apiclient.RuleSet) error {
+//		rs.Notes = &notes
+//		return nil
+//	})
+//
+// Only the fields it changes are changed in the JSON of the object. Arrays
+// keeping their length are changed element by element (by position), an array
+// whose length changes is replaced, dropping fields of its elements which are
+// not modeled by the object types. Returning an error aborts the patch.
+type PatchFunc[T any] func(*T) error
+
+// Apply decodes doc into a T, calls f and applies the fields f changed to doc
+func (f PatchFunc[T]) Apply(doc []byte) ([]byte, error) {
+	raw, err := decodeJSONDoc(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing document")
+	}
+	if _, ok := raw.(map[string]interface{}); !ok {
+		return nil, errors.New("document is not a JSON object")
+	}
+
+	obj := new(T)
+	if err := json.Unmarshal(doc, obj); err != nil {
+		return nil, errors.Wrapf(err, "parsing %T", obj)
+	}
+
+	before, err := typedJSONDoc(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f(obj); err != nil {
+		return nil, err
+	}
+
+	after, err := typedJSONDoc(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(applyChanges(raw, before, after))
+}
+
+// typedJSONDoc returns the JSON document of an object
+func typedJSONDoc(obj interface{}) (interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "encoding %T", obj)
+	}
+	return decodeJSONDoc(data)
+}
+
+// applyChanges applies the differences between before and after to raw,
+// keeping the fields of raw which are unchanged or absent from both. Arrays
+// of the same length are changed element by element.
+func applyChanges(raw, before, after interface{}) interface{} {
+	if r, ok := raw.([]interface{}); ok {
+		b, bok := before.([]interface{})
+		a, aok := after.([]interface{})
+		if bok && aok && len(r) == len(b) && len(b) == len(a) {
+			for i := range a {
+				if !reflect.DeepEqual(b[i], a[i]) {
+					r[i] = applyChanges(r[i], b[i], a[i])
+				}
+			}
+			return r
+		}
+	}
+
+	r, rok := raw.(map[string]interface{})
+	b, bok := before.(map[string]interface{})
+	a, aok := after.(map[string]interface{})
+	if !rok || !bok || !aok {
+		if reflect.DeepEqual(before, after) {
+			return raw
+		}
+		return after
+	}
+
+	for k, av := range a {
+		bv, found := b[k]
+		switch {
+		case !found:
+			r[k] = av
+		case !reflect.DeepEqual(bv, av):
+			r[k] = applyChanges(r[k], bv, av)
+		}
+	}
+	for k := range b {
+		if _, found := a[k]; !found {
+			delete(r, k)
+		}
+	}
+
+	return r
+}
+
+// decodeJSONDoc decodes a JSON document, keeping numbers as is
+func decodeJSONDoc(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Patch applies patch to the object of type T with the passed cid, e.g.
+//
+//	bundle, err := apiclient.Patch[apiclient.CheckBundle](ctx, client, "/check_bundle/1234", apiclient.MergePatch(`{"period":120}`))
+func Patch[T any](ctx context.Context, a *API, cid string, patch Patcher, opts ...CallOption) (*T, error) {
+	r, err := lookupResource[T]()
+	if err != nil {
+		return nil, err
+	}
+	return r.Patch(ctx, a, &cid, patch, opts...)
+}
+
+// Patch fetches the object with the passed cid (a bare ID, CID or API path),
+// applies patch to its JSON and updates the object with the result. The patch
+// always applies to the server object, fetched just before the update, so
+// Config.DetectConflicts does not apply.
+func (r *Resource[T]) Patch(ctx context.Context, a *API, cid CIDType, patch Patcher, opts ...CallOption) (*T, error) {
+	if patch == nil {
+		return nil, errors.Errorf("invalid %s patch (nil)", r.Name)
+	}
+
+	objCID, err := r.normalizeCID(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	// not cached or coalesced, the server object is patched
+	current, err := a.apiRequest(ContextWithCallOptions(ctx, opts...), "GET", objCID, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching %s", r.Name)
+	}
+
+	data, err := patch.Apply(current)
+	if err != nil {
+		return nil, errors.Wrapf(err, "patching %s", r.Name)
+	}
+
+	if r.Tags != nil {
+		if data, err = fixJSONTags(data); err != nil {
+			return nil, errors.Wrapf(err, "patching %s", r.Name)
+		}
+	}
+
+	a.debugJSON(fmt.Sprintf("patch %s, sending JSON", r.Name), data)
+
+	result, err := a.PutWithContext(ctx, objCID, data, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "updating %s", r.Name)
+	}
+
+	a.debugJSON(fmt.Sprintf("patch %s, received JSON", r.Name), result)
+
+	obj := new(T)
+	if err := r.decode(result, obj, r.Name); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// fixJSONTags normalizes the tags of a JSON object (see fixTags)
+func fixJSONTags(data []byte) ([]byte, error) {
+	doc, err := decodeJSONDoc(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing patched document")
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return data, nil
+	}
+	raw, ok := obj["tags"].([]interface{})
+	if !ok || len(raw) == 0 {
+		return data, nil
+	}
+
+	tags := make([]string, 0, len(raw))
+	for _, t := range raw {
+		tag, ok := t.(string)
+		if !ok {
+			return data, nil
+		}
+		tags = append(tags, tag)
+	}
+	tags = fixTags(tags)
+	if tags == nil {
+		tags = []string{}
+	}
+	obj["tags"] = tags
+
+	return json.Marshal(obj)
+}
@@ -0,0 +1,238 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		id         string
+		doc        string
+		patch      string
+		expected   string
+		shouldFail bool
+	}{
+		{id: "set", doc: `{"a":1,"b":2}`, patch: `{"a":3}`, expected: `{"a":3,"b":2}`},
+		{id: "add", doc: `{"a":1}`, patch: `{"b":"x"}`, expected: `{"a":1,"b":"x"}`},
+		{id: "remove", doc: `{"a":1,"b":2}`, patch: `{"b":null}`, expected: `{"a":1}`},
+		{id: "nested", doc: `{"a":{"b":1,"c":2}}`, patch: `{"a":{"c":3,"d":null}}`, expected: `{"a":{"b":1,"c":3}}`},
+		{id: "array replaced", doc: `{"a":[1,2]}`, patch: `{"a":[3]}`, expected: `{"a":[3]}`},
+		{id: "object replaces value", doc: `{"a":1}`, patch: `{"a":{"b":1}}`, expected: `{"a":{"b":1}}`},
+		{id: "large number", doc: `{"a":12345678901234567890}`, patch: `{"b":1}`, expected: `{"a":12345678901234567890,"b":1}`},
+		{id: "invalid doc", doc: `{`, patch: `{}`, shouldFail: true},
+		{id: "invalid patch", doc: `{}`, patch: `{`, shouldFail: true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			data, err := MergePatch(test.patch).Apply([]byte(test.doc))
+			if test.shouldFail {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			if string(data) != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, data)
+			}
+		})
+	}
+}
+
+func TestPatchFunc(t *testing.T) {
+	doc := `{"_cid":"/rule_set/1234","_unknown":{"x":1},"check":"/check/1","metric_name":"foo","notes":"old","rules":[{"criteria":"on absence","severity":1,"value":300,"wait":0,"_new":true}],"tags":["a:b"]}`
+
+	tests := []struct {
+		fn         PatchFunc[RuleSet]
+		id         string
+		expected   string
+		shouldFail bool
+	}{
+		{
+			id:       "unchanged",
+			fn:       func(rs *RuleSet) error { return nil },
+			expected: doc,
+		},
+		{
+			id: "set",
+			fn: func(rs *RuleSet) error {
+				notes := "new"
+				rs.Notes = &notes
+				return nil
+			},
+			expected: `{"_cid":"/rule_set/1234","_unknown":{"x":1},"check":"/check/1","metric_name":"foo","notes":"new","rules":[{"_new":true,"criteria":"on absence","severity":1,"value":300,"wait":0}],"tags":["a:b"]}`,
+		},
+		{
+			id: "null",
+			fn: func(rs *RuleSet) error {
+				rs.Notes = nil
+				return nil
+			},
+			expected: `{"_cid":"/rule_set/1234","_unknown":{"x":1},"check":"/check/1","metric_name":"foo","notes":null,"rules":[{"_new":true,"criteria":"on absence","severity":1,"value":300,"wait":0}],"tags":["a:b"]}`,
+		},
+		{
+			id: "omitted",
+			fn: func(rs *RuleSet) error {
+				rs.MetricName = ""
+				rs.Tags = append(rs.Tags, "c:d")
+				return nil
+			},
+			expected: `{"_cid":"/rule_set/1234","_unknown":{"x":1},"check":"/check/1","notes":"old","rules":[{"_new":true,"criteria":"on absence","severity":1,"value":300,"wait":0}],"tags":["a:b","c:d"]}`,
+		},
+		{
+			id: "array element",
+			fn: func(rs *RuleSet) error {
+				rs.Rules[0].Severity = 2
+				return nil
+			},
+			expected: `{"_cid":"/rule_set/1234","_unknown":{"x":1},"check":"/check/1","metric_name":"foo","notes":"old","rules":[{"_new":true,"criteria":"on absence","severity":2,"value":300,"wait":0}],"tags":["a:b"]}`,
+		},
+		{
+			id: "array length",
+			fn: func(rs *RuleSet) error {
+				rs.Rules = append(rs.Rules, RuleSetRule{Criteria: "on absence", Severity: 2, Value: 600})
+				return nil
+			},
+			expected: `{"_cid":"/rule_set/1234","_unknown":{"x":1},"check":"/check/1","metric_name":"foo","notes":"old","rules":[{"criteria":"on absence","severity":1,"value":300,"wait":0},{"criteria":"on absence","severity":2,"value":600,"wait":0}],"tags":["a:b"]}`,
+		},
+		{
+			id:         "error",
+			fn:         func(rs *RuleSet) error { return errors.New("no") },
+			shouldFail: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			data, err := test.fn.Apply([]byte(doc))
+			if test.shouldFail {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			// unchanged documents are re-encoded, compare normalized
+			expected, _ := MergePatch(`{}`).Apply([]byte(test.expected))
+			if string(data) != string(expected) {
+				t.Fatalf("expected %s, got %s", expected, data)
+			}
+		})
+	}
+
+	t.Run("not an object", func(t *testing.T) {
+		if _, err := PatchFunc[RuleSet](func(rs *RuleSet) error { return nil }).Apply([]byte(`[]`)); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestPatch(t *testing.T) {
+	var (
+		doc  = `{"_cid":"/check_bundle/1234","_unknown":"keep","period":60,"display_name":"foo"}`
+		puts []string
+		mu   sync.Mutex
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path != "/check_bundle/1234" {
+			w.WriteHeader(404)
+			return
+		}
+		if r.Method == "PUT" {
+			body, _ := io.ReadAll(r.Body)
+			puts = append(puts, string(body))
+			doc = string(body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, doc)
+	}))
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	t.Run("merge patch", func(t *testing.T) {
+		cid := "1234"
+		bundle, err := apih.PatchCheckBundle(CIDType(&cid), MergePatch(`{"period":120}`))
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if bundle.Period != 120 || bundle.DisplayName != "foo" {
+			t.Fatalf("unexpected bundle %#v", bundle)
+		}
+		if expected := `{"_cid":"/check_bundle/1234","_unknown":"keep","display_name":"foo","period":120}`; puts[len(puts)-1] != expected {
+			t.Fatalf("expected %s, got %s", expected, puts[len(puts)-1])
+		}
+	})
+
+	t.Run("func", func(t *testing.T) {
+		bundle, err := Patch[CheckBundle](context.Background(), apih, "/check_bundle/1234", PatchFunc[CheckBundle](func(b *CheckBundle) error {
+			b.DisplayName = "bar"
+			return nil
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if bundle.Period != 120 || bundle.DisplayName != "bar" {
+			t.Fatalf("unexpected bundle %#v", bundle)
+		}
+		if expected := `{"_cid":"/check_bundle/1234","_unknown":"keep","display_name":"bar","period":120}`; puts[len(puts)-1] != expected {
+			t.Fatalf("expected %s, got %s", expected, puts[len(puts)-1])
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		cid := "/check_bundle/1234"
+		if _, err := apih.PatchCheckBundle(CIDType(&cid), MergePatch(`{"tags":["Env:Prod","a:b","env:prod"]}`)); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if expected := `{"_cid":"/check_bundle/1234","_unknown":"keep","display_name":"bar","period":120,"tags":["a:b","env:prod"]}`; puts[len(puts)-1] != expected {
+			t.Fatalf("expected %s, got %s", expected, puts[len(puts)-1])
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		n := len(puts)
+		cid := "/check_bundle/1234"
+
+		if _, err := apih.PatchCheckBundle(CIDType(&cid), nil); err == nil || err.Error() != "invalid check bundle patch (nil)" {
+			t.Fatalf("unexpected error (%v)", err)
+		}
+		if _, err := apih.PatchCheckBundle(nil, MergePatch(`{}`)); err == nil || err.Error() != "invalid check bundle CID (none)" {
+			t.Fatalf("unexpected error (%v)", err)
+		}
+		if _, err := apih.PatchCheckBundle(CIDType(&cid), MergePatch(`{`)); err == nil {
+			t.Fatal("expected error")
+		}
+		missing := "/check_bundle/1"
+		if _, err := apih.PatchCheckBundle(CIDType(&missing), MergePatch(`{}`)); !IsNotFound(err) {
+			t.Fatalf("expected not found, got (%v)", err)
+		}
+		if len(puts) != n {
+			t.Fatal("expected no update")
+		}
+	})
+}
@@ -0,0 +1,277 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Environment variables read by NewFromEnvironment and NewFromProfile
+const (
+	EnvAPIToken           = "CIRCONUS_API_TOKEN"
+	EnvAPIApp             = "CIRCONUS_API_APP"
+	EnvAPIURL             = "CIRCONUS_API_URL"
+	EnvAccountID          = "CIRCONUS_ACCOUNT_ID"
+	EnvCAFile             = "CIRCONUS_API_CA_FILE"
+	EnvMinRetryDelay      = "CIRCONUS_API_MIN_RETRY_DELAY"
+	EnvMaxRetryDelay      = "CIRCONUS_API_MAX_RETRY_DELAY"
+	EnvMaxRetries         = "CIRCONUS_API_MAX_RETRIES"
+	EnvDisableRetries     = "CIRCONUS_API_DISABLE_RETRIES"
+	EnvExponentialBackoff = "CIRCONUS_API_EXPONENTIAL_BACKOFF"
+	EnvDebug              = "CIRCONUS_API_DEBUG"
+	EnvProfile            = "CIRCONUS_PROFILE"
+	EnvConfigFile         = "CIRCONUS_CONFIG_FILE"
+)
+
+// DefaultProfile is the profile used when no profile name is given
+const DefaultProfile = "default"
+
+// profileKeys maps profile file keys to the equivalent environment variable
+var profileKeys = map[string]string{
+	"api_token":           EnvAPIToken,
+	"api_app":             EnvAPIApp,
+	"api_url":             EnvAPIURL,
+	"account_id":          EnvAccountID,
+	"ca_file":             EnvCAFile,
+	"min_retry_delay":     EnvMinRetryDelay,
+	"max_retry_delay":     EnvMaxRetryDelay,
+	"max_retries":         EnvMaxRetries,
+	"disable_retries":     EnvDisableRetries,
+	"exponential_backoff": EnvExponentialBackoff,
+	"debug":               EnvDebug,
+}
+
+// NewFromEnvironment returns a new Circonus API configured from environment
+// variables (see ConfigFromEnvironment).
+func NewFromEnvironment() (*API, error) {
+	cfg, err := ConfigFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// NewFromProfile returns a new Circonus API configured from the named profile
+// (see ConfigFromProfile).
+func NewFromProfile(name string) (*API, error) {
+	cfg, err := ConfigFromProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// ConfigFromEnvironment returns a Config from the CIRCONUS_* environment
+// variables. If CIRCONUS_PROFILE is set, settings not in the environment are
+// read from that profile. Environment variables take precedence.
+func ConfigFromEnvironment() (*Config, error) {
+	settings := map[string]string{}
+
+	if name := os.Getenv(EnvProfile); name != "" {
+		profile, err := readProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		settings = profile
+	}
+
+	return configFromSettings(withEnvironment(settings))
+}
+
+// withEnvironment overrides settings with the environment variables which are set
+func withEnvironment(settings map[string]string) map[string]string {
+	for _, env := range profileKeys {
+		if v, ok := os.LookupEnv(env); ok {
+			settings[env] = v
+		}
+	}
+	return settings
+}
+
+// ConfigFromProfile returns a Config from the named profile in the profile
+// file (CIRCONUS_CONFIG_FILE or ~/.circonus/config), "" selects the default
+// profile. Environment variables take precedence, as with ConfigFromEnvironment.
+func ConfigFromProfile(name string) (*Config, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+
+	settings, err := readProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return configFromSettings(withEnvironment(settings))
+}
+
+// configFromSettings builds a Config from settings keyed by environment variable
+func configFromSettings(settings map[string]string) (*Config, error) {
+	cfg := &Config{
+		TokenKey:       settings[EnvAPIToken],
+		TokenApp:       settings[EnvAPIApp],
+		URL:            settings[EnvAPIURL],
+		TokenAccountID: settings[EnvAccountID],
+		MinRetryDelay:  settings[EnvMinRetryDelay],
+		MaxRetryDelay:  settings[EnvMaxRetryDelay],
+	}
+
+	if v := settings[EnvMaxRetries]; v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing max retries (%s)", v)
+		}
+		cfg.MaxRetries = uint(n)
+	}
+
+	for env, dst := range map[string]*bool{
+		EnvDisableRetries:     &cfg.DisableRetries,
+		EnvExponentialBackoff: &cfg.ExponentialBackoff,
+		EnvDebug:              &cfg.Debug,
+	} {
+		if v := settings[env]; v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing %s (%s)", env, v)
+			}
+			*dst = b
+		}
+	}
+
+	if file := settings[EnvCAFile]; file != "" {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in CA file (%s)", file)
+		}
+		cfg.TLSConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return cfg, nil
+}
+
+// profileFile returns the path of the profile file
+func profileFile() (string, error) {
+	if file := os.Getenv(EnvConfigFile); file != "" {
+		return file, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "locating profile file")
+	}
+	return filepath.Join(home, ".circonus", "config"), nil
+}
+
+// readProfile returns the settings, keyed by environment variable, of the
+// named profile
+func readProfile(name string) (map[string]string, error) {
+	file, err := profileFile()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading profile file")
+	}
+	defer f.Close()
+
+	profiles, err := parseProfiles(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing profile file (%s)", file)
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, errors.Errorf("profile (%s) not found in %s", name, file)
+	}
+
+	return profile, nil
+}
+
+// parseProfiles parses INI or (the equivalent subset of) TOML profiles:
+//
+//	# comment
+//	[default]
+//	api_token = "..."
+//	max_retries = 2
+//
+//	[profile.staging]
+//	api_token = ...
+//
+// Section names may be prefixed with "profile." and quoted, values may be quoted.
+// Unknown settings are ignored.
+func parseProfiles(f *os.File) (map[string]map[string]string, error) {
+	profiles := map[string]map[string]string{}
+
+	var current map[string]string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, errors.Errorf("line %d: invalid section (%s)", n, line)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			name = strings.TrimPrefix(name, "profile.")
+			name = strings.TrimPrefix(name, "profile ")
+			name = strings.Trim(name, `"'`)
+			current = map[string]string{}
+			profiles[name] = current
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, errors.Errorf("line %d: expected key = value", n)
+		}
+		key, value := line[:eq], line[eq+1:]
+		if current == nil {
+			return nil, errors.Errorf("line %d: setting outside of a profile section", n)
+		}
+		env, ok := profileKeys[strings.TrimSpace(key)]
+		if !ok {
+			// settings of other tools, or newer versions, sharing the file
+			continue
+		}
+		current[env] = unquote(strings.TrimSpace(value))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+// unquote removes quotes from a value, or a trailing comment from an unquoted value
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') {
+		if end := strings.IndexByte(v[1:], v[0]); end >= 0 {
+			return v[1 : end+1]
+		}
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v
+}
@@ -0,0 +1,263 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testProfiles = `# Circonus API profiles
+[default]
+api_token = "default-token"
+api_url = https://api.example.com/v2 # trailing comment
+max_retries = 2
+
+[profile.staging]
+api_token = 'staging-token'
+account_id = "42"
+exponential_backoff = true
+
+[profile "prod"]
+api_token = prod-token
+output_format = json # another tool's setting
+min_retry_delay = "2s"
+max_retry_delay = "30s"
+disable_retries = false
+`
+
+func writeProfiles(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	return file
+}
+
+// clearEnv unsets all configuration environment variables for the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	envs := []string{EnvProfile, EnvConfigFile}
+	for _, env := range profileKeys {
+		envs = append(envs, env)
+	}
+	for _, env := range envs {
+		t.Setenv(env, "") // restored after the test
+		os.Unsetenv(env)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	file := writeProfiles(t, testProfiles)
+
+	tests := []struct {
+		env         map[string]string
+		check       func(*Config) error
+		profile     string
+		useProfile  bool
+		description string
+	}{
+		{
+			description: "environment",
+			env:         map[string]string{EnvAPIToken: "env-token", EnvAPIApp: "env-app", EnvAPIURL: "https://env.example.com/v2", EnvAccountID: "7", EnvMaxRetries: "9", EnvDisableRetries: "true", EnvDebug: "1"},
+			check: func(c *Config) error {
+				if c.TokenKey != "env-token" || c.TokenApp != "env-app" || c.URL != "https://env.example.com/v2" || c.TokenAccountID != "7" {
+					return fmt.Errorf("unexpected config %#v", c)
+				}
+				if c.MaxRetries != 9 || !c.DisableRetries || !c.Debug {
+					return fmt.Errorf("unexpected retry settings %#v", c)
+				}
+				return nil
+			},
+		},
+		{
+			description: "environment over CIRCONUS_PROFILE",
+			env:         map[string]string{EnvProfile: "staging", EnvAccountID: "99", EnvExponentialBackoff: "false"},
+			check: func(c *Config) error {
+				if c.TokenKey != "staging-token" || c.TokenAccountID != "99" || c.ExponentialBackoff {
+					return fmt.Errorf("unexpected config %#v", c)
+				}
+				return nil
+			},
+		},
+		{
+			description: "default profile",
+			useProfile:  true,
+			check: func(c *Config) error {
+				if c.TokenKey != "default-token" || c.URL != "https://api.example.com/v2" || c.MaxRetries != 2 {
+					return fmt.Errorf("unexpected config %#v", c)
+				}
+				return nil
+			},
+		},
+		{
+			description: "environment over named profile",
+			useProfile:  true,
+			profile:     "staging",
+			env:         map[string]string{EnvAPIToken: "env-token", EnvAPIApp: "env-app", EnvAccountID: "99"},
+			check: func(c *Config) error {
+				if c.TokenKey != "env-token" || c.TokenAccountID != "99" || !c.ExponentialBackoff {
+					return fmt.Errorf("unexpected config %#v", c)
+				}
+				if c.TokenApp != "env-app" {
+					return fmt.Errorf("expected app from environment, got (%s)", c.TokenApp)
+				}
+				return nil
+			},
+		},
+		{
+			description: "backoff settings",
+			useProfile:  true,
+			profile:     "prod",
+			check: func(c *Config) error {
+				if c.TokenKey != "prod-token" || c.MinRetryDelay != "2s" || c.MaxRetryDelay != "30s" || c.DisableRetries {
+					return fmt.Errorf("unexpected config %#v", c)
+				}
+				return nil
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv(EnvConfigFile, file)
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+
+			var cfg *Config
+			var err error
+			if test.useProfile {
+				cfg, err = ConfigFromProfile(test.profile)
+			} else {
+				cfg, err = ConfigFromEnvironment()
+			}
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			if err := test.check(cfg); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestConfigSamePrecedence(t *testing.T) {
+	clearEnv(t)
+	t.Setenv(EnvConfigFile, writeProfiles(t, testProfiles))
+	t.Setenv(EnvAPIToken, "env-token")
+	t.Setenv(EnvExponentialBackoff, "false")
+
+	fromProfile, err := ConfigFromProfile("staging")
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	t.Setenv(EnvProfile, "staging")
+	fromEnv, err := ConfigFromEnvironment()
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if !reflect.DeepEqual(fromProfile, fromEnv) {
+		t.Fatalf("expected the same config, got %#v and %#v", fromProfile, fromEnv)
+	}
+	if fromEnv.TokenKey != "env-token" || fromEnv.TokenAccountID != "42" || fromEnv.ExponentialBackoff {
+		t.Fatalf("unexpected config %#v", fromEnv)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		env         map[string]string
+		profiles    string
+		profile     string
+		description string
+	}{
+		{description: "missing profile", profiles: testProfiles, profile: "none"},
+		{description: "missing file", profile: "default"},
+		{description: "setting outside section", profiles: "api_token = foo\n", profile: "default"},
+		{description: "invalid bool", profiles: testProfiles, profile: "default", env: map[string]string{EnvDebug: "maybe"}},
+		{description: "invalid max retries", profiles: testProfiles, profile: "staging", env: map[string]string{EnvMaxRetries: "-1"}},
+		{description: "missing CA file", profiles: testProfiles, profile: "default", env: map[string]string{EnvCAFile: "/nonexistent/ca.pem"}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			clearEnv(t)
+			file := filepath.Join(t.TempDir(), "missing")
+			if test.profiles != "" {
+				file = writeProfiles(t, test.profiles)
+			}
+			t.Setenv(EnvConfigFile, file)
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			if _, err := NewFromProfile(test.profile); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestNewFromEnvironmentCAFile(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"_cid":"/user/1"}`)
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // expected handshake errors
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	clearEnv(t)
+	t.Setenv(EnvAPIToken, "foo")
+	t.Setenv(EnvAPIURL, server.URL)
+	t.Setenv(EnvDisableRetries, "true")
+
+	t.Run("untrusted", func(t *testing.T) {
+		apih, err := NewFromEnvironment()
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if _, err := apih.FetchUser(nil); err == nil {
+			t.Fatal("expected certificate error")
+		}
+	})
+
+	t.Run("CA file", func(t *testing.T) {
+		t.Setenv(EnvCAFile, caFile)
+		apih, err := NewFromEnvironment()
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if _, err := apih.FetchUser(nil); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	})
+
+	t.Run("no token", func(t *testing.T) {
+		t.Setenv(EnvAPIToken, "")
+		if _, err := NewFromEnvironment(); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
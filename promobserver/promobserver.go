@@ -0,0 +1,92 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package promobserver provides an apiclient.Observer collecting Prometheus
+// request, retry and error counters and a request latency histogram, labeled
+// by HTTP method and API resource (e.g. /check_bundle).
+//
+//	obs, err := promobserver.New(prometheus.DefaultRegisterer)
+//	...
+//	client, err := apiclient.New(&apiclient.Config{
+//		TokenKey:  "...",
+//		Observers: []apiclient.Observer{obs},
+//	})
+package promobserver
+
+import (
+	"context"
+	"strconv"
+
+	apiclient "github.com/circonus-labs/go-apiclient"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "circonus_api"
+
+// Observer collects Prometheus metrics for API requests
+type Observer struct {
+	requests *prometheus.CounterVec
+	retries  *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+var _ apiclient.Observer = (*Observer)(nil)
+
+// New creates an Observer and registers its metrics with reg
+func New(reg prometheus.Registerer) (*Observer, error) {
+	labels := []string{"method", "resource"}
+	o := &Observer{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Circonus API request attempts, by method, resource and response code (or 'error').",
+		}, append(labels, "code")),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_retries_total",
+			Help:      "Circonus API request attempts which were retries, by method and resource.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_errors_total",
+			Help:      "Circonus API request attempts failing with a transport error or non-2xx response, by method and resource.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Circonus API request attempt latency, by method and resource.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+	}
+
+	for _, c := range []prometheus.Collector{o.requests, o.retries, o.errors, o.duration} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// RequestStart counts retries
+func (o *Observer) RequestStart(ctx context.Context, info apiclient.RequestInfo) context.Context {
+	if info.Attempt > 1 {
+		o.retries.WithLabelValues(info.Method, info.Resource).Inc()
+	}
+	return ctx
+}
+
+// RequestEnd records the request, its latency and any error
+func (o *Observer) RequestEnd(_ context.Context, info apiclient.RequestInfo, result apiclient.RequestResult) {
+	code := "error"
+	if result.Err == nil {
+		code = strconv.Itoa(result.StatusCode)
+	}
+	o.requests.WithLabelValues(info.Method, info.Resource, code).Inc()
+	o.duration.WithLabelValues(info.Method, info.Resource).Observe(result.Duration.Seconds())
+	if result.Err != nil || result.StatusCode < 200 || result.StatusCode >= 300 {
+		o.errors.WithLabelValues(info.Method, info.Resource).Inc()
+	}
+}
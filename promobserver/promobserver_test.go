@@ -0,0 +1,88 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promobserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	apiclient "github.com/circonus-labs/go-apiclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserver(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rule_set/1" {
+			w.WriteHeader(404)
+			fmt.Fprintln(w, "not found")
+			return
+		}
+		if atomic.AddInt64(&calls, 1) == 1 {
+			w.WriteHeader(500)
+			fmt.Fprintln(w, "error")
+			return
+		}
+		w.WriteHeader(200)
+		fmt.Fprintln(w, "{}")
+	}))
+	defer server.Close()
+
+	reg := prometheus.NewPedanticRegistry()
+	obs, err := New(reg)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	apih, err := apiclient.New(&apiclient.Config{
+		TokenKey:      "foo",
+		URL:           server.URL,
+		MinRetryDelay: "1ms",
+		MaxRetryDelay: "2ms",
+		Observers:     []apiclient.Observer{obs},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	if _, err := apih.Get("/check_bundle/1234"); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if _, err := apih.Get("/rule_set/1"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	expected := `
+# HELP circonus_api_requests_total Circonus API request attempts, by method, resource and response code (or 'error').
+# TYPE circonus_api_requests_total counter
+circonus_api_requests_total{code="200",method="GET",resource="/check_bundle"} 1
+circonus_api_requests_total{code="404",method="GET",resource="/rule_set"} 1
+circonus_api_requests_total{code="500",method="GET",resource="/check_bundle"} 1
+# HELP circonus_api_request_retries_total Circonus API request attempts which were retries, by method and resource.
+# TYPE circonus_api_request_retries_total counter
+circonus_api_request_retries_total{method="GET",resource="/check_bundle"} 1
+# HELP circonus_api_request_errors_total Circonus API request attempts failing with a transport error or non-2xx response, by method and resource.
+# TYPE circonus_api_request_errors_total counter
+circonus_api_request_errors_total{method="GET",resource="/check_bundle"} 1
+circonus_api_request_errors_total{method="GET",resource="/rule_set"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"circonus_api_requests_total", "circonus_api_request_retries_total", "circonus_api_request_errors_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.CollectAndCount(obs.duration); n != 2 {
+		t.Fatalf("expected 2 histogram series, got %d", n)
+	}
+
+	if _, err := New(reg); err == nil {
+		t.Fatal("expected duplicate registration error")
+	}
+}
@@ -10,10 +10,7 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -44,115 +41,77 @@ type ProvisionBroker struct {
 	Rebuild                 bool             `json:"rebuild,omitempty"`                   // boolean
 }
 
+// provisionBrokerResource describes the provision broker endpoint
+var provisionBrokerResource = RegisterResource(&Resource[ProvisionBroker]{
+	Name:     "provision broker",
+	Plural:   "provision brokers",
+	Prefix:   config.ProvisionBrokerPrefix,
+	CIDRegex: config.ProvisionBrokerCIDRegex,
+	CID:      func(o *ProvisionBroker) string { return o.CID },
+	Tags:     func(o *ProvisionBroker) *[]string { return &o.Tags },
+})
+
 // NewProvisionBroker returns a new ProvisionBroker (with defaults, if applicable)
 func NewProvisionBroker() *ProvisionBroker {
 	return &ProvisionBroker{}
 }
 
 // FetchProvisionBroker retrieves provision broker [request] with passed cid.
-func (a *API) FetchProvisionBroker(cid CIDType) (*ProvisionBroker, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid provision broker CID (none)")
-	}
-
-	var brokerCID string
-	if !strings.HasPrefix(*cid, config.ProvisionBrokerPrefix) {
-		brokerCID = fmt.Sprintf("%s/%s", config.ProvisionBrokerPrefix, *cid)
-	} else {
-		brokerCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.ProvisionBrokerCIDRegex, brokerCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid provision broker CID (%s)", brokerCID)
-	}
-
-	result, err := a.Get(brokerCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching provision broker")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch broker provision request, received JSON: %s", string(result))
-	}
-
-	broker := &ProvisionBroker{}
-	if err := json.Unmarshal(result, broker); err != nil {
-		return nil, errors.Wrap(err, "parsing provision broker")
-	}
+func (a *API) FetchProvisionBroker(cid CIDType, opts ...CallOption) (*ProvisionBroker, error) {
+	return a.FetchProvisionBrokerWithContext(context.Background(), cid, opts...)
+}
 
-	return broker, nil
+// FetchProvisionBrokerWithContext is FetchProvisionBroker with a context for cancellation and deadlines.
+func (a *API) FetchProvisionBrokerWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*ProvisionBroker, error) {
+	return provisionBrokerResource.Fetch(ctx, a, cid, opts...)
 }
 
 // UpdateProvisionBroker updates a broker definition [request].
-func (a *API) UpdateProvisionBroker(cid CIDType, cfg *ProvisionBroker) (*ProvisionBroker, error) {
+func (a *API) UpdateProvisionBroker(cid CIDType, cfg *ProvisionBroker, opts ...CallOption) (*ProvisionBroker, error) {
+	return a.UpdateProvisionBrokerWithContext(context.Background(), cid, cfg, opts...)
+}
+
+// UpdateProvisionBrokerWithContext is UpdateProvisionBroker with a context for cancellation and deadlines.
+func (a *API) UpdateProvisionBrokerWithContext(ctx context.Context, cid CIDType, cfg *ProvisionBroker, opts ...CallOption) (*ProvisionBroker, error) {
 	if cid == nil || *cid == "" {
 		return nil, errors.New("invalid provision broker CID (none)")
 	}
-
 	if cfg == nil {
 		return nil, errors.New("invalid provision broker config (nil)")
 	}
+	return provisionBrokerResource.update(ctx, a, *cid, cfg, opts...)
+}
 
-	brokerCID := *cid
-
-	matched, err := regexp.MatchString(config.ProvisionBrokerCIDRegex, brokerCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid provision broker CID (%s)", brokerCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update broker provision request, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Put(brokerCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating provision broker")
-	}
-
-	broker := &ProvisionBroker{}
-	if err := json.Unmarshal(result, broker); err != nil {
-		return nil, errors.Wrap(err, "parsing provision broker")
-	}
+// PatchProvisionBroker applies patch (see Patcher) to the provision broker with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchProvisionBroker(cid CIDType, patch Patcher, opts ...CallOption) (*ProvisionBroker, error) {
+	return a.PatchProvisionBrokerWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return broker, nil
+// PatchProvisionBrokerWithContext is PatchProvisionBroker with a context for cancellation and deadlines.
+func (a *API) PatchProvisionBrokerWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*ProvisionBroker, error) {
+	return provisionBrokerResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateProvisionBroker creates a new provison broker [request].
-func (a *API) CreateProvisionBroker(cfg *ProvisionBroker) (*ProvisionBroker, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid provision broker config (nil)")
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create broker provision request, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) CreateProvisionBroker(cfg *ProvisionBroker, opts ...CallOption) (*ProvisionBroker, error) {
+	return a.CreateProvisionBrokerWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Post(config.ProvisionBrokerPrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating provision broker")
-	}
+// CreateProvisionBrokerWithContext is CreateProvisionBroker with a context for cancellation and deadlines.
+func (a *API) CreateProvisionBrokerWithContext(ctx context.Context, cfg *ProvisionBroker, opts ...CallOption) (*ProvisionBroker, error) {
+	return provisionBrokerResource.Create(ctx, a, cfg, opts...)
+}
 
-	broker := &ProvisionBroker{}
-	if err := json.Unmarshal(result, broker); err != nil {
-		return nil, errors.Wrap(err, "parsing provision broker")
-	}
+// BulkCreateProvisionBrokers creates provision brokers concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateProvisionBrokers(cfgs []*ProvisionBroker, opts *BulkOptions) BulkResults[*ProvisionBroker] {
+	return a.BulkCreateProvisionBrokersWithContext(context.Background(), cfgs, opts)
+}
 
-	return broker, nil
+// BulkCreateProvisionBrokersWithContext is BulkCreateProvisionBrokers with a context for cancellation and deadlines.
+func (a *API) BulkCreateProvisionBrokersWithContext(ctx context.Context, cfgs []*ProvisionBroker, opts *BulkOptions) BulkResults[*ProvisionBroker] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *ProvisionBroker) (*ProvisionBroker, error) {
+		return a.CreateProvisionBrokerWithContext(ctx, cfg)
+	})
 }
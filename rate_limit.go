@@ -0,0 +1,244 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RateLimiterStats is a snapshot of the client side rate limiter
+type RateLimiterStats struct {
+	// Since is when the rate limiter was created
+	Since time.Time
+	// PausedUntil is when a pause requested by the API (e.g. Retry-After) ends
+	PausedUntil time.Time
+	// Requests is the number of requests allowed through the limiter
+	Requests uint64
+	// Delayed is the number of requests which had to wait for a token
+	Delayed uint64
+	// RateLimited is the number of 429 responses received from the API
+	RateLimited uint64
+	// TotalWait is the cumulative time requests spent waiting in the limiter
+	TotalWait time.Duration
+	// Rate is the configured number of requests per second
+	Rate float64
+	// Throughput is the average number of requests per second since creation
+	Throughput float64
+	// Burst is the configured bucket size
+	Burst int
+}
+
+// rateLimiter is a token bucket shared by all requests made with an API. Tokens
+// are reserved up front (the bucket may go negative) so waiting requests are
+// released in order at the configured rate.
+type rateLimiter struct {
+	now         func() time.Time
+	sleep       func(ctx context.Context, d time.Duration) error
+	since       time.Time
+	last        time.Time
+	pausedUntil time.Time
+	rate        float64
+	burst       float64
+	tokens      float64
+	requests    uint64
+	delayed     uint64
+	rateLimited uint64
+	totalWait   time.Duration
+	mu          sync.Mutex
+}
+
+func newRateLimiter(rate float64, burst int, clock Clock) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	now := clock.Now()
+	return &rateLimiter{
+		now:    clock.Now,
+		sleep:  clock.Sleep,
+		since:  now,
+		last:   now,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// reserve takes a token and returns how long the caller must wait before using it
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+elapsed.Seconds()*l.rate)
+		l.last = now
+	}
+
+	l.tokens--
+	l.requests++
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if pause := l.pausedUntil.Sub(now); pause > delay {
+		delay = pause
+	}
+	if delay > 0 {
+		l.delayed++
+		l.totalWait += delay
+	}
+
+	return delay
+}
+
+// cancel returns an unused token reserved for a request that was canceled while waiting
+func (l *rateLimiter) cancel(delay time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = math.Min(l.burst, l.tokens+1)
+	l.requests--
+	if delay > 0 {
+		l.delayed--
+		l.totalWait -= delay
+	}
+}
+
+// wait blocks until a request may be sent or ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	delay := l.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	if err := l.sleep(ctx, delay); err != nil {
+		l.cancel(delay)
+		return errors.Wrap(err, "waiting for rate limiter")
+	}
+	return nil
+}
+
+// pause holds all requests until the given time
+func (l *rateLimiter) pause(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// observe adapts the limiter to the rate limit information in an API response
+func (l *rateLimiter) observe(resp *http.Response) {
+	now := l.now()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		l.mu.Lock()
+		l.rateLimited++
+		l.mu.Unlock()
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+			l.pause(now.Add(after))
+			return
+		}
+	}
+
+	if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
+		if n, err := strconv.Atoi(remaining); err == nil && n <= 0 {
+			if reset, ok := parseRateLimitReset(resp.Header.Get("X-RateLimit-Reset"), now); ok {
+				l.pause(reset)
+			}
+		}
+	}
+}
+
+func (l *rateLimiter) stats() RateLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := RateLimiterStats{
+		Since:       l.since,
+		PausedUntil: l.pausedUntil,
+		Requests:    l.requests,
+		Delayed:     l.delayed,
+		RateLimited: l.rateLimited,
+		TotalWait:   l.totalWait,
+		Rate:        l.rate,
+		Burst:       int(l.burst),
+	}
+	if elapsed := l.now().Sub(l.since).Seconds(); elapsed > 0 {
+		s.Throughput = float64(l.requests) / elapsed
+	}
+
+	return s
+}
+
+// rateLimitTransport sends every request (including retries) through the rate limiter
+type rateLimitTransport struct {
+	next    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		t.limiter.observe(resp)
+	}
+	return resp, err
+}
+
+// RateLimiterStats returns a snapshot of the rate limiter statistics. The zero
+// value is returned if the rate limiter is not enabled (see Config.RateLimit).
+func (a *API) RateLimiterStats() RateLimiterStats {
+	if a.limiter == nil {
+		return RateLimiterStats{}
+	}
+	return a.limiter.stats()
+}
+
+// parseRetryAfter parses a Retry-After header, either delay seconds or an HTTP date
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// parseRateLimitReset parses an X-RateLimit-Reset header, either seconds until
+// the reset or the unix epoch time of the reset
+func parseRateLimitReset(v string, now time.Time) (time.Time, bool) {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	if n > 1e9 { // epoch seconds, otherwise delta seconds
+		return time.Unix(n, 0), true
+	}
+	return now.Add(time.Duration(n) * time.Second), true
+}
@@ -0,0 +1,244 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := newRateLimiter(2, 2, systemClock{})
+	l.now = func() time.Time { return now }
+	l.last = now
+	l.since = now
+
+	// burst is available immediately
+	for i := 0; i < 2; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Fatalf("expected no delay, got %s", d)
+		}
+	}
+
+	// then one token every 1/rate seconds, queued in order
+	if d := l.reserve(); d != 500*time.Millisecond {
+		t.Fatalf("expected 500ms delay, got %s", d)
+	}
+	if d := l.reserve(); d != time.Second {
+		t.Fatalf("expected 1s delay, got %s", d)
+	}
+
+	// refill after time passes
+	now = now.Add(2 * time.Second)
+	if d := l.reserve(); d != 0 {
+		t.Fatalf("expected no delay, got %s", d)
+	}
+
+	// pause requested by the API overrides available tokens
+	now = now.Add(10 * time.Second)
+	l.pause(now.Add(3 * time.Second))
+	if d := l.reserve(); d != 3*time.Second {
+		t.Fatalf("expected 3s delay, got %s", d)
+	}
+
+	s := l.stats()
+	if s.Requests != 6 {
+		t.Fatalf("expected 6 requests, got %d", s.Requests)
+	}
+	if s.Delayed != 3 {
+		t.Fatalf("expected 3 delayed, got %d", s.Delayed)
+	}
+	if s.TotalWait != 4500*time.Millisecond {
+		t.Fatalf("expected 4.5s total wait, got %s", s.TotalWait)
+	}
+	if s.Throughput != 0.5 {
+		t.Fatalf("expected 0.5 req/s throughput, got %f", s.Throughput)
+	}
+}
+
+func TestRateLimiterClock(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	l := newRateLimiter(1, 1, clock)
+
+	for i := 0; i < 3; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+	}
+	if len(clock.sleeps) != 2 || clock.sleeps[0] != time.Second || clock.sleeps[1] != time.Second {
+		t.Fatalf("expected two 1s waits on the clock, got %v", clock.sleeps)
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	l := newRateLimiter(1, 1, systemClock{})
+	l.pause(time.Now().Add(time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := l.wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got (%v)", err)
+	}
+	if s := l.stats(); s.Requests != 0 || s.Delayed != 0 || s.TotalWait != 0 {
+		t.Fatalf("expected canceled request to be returned, got %d requests, %d delayed, %s waiting", s.Requests, s.Delayed, s.TotalWait)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		id       string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{id: "empty", value: "", ok: false},
+		{id: "seconds", value: "11", expected: 11 * time.Second, ok: true},
+		{id: "negative", value: "-1", ok: false},
+		{id: "http date", value: now.Add(30 * time.Second).Format(http.TimeFormat), expected: 30 * time.Second, ok: true},
+		{id: "past http date", value: now.Add(-30 * time.Second).Format(http.TimeFormat), expected: 0, ok: true},
+		{id: "invalid", value: "soon", ok: false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			d, ok := parseRetryAfter(test.value, now)
+			if ok != test.ok {
+				t.Fatalf("expected ok=%t, got %t", test.ok, ok)
+			}
+			if d != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, d)
+			}
+		})
+	}
+}
+
+func TestRetryBackoffRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	apih := &API{clock: &fakeClock{now: now}}
+	min, max := time.Second, 10*time.Second
+
+	tests := []struct {
+		id         string
+		status     int
+		retryAfter string
+		expected   time.Duration
+	}{
+		{id: "429", status: http.StatusTooManyRequests, retryAfter: "3", expected: 3 * time.Second},
+		{id: "503", status: http.StatusServiceUnavailable, retryAfter: "5", expected: 5 * time.Second},
+		{id: "capped at max", status: http.StatusTooManyRequests, retryAfter: "3600", expected: max},
+		{id: "http date", status: http.StatusTooManyRequests, retryAfter: now.Add(7 * time.Second).Format(http.TimeFormat), expected: 7 * time.Second},
+		{id: "far http date capped at max", status: http.StatusTooManyRequests, retryAfter: now.Add(time.Hour).Format(http.TimeFormat), expected: max},
+		{id: "ignored on 500", status: http.StatusInternalServerError, retryAfter: "3", expected: min},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			resp := &http.Response{StatusCode: test.status, Header: http.Header{"Retry-After": []string{test.retryAfter}}}
+			if d := apih.retryBackoff(min, max, 0, resp); d != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, d)
+			}
+		})
+	}
+}
+
+func TestParseRateLimitReset(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	if reset, ok := parseRateLimitReset("5", now); !ok || !reset.Equal(now.Add(5*time.Second)) {
+		t.Fatalf("unexpected delta reset %s %t", reset, ok)
+	}
+	if reset, ok := parseRateLimitReset("1600000060", now); !ok || !reset.Equal(now.Add(time.Minute)) {
+		t.Fatalf("unexpected epoch reset %s %t", reset, ok)
+	}
+	if _, ok := parseRateLimitReset("", now); ok {
+		t.Fatal("expected invalid")
+	}
+}
+
+func TestRateLimitedAPI(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprintln(w, "rate limit")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	}))
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{
+		TokenKey:       "foo",
+		TokenApp:       "bar",
+		URL:            server.URL,
+		RateLimit:      100,
+		RateLimitBurst: 1,
+		MinRetryDelay:  "1ms",
+		MaxRetryDelay:  "5ms",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	start := time.Now()
+	if _, err := apih.Get("/"); err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected Retry-After to be honored, took %s", elapsed)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := apih.Get(fmt.Sprintf("/%d", i)); err != nil {
+				t.Errorf("unexpected error (%s)", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s := apih.RateLimiterStats()
+	if s.Requests != 7 {
+		t.Fatalf("expected 7 requests, got %d", s.Requests)
+	}
+	if s.RateLimited != 1 {
+		t.Fatalf("expected 1 rate limited response, got %d", s.RateLimited)
+	}
+	if s.Delayed == 0 {
+		t.Fatal("expected delayed requests")
+	}
+	if s.Rate != 100 || s.Burst != 1 {
+		t.Fatalf("unexpected rate/burst %f/%d", s.Rate, s.Burst)
+	}
+}
+
+func TestRateLimiterStatsDisabled(t *testing.T) {
+	apih, err := NewAPI(&Config{TokenKey: "foo"})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if s := apih.RateLimiterStats(); s.Requests != 0 || !s.Since.IsZero() {
+		t.Fatalf("expected zero stats, got %#v", s)
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Resource is a typed client for an API endpoint (e.g. /graph). The resource
+// methods (FetchGraph, CreateGraph, ...) are built on one, and the generic
+// Fetch, Search and Create use the Resource registered for the object type. A
+// new endpoint only needs a registered Resource describing it:
+//
+//	var widgets = apiclient.RegisterResource(&apiclient.Resource[Widget]{
+//		Name:     "widget",
+//		Plural:   "widgets",
+//		Prefix:   "/widget",
+//		CIDRegex: `^/widget/[0-9]+$`,
+//		CID:      func(w *Widget) string { return w.CID },
+//	})
+//
+//	widget, err := widgets.Fetch(ctx, client, &cid)
+type Resource[T any] struct {
+	// CID returns the CID of an object (used by Update)
+	CID func(*T) string
+	// Tags returns the tags of an object, optional. Tags are normalized
+	// (lowercase, without blanks or duplicates, sorted) by Create and Update.
+	Tags func(*T) *[]string
+	// LastModified returns the _last_modified of an object, optional. It
+	// enables conflict detection on update (see Config.DetectConflicts and
+	// UpdateWithMerge).
+	LastModified func(*T) uint
+	// SetLastModified sets the _last_modified of an object, required with
+	// LastModified. It is set on merged objects to the server value.
+	SetLastModified func(*T, uint)
+	// kind of the resource CIDs (Prefix without the leading slash)
+	kind string
+	// Name of an object in messages (e.g. "rule set")
+	Name string
+	// Plural name of objects in messages (e.g. "rule sets")
+	Plural string
+	// Prefix is the endpoint path (e.g. "/rule_set")
+	Prefix string
+	// CIDRegex matches valid CIDs, it is the validation used by ParseCID for
+	// CIDs of this resource. Default is any CID starting with Prefix.
+	CIDRegex string
+	// Current fetches Prefix/current for an empty CID (e.g. /user/current)
+	Current bool
+}
+
+var (
+	resources   = map[reflect.Type]interface{}{}
+	resourcesmu sync.RWMutex
+)
+
+// RegisterResource validates r and makes it the resource used by Fetch, Search
+// and Create for objects of type T. It panics if r is invalid, it is meant to
+// be called when initializing a package.
+func RegisterResource[T any](r *Resource[T]) *Resource[T] {
+	if r.Name == "" || r.Prefix == "" || r.CID == nil {
+		panic(fmt.Sprintf("invalid resource %T (name, prefix and cid are required)", r))
+	}
+	if (r.LastModified == nil) != (r.SetLastModified == nil) {
+		panic(fmt.Sprintf("invalid resource %T (last modified and set last modified must both be set)", r))
+	}
+	if r.Plural == "" {
+		r.Plural = r.Name + "s"
+	}
+	if r.CIDRegex == "" {
+		r.CIDRegex = "^" + regexp.QuoteMeta(r.Prefix) + "/.+$"
+	}
+	r.kind = strings.TrimPrefix(r.Prefix, "/")
+	registerCIDKind(r.kind, r.CIDRegex)
+
+	resourcesmu.Lock()
+	resources[reflect.TypeOf((*T)(nil)).Elem()] = r
+	resourcesmu.Unlock()
+
+	return r
+}
+
+// lookupResource returns the resource registered for T
+func lookupResource[T any]() (*Resource[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+
+	resourcesmu.RLock()
+	r, ok := resources[t].(*Resource[T])
+	resourcesmu.RUnlock()
+
+	if !ok {
+		return nil, errors.Errorf("no resource registered for %s", t)
+	}
+	return r, nil
+}
+
+// Fetch retrieves the object of type T with the passed cid, e.g.
+//
+//	graph, err := apiclient.Fetch[apiclient.Graph](ctx, client, "/graph/1234")
+func Fetch[T any](ctx context.Context, a *API, cid string, opts ...CallOption) (*T, error) {
+	r, err := lookupResource[T]()
+	if err != nil {
+		return nil, err
+	}
+	return r.Fetch(ctx, a, &cid, opts...)
+}
+
+// Search returns objects of type T matching the specified search query and/or
+// filter, all objects if both are nil.
+func Search[T any](ctx context.Context, a *API, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]T, error) {
+	r, err := lookupResource[T]()
+	if err != nil {
+		return nil, err
+	}
+	return r.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
+
+// Create creates a new object of type T.
+func Create[T any](ctx context.Context, a *API, cfg *T, opts ...CallOption) (*T, error) {
+	r, err := lookupResource[T]()
+	if err != nil {
+		return nil, err
+	}
+	return r.Create(ctx, a, cfg, opts...)
+}
+
+// normalizeCID returns the full CID (with prefix) for cid, validated
+func (r *Resource[T]) normalizeCID(cid CIDType) (string, error) {
+	switch {
+	case (cid == nil || *cid == "") && r.Current:
+		return r.Prefix + "/current", nil
+	case cid == nil || *cid == "":
+		return "", errors.Errorf("invalid %s CID (none)", r.Name)
+	}
+	return r.parseCID(*cid)
+}
+
+// parseCID returns the full CID for cid (a bare ID, CID or API path) if it is
+// a valid CID of the resource
+func (r *Resource[T]) parseCID(cid string) (string, error) {
+	c, err := ParseCID(r.kind, cid)
+	if err != nil {
+		return "", errors.Errorf("invalid %s CID (%s)", r.Name, cid)
+	}
+	return c.String(), nil
+}
+
+// decode parses an object, or list of objects, received from the API
+func (r *Resource[T]) decode(data []byte, v interface{}, what string) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrapf(err, "parsing %s", what)
+	}
+	return nil
+}
+
+// encode returns the JSON for an object sent to the API, normalizing its tags
+// on a copy so cfg is not changed
+func (r *Resource[T]) encode(cfg *T) ([]byte, error) {
+	if r.Tags != nil {
+		if tags := *r.Tags(cfg); len(tags) > 0 {
+			c := *cfg
+			*r.Tags(&c) = fixTags(tags)
+			cfg = &c
+		}
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "encoding %s", r.Name)
+	}
+
+	return data, nil
+}
+
+// Fetch retrieves the object with the passed cid (a bare ID, CID or API path)
+func (r *Resource[T]) Fetch(ctx context.Context, a *API, cid CIDType, opts ...CallOption) (*T, error) {
+	objCID, err := r.normalizeCID(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := a.cachedGet(ctx, objCID, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching %s", r.Name)
+	}
+
+	a.debugJSON(fmt.Sprintf("fetch %s, received JSON", r.Name), result)
+
+	obj := new(T)
+	if err := r.decode(result, obj, r.Name); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// FetchAll retrieves all objects available to the API Token
+func (r *Resource[T]) FetchAll(ctx context.Context, a *API, opts ...CallOption) (*[]T, error) {
+	result, err := a.GetWithContext(ctx, r.Prefix, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching %s", r.Plural)
+	}
+
+	var objs []T
+	if err := r.decode(result, &objs, r.Plural); err != nil {
+		return nil, err
+	}
+
+	return &objs, nil
+}
+
+// Search returns objects matching the specified search query and/or filter,
+// all objects if both are nil
+func (r *Resource[T]) Search(ctx context.Context, a *API, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]T, error) {
+	q := searchValues(searchCriteria, filterCriteria)
+	if len(q) == 0 {
+		return r.FetchAll(ctx, a, opts...)
+	}
+
+	result, err := a.GetWithContext(ctx, r.Prefix+"?"+q.Encode(), opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "searching %s", r.Plural)
+	}
+
+	var objs []T
+	if err := r.decode(result, &objs, r.Plural); err != nil {
+		return nil, err
+	}
+
+	return &objs, nil
+}
+
+// Iterate calls fn for each object matching the specified search query and/or
+// filter (nil for all), a page at a time (see IterateGraphs)
+func (r *Resource[T]) Iterate(ctx context.Context, a *API, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*T) error) error {
+	err := a.iterate(ctx, r.Prefix, searchValues(searchCriteria, filterCriteria), func(dec *json.Decoder) error {
+		obj := new(T)
+		if err := dec.Decode(obj); err != nil {
+			return errors.Wrapf(err, "parsing %s", r.Name)
+		}
+		return fn(obj)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "iterating %s", r.Plural)
+	}
+
+	return nil
+}
+
+// Create creates a new object
+func (r *Resource[T]) Create(ctx context.Context, a *API, cfg *T, opts ...CallOption) (*T, error) {
+	if cfg == nil {
+		return nil, errors.Errorf("invalid %s config (nil)", r.Name)
+	}
+
+	data, err := r.encode(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a.debugJSON(fmt.Sprintf("create %s, sending JSON", r.Name), data)
+
+	ctx = context.WithValue(ctx, createKey{}, r.Tags != nil)
+	result, err := a.PostWithContext(ctx, r.Prefix, data, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "creating %s", r.Name)
+	}
+
+	a.debugJSON(fmt.Sprintf("create %s, received JSON", r.Name), result)
+
+	obj := new(T)
+	if err := r.decode(result, obj, r.Name); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// Update updates an existing object, identified by its CID
+func (r *Resource[T]) Update(ctx context.Context, a *API, cfg *T, opts ...CallOption) (*T, error) {
+	if cfg == nil {
+		return nil, errors.Errorf("invalid %s config (nil)", r.Name)
+	}
+	return r.update(ctx, a, r.CID(cfg), cfg, opts...)
+}
+
+// update puts cfg to cid (a bare ID, CID or API path), checking for conflicts
+// first if enabled
+func (r *Resource[T]) update(ctx context.Context, a *API, cid string, cfg *T, opts ...CallOption) (*T, error) {
+	objCID, err := r.parseCID(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.detectConflicts && r.LastModified != nil {
+		return r.updateChecked(ctx, a, objCID, cfg, nil, opts...)
+	}
+
+	return r.put(ctx, a, objCID, cfg, opts...)
+}
+
+// put puts cfg to the validated objCID
+func (r *Resource[T]) put(ctx context.Context, a *API, objCID string, cfg *T, opts ...CallOption) (*T, error) {
+	data, err := r.encode(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a.debugJSON(fmt.Sprintf("update %s, sending JSON", r.Name), data)
+
+	result, err := a.PutWithContext(ctx, objCID, data, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "updating %s", r.Name)
+	}
+
+	a.debugJSON(fmt.Sprintf("update %s, received JSON", r.Name), result)
+
+	obj := new(T)
+	if err := r.decode(result, obj, r.Name); err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// Delete deletes the object with the passed cid (a bare ID, CID or API path)
+func (r *Resource[T]) Delete(ctx context.Context, a *API, cid CIDType, opts ...CallOption) (bool, error) {
+	objCID, err := r.normalizeCID(cid)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := a.DeleteWithContext(ctx, objCID, opts...); err != nil {
+		return false, errors.Wrapf(err, "deleting %s", r.Name)
+	}
+
+	return true, nil
+}
+
+// fixTags normalizes tags: lowercase, without blanks or duplicates, sorted
+func fixTags(tags []string) []string {
+	if len(tags) == 0 {
+		return tags
+	}
+
+	unique := make(map[string]bool)
+	var result []string
+
+	for _, tag := range tags {
+		// remove blanks
+		if tag == "" {
+			continue
+		}
+
+		// lowercase
+		tag = strings.ToLower(tag)
+
+		// remove duplicates
+		if _, found := unique[tag]; !found {
+			unique[tag] = true
+			result = append(result, tag)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
@@ -0,0 +1,183 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type testWidget struct {
+	CID  string   `json:"_cid,omitempty"`
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+var testWidgetResource = RegisterResource(&Resource[testWidget]{
+	Name:   "widget",
+	Prefix: "/widget",
+	CID:    func(w *testWidget) string { return w.CID },
+	Tags:   func(w *testWidget) *[]string { return &w.Tags },
+})
+
+func testResourceServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "POST" || r.Method == "PUT":
+			// echo, with a cid
+			var obj map[string]interface{}
+			body, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &obj)
+			if _, ok := obj["_cid"]; !ok {
+				obj["_cid"] = r.URL.Path + "/1"
+			}
+			_ = json.NewEncoder(w).Encode(obj)
+		case r.Method == "GET" && r.URL.RawQuery != "":
+			fmt.Fprintf(w, `[{"_cid":"%s/2","name":%q}]`, r.URL.Path, r.URL.RawQuery)
+		case r.Method == "GET" && (r.URL.Path == "/widget" || r.URL.Path == "/graph"):
+			fmt.Fprintf(w, `[{"_cid":"%s/1"},{"_cid":"%s/2"}]`, r.URL.Path, r.URL.Path)
+		case r.Method == "GET":
+			fmt.Fprintf(w, `{"_cid":%q}`, r.URL.Path)
+		default:
+			w.WriteHeader(204)
+		}
+	}))
+}
+
+func TestResource(t *testing.T) {
+	server := testResourceServer()
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	ctx := context.Background()
+
+	t.Run("fetch", func(t *testing.T) {
+		for _, cid := range []string{"1234", "/widget/1234", "/v2/widget/1234"} {
+			cid := cid
+			w, err := testWidgetResource.Fetch(ctx, apih, &cid)
+			if err != nil {
+				t.Fatalf("unexpected error (%s)", err)
+			}
+			if w.CID != "/widget/1234" {
+				t.Fatalf("unexpected cid (%s)", w.CID)
+			}
+		}
+		if _, err := testWidgetResource.Fetch(ctx, apih, nil); err == nil || err.Error() != "invalid widget CID (none)" {
+			t.Fatalf("expected invalid cid error, got (%v)", err)
+		}
+	})
+
+	t.Run("create normalizes tags", func(t *testing.T) {
+		w, err := testWidgetResource.Create(ctx, apih, &testWidget{Name: "a", Tags: []string{"B:x", "", "a:y", "b:X"}})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if want := []string{"a:y", "b:x"}; !reflect.DeepEqual(w.Tags, want) {
+			t.Fatalf("expected tags %v, got %v", want, w.Tags)
+		}
+		if _, err := testWidgetResource.Create(ctx, apih, nil); err == nil || err.Error() != "invalid widget config (nil)" {
+			t.Fatalf("expected invalid config error, got (%v)", err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		w, err := testWidgetResource.Update(ctx, apih, &testWidget{CID: "/widget/7", Tags: []string{"Z"}})
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if w.CID != "/widget/7" || !reflect.DeepEqual(w.Tags, []string{"z"}) {
+			t.Fatalf("unexpected widget %+v", w)
+		}
+		if _, err := testWidgetResource.Update(ctx, apih, &testWidget{CID: "/invalid"}); err == nil || err.Error() != "invalid widget CID (/invalid)" {
+			t.Fatalf("expected invalid cid error, got (%v)", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		cid := "3"
+		if ok, err := testWidgetResource.Delete(ctx, apih, &cid); err != nil || !ok {
+			t.Fatalf("unexpected result (%t, %v)", ok, err)
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		query := SearchQueryType("blue")
+		ws, err := testWidgetResource.Search(ctx, apih, &query, nil)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if len(*ws) != 1 || (*ws)[0].Name != "search=blue" {
+			t.Fatalf("unexpected widgets %+v", *ws)
+		}
+		all, err := testWidgetResource.Search(ctx, apih, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error (%s)", err)
+		}
+		if len(*all) != 2 {
+			t.Fatalf("expected all widgets, got %+v", *all)
+		}
+	})
+}
+
+func TestGenericEntryPoints(t *testing.T) {
+	server := testResourceServer()
+	defer server.Close()
+
+	apih, err := NewAPI(&Config{TokenKey: "foo", URL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+
+	ctx := context.Background()
+
+	g, err := Fetch[Graph](ctx, apih, "01234")
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if g.CID != "/graph/01234" {
+		t.Fatalf("unexpected cid (%s)", g.CID)
+	}
+
+	filter := SearchFilterType{"f_title": []string{"cpu"}}
+	graphs, err := Search[Graph](ctx, apih, nil, &filter)
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if len(*graphs) != 1 || (*graphs)[0].CID != "/graph/2" {
+		t.Fatalf("unexpected graphs %+v", *graphs)
+	}
+
+	w, err := Create(ctx, apih, &testWidget{Name: "new"})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if w.CID != "/widget/1" {
+		t.Fatalf("unexpected cid (%s)", w.CID)
+	}
+
+	if _, err := Fetch[struct{}](ctx, apih, "1"); err == nil {
+		t.Fatal("expected error for unregistered type")
+	}
+}
+
+func TestRegisterResourceInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	RegisterResource(&Resource[testWidget]{Name: "widget"})
+}
@@ -8,11 +8,8 @@
 package apiclient
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -50,203 +47,155 @@ type RuleSet struct {
 	Tags          []string           `json:"tags"`                     // [] len >= 0
 }
 
+// ruleSetResource describes the rule set endpoint
+var ruleSetResource = RegisterResource(&Resource[RuleSet]{
+	Name:     "rule set",
+	Plural:   "rule sets",
+	Prefix:   config.RuleSetPrefix,
+	CIDRegex: config.RuleSetCIDRegex,
+	CID:      func(o *RuleSet) string { return o.CID },
+	Tags:     func(o *RuleSet) *[]string { return &o.Tags },
+})
+
 // NewRuleSet returns a new RuleSet (with defaults if applicable)
 func NewRuleSet() *RuleSet {
 	return &RuleSet{}
 }
 
 // FetchRuleSet retrieves rule set with passed cid.
-func (a *API) FetchRuleSet(cid CIDType) (*RuleSet, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid rule set CID (none)")
-	}
-
-	var rulesetCID string
-	if !strings.HasPrefix(*cid, config.RuleSetPrefix) {
-		rulesetCID = fmt.Sprintf("%s/%s", config.RuleSetPrefix, *cid)
-	} else {
-		rulesetCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.RuleSetCIDRegex, rulesetCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid rule set CID (%s)", rulesetCID)
-	}
-
-	result, err := a.Get(rulesetCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching rule set")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch rule set, received JSON: %s", string(result))
-	}
-
-	ruleset := &RuleSet{}
-	if err := json.Unmarshal(result, ruleset); err != nil {
-		return nil, errors.Wrap(err, "parsing rule set")
-	}
+func (a *API) FetchRuleSet(cid CIDType, opts ...CallOption) (*RuleSet, error) {
+	return a.FetchRuleSetWithContext(context.Background(), cid, opts...)
+}
 
-	return ruleset, nil
+// FetchRuleSetWithContext is FetchRuleSet with a context for cancellation and deadlines.
+func (a *API) FetchRuleSetWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*RuleSet, error) {
+	return ruleSetResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchRuleSets retrieves all rule sets available to API Token.
-func (a *API) FetchRuleSets() (*[]RuleSet, error) {
-	result, err := a.Get(config.RuleSetPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching rule sets")
-	}
-
-	var rulesets []RuleSet
-	if err := json.Unmarshal(result, &rulesets); err != nil {
-		return nil, errors.Wrap(err, "parsing rule sets")
-	}
+func (a *API) FetchRuleSets(opts ...CallOption) (*[]RuleSet, error) {
+	return a.FetchRuleSetsWithContext(context.Background(), opts...)
+}
 
-	return &rulesets, nil
+// FetchRuleSetsWithContext is FetchRuleSets with a context for cancellation and deadlines.
+func (a *API) FetchRuleSetsWithContext(ctx context.Context, opts ...CallOption) (*[]RuleSet, error) {
+	return ruleSetResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateRuleSet updates passed rule set.
-func (a *API) UpdateRuleSet(cfg *RuleSet) (*RuleSet, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid rule set config (nil)")
-	}
-
-	rulesetCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.RuleSetCIDRegex, rulesetCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid rule set CID (%s)", rulesetCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update rule set, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) UpdateRuleSet(cfg *RuleSet, opts ...CallOption) (*RuleSet, error) {
+	return a.UpdateRuleSetWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Put(rulesetCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating rule set")
-	}
+// UpdateRuleSetWithContext is UpdateRuleSet with a context for cancellation and deadlines.
+func (a *API) UpdateRuleSetWithContext(ctx context.Context, cfg *RuleSet, opts ...CallOption) (*RuleSet, error) {
+	return ruleSetResource.Update(ctx, a, cfg, opts...)
+}
 
-	ruleset := &RuleSet{}
-	if err := json.Unmarshal(result, ruleset); err != nil {
-		return nil, errors.Wrap(err, "parsing rule set")
-	}
+// PatchRuleSet applies patch (see Patcher) to the rule set with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchRuleSet(cid CIDType, patch Patcher, opts ...CallOption) (*RuleSet, error) {
+	return a.PatchRuleSetWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return ruleset, nil
+// PatchRuleSetWithContext is PatchRuleSet with a context for cancellation and deadlines.
+func (a *API) PatchRuleSetWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*RuleSet, error) {
+	return ruleSetResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateRuleSet creates a new rule set.
-func (a *API) CreateRuleSet(cfg *RuleSet) (*RuleSet, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid rule set config (nil)")
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create rule set, sending JSON: %s", string(jsonCfg))
-	}
-
-	resp, err := a.Post(config.RuleSetPrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating rule set")
-	}
-
-	ruleset := &RuleSet{}
-	if err := json.Unmarshal(resp, ruleset); err != nil {
-		return nil, errors.Wrap(err, "parsing rule set")
-	}
+func (a *API) CreateRuleSet(cfg *RuleSet, opts ...CallOption) (*RuleSet, error) {
+	return a.CreateRuleSetWithContext(context.Background(), cfg, opts...)
+}
 
-	return ruleset, nil
+// CreateRuleSetWithContext is CreateRuleSet with a context for cancellation and deadlines.
+func (a *API) CreateRuleSetWithContext(ctx context.Context, cfg *RuleSet, opts ...CallOption) (*RuleSet, error) {
+	return ruleSetResource.Create(ctx, a, cfg, opts...)
 }
 
 // DeleteRuleSet deletes passed rule set.
-func (a *API) DeleteRuleSet(cfg *RuleSet) (bool, error) {
+func (a *API) DeleteRuleSet(cfg *RuleSet, opts ...CallOption) (bool, error) {
+	return a.DeleteRuleSetWithContext(context.Background(), cfg, opts...)
+}
+
+// DeleteRuleSetWithContext is DeleteRuleSet with a context for cancellation and deadlines.
+func (a *API) DeleteRuleSetWithContext(ctx context.Context, cfg *RuleSet, opts ...CallOption) (bool, error) {
 	if cfg == nil {
 		return false, errors.New("invalid rule set config (nil)")
 	}
-	return a.DeleteRuleSetByCID(CIDType(&cfg.CID))
+	return a.DeleteRuleSetByCIDWithContext(ctx, CIDType(&cfg.CID), opts...)
 }
 
 // DeleteRuleSetByCID deletes rule set with passed cid.
-func (a *API) DeleteRuleSetByCID(cid CIDType) (bool, error) {
-	if cid == nil || *cid == "" {
-		return false, errors.New("invalid rule set CID (none)")
-	}
-
-	var rulesetCID string
-	if !strings.HasPrefix(*cid, config.RuleSetPrefix) {
-		rulesetCID = fmt.Sprintf("%s/%s", config.RuleSetPrefix, *cid)
-	} else {
-		rulesetCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.RuleSetCIDRegex, rulesetCID)
-	if err != nil {
-		return false, err
-	}
-	if !matched {
-		return false, errors.Errorf("invalid rule set CID (%s)", rulesetCID)
-	}
-
-	_, err = a.Delete(rulesetCID)
-	if err != nil {
-		return false, errors.Wrap(err, "deleting rule set")
-	}
+func (a *API) DeleteRuleSetByCID(cid CIDType, opts ...CallOption) (bool, error) {
+	return a.DeleteRuleSetByCIDWithContext(context.Background(), cid, opts...)
+}
 
-	return true, nil
+// DeleteRuleSetByCIDWithContext is DeleteRuleSetByCID with a context for cancellation and deadlines.
+func (a *API) DeleteRuleSetByCIDWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (bool, error) {
+	return ruleSetResource.Delete(ctx, a, cid, opts...)
 }
 
 // SearchRuleSets returns rule sets matching the specified search
 // query and/or filter. If nil is passed for both parameters all
 // rule sets will be returned.
-func (a *API) SearchRuleSets(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]RuleSet, error) {
-	q := url.Values{}
+func (a *API) SearchRuleSets(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]RuleSet, error) {
+	return a.SearchRuleSetsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
+// SearchRuleSetsWithContext is SearchRuleSets with a context for cancellation and deadlines.
+func (a *API) SearchRuleSetsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]RuleSet, error) {
+	return ruleSetResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
+// IterateRuleSets calls fn for each rule set matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateRuleSets(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*RuleSet) error) error {
+	return a.IterateRuleSetsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	if q.Encode() == "" {
-		return a.FetchRuleSets()
-	}
+// IterateRuleSetsWithContext is IterateRuleSets with a context for cancellation and deadlines.
+func (a *API) IterateRuleSetsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*RuleSet) error) error {
+	return ruleSetResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	reqURL := url.URL{
-		Path:     config.RuleSetPrefix,
-		RawQuery: q.Encode(),
-	}
+// BulkCreateRuleSets creates rule sets concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateRuleSets(cfgs []*RuleSet, opts *BulkOptions) BulkResults[*RuleSet] {
+	return a.BulkCreateRuleSetsWithContext(context.Background(), cfgs, opts)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching rule sets")
-	}
+// BulkCreateRuleSetsWithContext is BulkCreateRuleSets with a context for cancellation and deadlines.
+func (a *API) BulkCreateRuleSetsWithContext(ctx context.Context, cfgs []*RuleSet, opts *BulkOptions) BulkResults[*RuleSet] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *RuleSet) (*RuleSet, error) {
+		return a.CreateRuleSetWithContext(ctx, cfg)
+	})
+}
 
-	var rulesets []RuleSet
-	if err := json.Unmarshal(result, &rulesets); err != nil {
-		return nil, errors.Wrap(err, "parsing rule sets")
-	}
+// BulkUpdateRuleSets updates rule sets concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateRuleSets(cfgs []*RuleSet, opts *BulkOptions) BulkResults[*RuleSet] {
+	return a.BulkUpdateRuleSetsWithContext(context.Background(), cfgs, opts)
+}
+
+// BulkUpdateRuleSetsWithContext is BulkUpdateRuleSets with a context for cancellation and deadlines.
+func (a *API) BulkUpdateRuleSetsWithContext(ctx context.Context, cfgs []*RuleSet, opts *BulkOptions) BulkResults[*RuleSet] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *RuleSet) (*RuleSet, error) {
+		return a.UpdateRuleSetWithContext(ctx, cfg)
+	})
+}
+
+// BulkDeleteRuleSets deletes rule sets by cid concurrently (see BulkOptions),
+// the results are in the same order as cids.
+func (a *API) BulkDeleteRuleSets(cids []string, opts *BulkOptions) BulkResults[bool] {
+	return a.BulkDeleteRuleSetsWithContext(context.Background(), cids, opts)
+}
 
-	return &rulesets, nil
+// BulkDeleteRuleSetsWithContext is BulkDeleteRuleSets with a context for cancellation and deadlines.
+func (a *API) BulkDeleteRuleSetsWithContext(ctx context.Context, cids []string, opts *BulkOptions) BulkResults[bool] {
+	return Bulk(ctx, cids, opts, func(ctx context.Context, cid string) (bool, error) {
+		return a.DeleteRuleSetByCIDWithContext(ctx, CIDType(&cid))
+	})
 }
@@ -8,11 +8,7 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -41,203 +37,155 @@ type RuleSetGroup struct {
 	RuleSetConditions []RuleSetGroupCondition `json:"rule_set_conditions"` // [] len >= 1
 }
 
+// ruleSetGroupResource describes the rule set group endpoint
+var ruleSetGroupResource = RegisterResource(&Resource[RuleSetGroup]{
+	Name:     "rule set group",
+	Plural:   "rule set groups",
+	Prefix:   config.RuleSetGroupPrefix,
+	CIDRegex: config.RuleSetGroupCIDRegex,
+	CID:      func(o *RuleSetGroup) string { return o.CID },
+	Tags:     func(o *RuleSetGroup) *[]string { return &o.Tags },
+})
+
 // NewRuleSetGroup returns a new RuleSetGroup (with defaults, if applicable)
 func NewRuleSetGroup() *RuleSetGroup {
 	return &RuleSetGroup{}
 }
 
 // FetchRuleSetGroup retrieves rule set group with passed cid.
-func (a *API) FetchRuleSetGroup(cid CIDType) (*RuleSetGroup, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid rule set group CID (none)")
-	}
-
-	var groupCID string
-	if !strings.HasPrefix(*cid, config.RuleSetGroupPrefix) {
-		groupCID = fmt.Sprintf("%s/%s", config.RuleSetGroupPrefix, *cid)
-	} else {
-		groupCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.RuleSetGroupCIDRegex, groupCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid rule set group CID (%s)", groupCID)
-	}
-
-	result, err := a.Get(groupCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching rule set group")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch rule set group, received JSON: %s", string(result))
-	}
-
-	rulesetGroup := &RuleSetGroup{}
-	if err := json.Unmarshal(result, rulesetGroup); err != nil {
-		return nil, errors.Wrap(err, "parsing rule set group")
-	}
+func (a *API) FetchRuleSetGroup(cid CIDType, opts ...CallOption) (*RuleSetGroup, error) {
+	return a.FetchRuleSetGroupWithContext(context.Background(), cid, opts...)
+}
 
-	return rulesetGroup, nil
+// FetchRuleSetGroupWithContext is FetchRuleSetGroup with a context for cancellation and deadlines.
+func (a *API) FetchRuleSetGroupWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*RuleSetGroup, error) {
+	return ruleSetGroupResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchRuleSetGroups retrieves all rule set groups available to API Token.
-func (a *API) FetchRuleSetGroups() (*[]RuleSetGroup, error) {
-	result, err := a.Get(config.RuleSetGroupPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching rule set groups")
-	}
-
-	var rulesetGroups []RuleSetGroup
-	if err := json.Unmarshal(result, &rulesetGroups); err != nil {
-		return nil, errors.Wrap(err, "parsing rule set groups")
-	}
+func (a *API) FetchRuleSetGroups(opts ...CallOption) (*[]RuleSetGroup, error) {
+	return a.FetchRuleSetGroupsWithContext(context.Background(), opts...)
+}
 
-	return &rulesetGroups, nil
+// FetchRuleSetGroupsWithContext is FetchRuleSetGroups with a context for cancellation and deadlines.
+func (a *API) FetchRuleSetGroupsWithContext(ctx context.Context, opts ...CallOption) (*[]RuleSetGroup, error) {
+	return ruleSetGroupResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateRuleSetGroup updates passed rule set group.
-func (a *API) UpdateRuleSetGroup(cfg *RuleSetGroup) (*RuleSetGroup, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid rule set group config (nil)")
-	}
-
-	groupCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.RuleSetGroupCIDRegex, groupCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid rule set group CID (%s)", groupCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating rule set group")
-	}
-
-	if a.Debug {
-		a.Log.Printf("update rule set group, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) UpdateRuleSetGroup(cfg *RuleSetGroup, opts ...CallOption) (*RuleSetGroup, error) {
+	return a.UpdateRuleSetGroupWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Put(groupCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating rule set group")
-	}
+// UpdateRuleSetGroupWithContext is UpdateRuleSetGroup with a context for cancellation and deadlines.
+func (a *API) UpdateRuleSetGroupWithContext(ctx context.Context, cfg *RuleSetGroup, opts ...CallOption) (*RuleSetGroup, error) {
+	return ruleSetGroupResource.Update(ctx, a, cfg, opts...)
+}
 
-	groups := &RuleSetGroup{}
-	if err := json.Unmarshal(result, groups); err != nil {
-		return nil, errors.Wrap(err, "parsing rule set group")
-	}
+// PatchRuleSetGroup applies patch (see Patcher) to the rule set group with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchRuleSetGroup(cid CIDType, patch Patcher, opts ...CallOption) (*RuleSetGroup, error) {
+	return a.PatchRuleSetGroupWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return groups, nil
+// PatchRuleSetGroupWithContext is PatchRuleSetGroup with a context for cancellation and deadlines.
+func (a *API) PatchRuleSetGroupWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*RuleSetGroup, error) {
+	return ruleSetGroupResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateRuleSetGroup creates a new rule set group.
-func (a *API) CreateRuleSetGroup(cfg *RuleSetGroup) (*RuleSetGroup, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid rule set group config (nil)")
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create rule set group, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Post(config.RuleSetGroupPrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating rule set group")
-	}
-
-	group := &RuleSetGroup{}
-	if err := json.Unmarshal(result, group); err != nil {
-		return nil, errors.Wrap(err, "parsing rule set group")
-	}
+func (a *API) CreateRuleSetGroup(cfg *RuleSetGroup, opts ...CallOption) (*RuleSetGroup, error) {
+	return a.CreateRuleSetGroupWithContext(context.Background(), cfg, opts...)
+}
 
-	return group, nil
+// CreateRuleSetGroupWithContext is CreateRuleSetGroup with a context for cancellation and deadlines.
+func (a *API) CreateRuleSetGroupWithContext(ctx context.Context, cfg *RuleSetGroup, opts ...CallOption) (*RuleSetGroup, error) {
+	return ruleSetGroupResource.Create(ctx, a, cfg, opts...)
 }
 
 // DeleteRuleSetGroup deletes passed rule set group.
-func (a *API) DeleteRuleSetGroup(cfg *RuleSetGroup) (bool, error) {
+func (a *API) DeleteRuleSetGroup(cfg *RuleSetGroup, opts ...CallOption) (bool, error) {
+	return a.DeleteRuleSetGroupWithContext(context.Background(), cfg, opts...)
+}
+
+// DeleteRuleSetGroupWithContext is DeleteRuleSetGroup with a context for cancellation and deadlines.
+func (a *API) DeleteRuleSetGroupWithContext(ctx context.Context, cfg *RuleSetGroup, opts ...CallOption) (bool, error) {
 	if cfg == nil {
 		return false, errors.New("invalid rule set group config (nil)")
 	}
-	return a.DeleteRuleSetGroupByCID(CIDType(&cfg.CID))
+	return a.DeleteRuleSetGroupByCIDWithContext(ctx, CIDType(&cfg.CID), opts...)
 }
 
 // DeleteRuleSetGroupByCID deletes rule set group with passed cid.
-func (a *API) DeleteRuleSetGroupByCID(cid CIDType) (bool, error) {
-	if cid == nil || *cid == "" {
-		return false, errors.New("invalid rule set group CID (none)")
-	}
-
-	var groupCID string
-	if !strings.HasPrefix(*cid, config.RuleSetGroupPrefix) {
-		groupCID = fmt.Sprintf("%s/%s", config.RuleSetGroupPrefix, *cid)
-	} else {
-		groupCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.RuleSetGroupCIDRegex, groupCID)
-	if err != nil {
-		return false, err
-	}
-	if !matched {
-		return false, errors.Errorf("invalid rule set group CID (%s)", groupCID)
-	}
-
-	_, err = a.Delete(groupCID)
-	if err != nil {
-		return false, errors.Wrap(err, "deleting rule set group")
-	}
+func (a *API) DeleteRuleSetGroupByCID(cid CIDType, opts ...CallOption) (bool, error) {
+	return a.DeleteRuleSetGroupByCIDWithContext(context.Background(), cid, opts...)
+}
 
-	return true, nil
+// DeleteRuleSetGroupByCIDWithContext is DeleteRuleSetGroupByCID with a context for cancellation and deadlines.
+func (a *API) DeleteRuleSetGroupByCIDWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (bool, error) {
+	return ruleSetGroupResource.Delete(ctx, a, cid, opts...)
 }
 
 // SearchRuleSetGroups returns rule set groups matching the
 // specified search query and/or filter. If nil is passed for
 // both parameters all rule set groups will be returned.
-func (a *API) SearchRuleSetGroups(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]RuleSetGroup, error) {
-	q := url.Values{}
+func (a *API) SearchRuleSetGroups(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]RuleSetGroup, error) {
+	return a.SearchRuleSetGroupsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
+// SearchRuleSetGroupsWithContext is SearchRuleSetGroups with a context for cancellation and deadlines.
+func (a *API) SearchRuleSetGroupsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]RuleSetGroup, error) {
+	return ruleSetGroupResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
+// IterateRuleSetGroups calls fn for each rule set group matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateRuleSetGroups(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*RuleSetGroup) error) error {
+	return a.IterateRuleSetGroupsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	if q.Encode() == "" {
-		return a.FetchRuleSetGroups()
-	}
+// IterateRuleSetGroupsWithContext is IterateRuleSetGroups with a context for cancellation and deadlines.
+func (a *API) IterateRuleSetGroupsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*RuleSetGroup) error) error {
+	return ruleSetGroupResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	reqURL := url.URL{
-		Path:     config.RuleSetGroupPrefix,
-		RawQuery: q.Encode(),
-	}
+// BulkCreateRuleSetGroups creates rule set groups concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateRuleSetGroups(cfgs []*RuleSetGroup, opts *BulkOptions) BulkResults[*RuleSetGroup] {
+	return a.BulkCreateRuleSetGroupsWithContext(context.Background(), cfgs, opts)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching rule set groups")
-	}
+// BulkCreateRuleSetGroupsWithContext is BulkCreateRuleSetGroups with a context for cancellation and deadlines.
+func (a *API) BulkCreateRuleSetGroupsWithContext(ctx context.Context, cfgs []*RuleSetGroup, opts *BulkOptions) BulkResults[*RuleSetGroup] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *RuleSetGroup) (*RuleSetGroup, error) {
+		return a.CreateRuleSetGroupWithContext(ctx, cfg)
+	})
+}
 
-	var groups []RuleSetGroup
-	if err := json.Unmarshal(result, &groups); err != nil {
-		return nil, errors.Wrap(err, "parsing rule set groups")
-	}
+// BulkUpdateRuleSetGroups updates rule set groups concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateRuleSetGroups(cfgs []*RuleSetGroup, opts *BulkOptions) BulkResults[*RuleSetGroup] {
+	return a.BulkUpdateRuleSetGroupsWithContext(context.Background(), cfgs, opts)
+}
+
+// BulkUpdateRuleSetGroupsWithContext is BulkUpdateRuleSetGroups with a context for cancellation and deadlines.
+func (a *API) BulkUpdateRuleSetGroupsWithContext(ctx context.Context, cfgs []*RuleSetGroup, opts *BulkOptions) BulkResults[*RuleSetGroup] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *RuleSetGroup) (*RuleSetGroup, error) {
+		return a.UpdateRuleSetGroupWithContext(ctx, cfg)
+	})
+}
+
+// BulkDeleteRuleSetGroups deletes rule set groups by cid concurrently (see BulkOptions),
+// the results are in the same order as cids.
+func (a *API) BulkDeleteRuleSetGroups(cids []string, opts *BulkOptions) BulkResults[bool] {
+	return a.BulkDeleteRuleSetGroupsWithContext(context.Background(), cids, opts)
+}
 
-	return &groups, nil
+// BulkDeleteRuleSetGroupsWithContext is BulkDeleteRuleSetGroups with a context for cancellation and deadlines.
+func (a *API) BulkDeleteRuleSetGroupsWithContext(ctx context.Context, cids []string, opts *BulkOptions) BulkResults[bool] {
+	return Bulk(ctx, cids, opts, func(ctx context.Context, cid string) (bool, error) {
+		return a.DeleteRuleSetGroupByCIDWithContext(ctx, CIDType(&cid))
+	})
 }
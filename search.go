@@ -0,0 +1,155 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"strings"
+)
+
+// SearchQuery builds a SearchQueryType from terms, quoting and escaping
+// values, e.g.
+//
+//	q := apiclient.NewSearchQuery().Active(true).Field("type", "httptrap").Not().Tag("env:dev")
+//	bundles, err := client.SearchCheckBundles(q.Query(), nil)
+//
+// produces the search (active:1)(type:"httptrap")!(tags:"env:dev").
+type SearchQuery struct {
+	terms  []string
+	negate bool
+}
+
+// NewSearchQuery returns an empty search query
+func NewSearchQuery() *SearchQuery {
+	return &SearchQuery{}
+}
+
+// Not negates the next term
+func (q *SearchQuery) Not() *SearchQuery {
+	q.negate = true
+	return q
+}
+
+// Active adds an (active:1) or (active:0) term
+func (q *SearchQuery) Active(active bool) *SearchQuery {
+	return q.Bool("active", active)
+}
+
+// Bool adds a (field:1) or (field:0) term
+func (q *SearchQuery) Bool(field string, value bool) *SearchQuery {
+	if value {
+		return q.add("(" + field + ":1)")
+	}
+	return q.add("(" + field + ":0)")
+}
+
+// Field adds a (field:"value") term, value is quoted
+func (q *SearchQuery) Field(field, value string) *SearchQuery {
+	return q.add("(" + field + ":" + quoteSearchValue(value) + ")")
+}
+
+// Tag adds a (tags:"category:value") term
+func (q *SearchQuery) Tag(tag string) *SearchQuery {
+	return q.Field("tags", tag)
+}
+
+// Text adds free text, it is quoted if it contains search syntax
+// characters (e.g. parentheses or quotes)
+func (q *SearchQuery) Text(text string) *SearchQuery {
+	if strings.ContainsAny(text, `()":!\`) {
+		text = quoteSearchValue(text)
+	}
+	return q.add(text)
+}
+
+// add appends a term, negated if requested with Not
+func (q *SearchQuery) add(term string) *SearchQuery {
+	if q.negate {
+		term = "!" + term
+		q.negate = false
+	}
+	q.terms = append(q.terms, term)
+	return q
+}
+
+// String returns the search query, parenthesized terms are concatenated and
+// free text is separated by blanks
+func (q *SearchQuery) String() string {
+	var sb strings.Builder
+	for i, term := range q.terms {
+		if i > 0 && (!strings.HasSuffix(q.terms[i-1], ")") || !strings.HasPrefix(strings.TrimPrefix(term, "!"), "(")) {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(term)
+	}
+	return sb.String()
+}
+
+// Query returns the search query for the Search* methods
+func (q *SearchQuery) Query() *SearchQueryType {
+	s := SearchQueryType(q.String())
+	return &s
+}
+
+// quoteSearchValue returns value in double quotes, with backslashes and
+// double quotes escaped
+func quoteSearchValue(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// SearchFilter builds a SearchFilterType, e.g.
+//
+//	f := apiclient.NewSearchFilter().Tags("env:prod").Wildcard("display_name", "web*")
+//	bundles, err := client.SearchCheckBundles(nil, f.Filter())
+//
+// produces the filters f_tags_has=env:prod and f_display_name_wildcard=web*.
+// Multiple values for a filter match any of the values, all filters must match.
+type SearchFilter struct {
+	filter SearchFilterType
+}
+
+// NewSearchFilter returns an empty search filter
+func NewSearchFilter() *SearchFilter {
+	return &SearchFilter{filter: SearchFilterType{}}
+}
+
+// Equals adds f_<field>, matching objects where field is one of values
+func (f *SearchFilter) Equals(field string, values ...string) *SearchFilter {
+	return f.add("f_"+field, values)
+}
+
+// Has adds f_<field>_has, matching objects where the list field contains one
+// of values
+func (f *SearchFilter) Has(field string, values ...string) *SearchFilter {
+	return f.add("f_"+field+"_has", values)
+}
+
+// Tags adds f_tags_has, matching objects with one of tags
+func (f *SearchFilter) Tags(tags ...string) *SearchFilter {
+	return f.Has("tags", tags...)
+}
+
+// Wildcard adds f_<field>_wildcard, matching objects where field matches one
+// of the shell style patterns (e.g. web*)
+func (f *SearchFilter) Wildcard(field string, patterns ...string) *SearchFilter {
+	return f.add("f_"+field+"_wildcard", patterns)
+}
+
+// add appends values to the filter key
+func (f *SearchFilter) add(key string, values []string) *SearchFilter {
+	if f.filter == nil {
+		f.filter = SearchFilterType{}
+	}
+	f.filter[key] = append(f.filter[key], values...)
+	return f
+}
+
+// Filter returns the search filter for the Search* methods
+func (f *SearchFilter) Filter() *SearchFilterType {
+	filter := make(SearchFilterType, len(f.filter))
+	for key, values := range f.filter {
+		filter[key] = append([]string(nil), values...)
+	}
+	return &filter
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package apiclient
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchQuery(t *testing.T) {
+	tests := []struct {
+		query    *SearchQuery
+		id       string
+		expected string
+	}{
+		{id: "empty", query: NewSearchQuery(), expected: ``},
+		{id: "active", query: NewSearchQuery().Active(true), expected: `(active:1)`},
+		{id: "inactive", query: NewSearchQuery().Active(false), expected: `(active:0)`},
+		{id: "field", query: NewSearchQuery().Field("type", "httptrap"), expected: `(type:"httptrap")`},
+		{id: "tag", query: NewSearchQuery().Tag("env:prod"), expected: `(tags:"env:prod")`},
+		{id: "escaped", query: NewSearchQuery().Field("display_name", `say "hi" \o/`), expected: `(display_name:"say \"hi\" \\o/")`},
+		{id: "text", query: NewSearchQuery().Text("web servers"), expected: `web servers`},
+		{id: "quoted text", query: NewSearchQuery().Text("cpu (user)"), expected: `"cpu (user)"`},
+		{id: "negated", query: NewSearchQuery().Not().Field("type", "json"), expected: `!(type:"json")`},
+		{id: "negated text", query: NewSearchQuery().Not().Text("test"), expected: `!test`},
+		{
+			id:       "terms",
+			query:    NewSearchQuery().Active(true).Field("type", "httptrap").Not().Tag("env:dev").Field("target", "10.0.0.1"),
+			expected: `(active:1)(type:"httptrap")!(tags:"env:dev")(target:"10.0.0.1")`,
+		},
+		{id: "terms and text", query: NewSearchQuery().Text("web").Active(true).Text("servers"), expected: `web (active:1) servers`},
+		{id: "bool", query: NewSearchQuery().Bool("reverse", true), expected: `(reverse:1)`},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			if q := string(*test.query.Query()); q != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, q)
+			}
+		})
+	}
+}
+
+func TestSearchFilter(t *testing.T) {
+	tests := []struct {
+		filter   *SearchFilter
+		expected SearchFilterType
+		id       string
+		encoded  string
+	}{
+		{id: "empty", filter: NewSearchFilter(), expected: SearchFilterType{}, encoded: ``},
+		{id: "zero value", filter: (&SearchFilter{}).Tags("a:b"), expected: SearchFilterType{"f_tags_has": {"a:b"}}, encoded: `f_tags_has=a%3Ab`},
+		{id: "equals", filter: NewSearchFilter().Equals("type", "httptrap", "json"), expected: SearchFilterType{"f_type": {"httptrap", "json"}}, encoded: `f_type=httptrap&f_type=json`},
+		{id: "has", filter: NewSearchFilter().Has("brokers", "/broker/1"), expected: SearchFilterType{"f_brokers_has": {"/broker/1"}}, encoded: `f_brokers_has=%2Fbroker%2F1`},
+		{id: "tags", filter: NewSearchFilter().Tags("env:prod").Tags("role:web"), expected: SearchFilterType{"f_tags_has": {"env:prod", "role:web"}}, encoded: `f_tags_has=env%3Aprod&f_tags_has=role%3Aweb`},
+		{
+			id:       "filters",
+			filter:   NewSearchFilter().Tags("env:prod").Wildcard("display_name", "web*"),
+			expected: SearchFilterType{"f_tags_has": {"env:prod"}, "f_display_name_wildcard": {"web*"}},
+			encoded:  `f_display_name_wildcard=web%2A&f_tags_has=env%3Aprod`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.id, func(t *testing.T) {
+			f := test.filter.Filter()
+			if !reflect.DeepEqual(*f, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, *f)
+			}
+			if q := searchValues(nil, f).Encode(); q != test.encoded {
+				t.Fatalf("expected %s, got %s", test.encoded, q)
+			}
+		})
+	}
+
+	t.Run("filter is a copy", func(t *testing.T) {
+		b := NewSearchFilter().Tags("a:b")
+		f := b.Filter()
+		b.Tags("c:d")
+		if len((*f)["f_tags_has"]) != 1 {
+			t.Fatalf("unexpected filter %v", *f)
+		}
+	})
+}
@@ -11,14 +11,9 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
-	"github.com/pkg/errors"
 )
 
 // UserContactInfo defines known contact details
@@ -36,131 +31,91 @@ type User struct {
 	Lastname    string          `json:"lastname"`               // string
 }
 
+// userResource describes the user endpoint
+var userResource = RegisterResource(&Resource[User]{
+	Name:     "user",
+	Plural:   "users",
+	Prefix:   config.UserPrefix,
+	CIDRegex: config.UserCIDRegex,
+	CID:      func(o *User) string { return o.CID },
+	Current:  true,
+})
+
 // FetchUser retrieves user with passed cid. Pass nil for '/user/current'.
-func (a *API) FetchUser(cid CIDType) (*User, error) {
-	var userCID string
-
-	switch {
-	case cid == nil:
-		fallthrough
-	case *cid == "":
-		userCID = config.UserPrefix + "/current"
-	case !strings.HasPrefix(*cid, config.UserPrefix):
-		userCID = fmt.Sprintf("%s/%s", config.UserPrefix, *cid)
-	default:
-		userCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.UserCIDRegex, userCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid user CID (%s)", userCID)
-	}
-
-	result, err := a.Get(userCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching user")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch user, received JSON: %s", string(result))
-	}
-
-	user := new(User)
-	if err := json.Unmarshal(result, user); err != nil {
-		return nil, errors.Wrap(err, "parsing user")
-	}
-
-	return user, nil
+func (a *API) FetchUser(cid CIDType, opts ...CallOption) (*User, error) {
+	return a.FetchUserWithContext(context.Background(), cid, opts...)
 }
 
-// FetchUsers retrieves all users available to API Token.
-func (a *API) FetchUsers() (*[]User, error) {
-	result, err := a.Get(config.UserPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching users")
-	}
+// FetchUserWithContext is FetchUser with a context for cancellation and deadlines.
+func (a *API) FetchUserWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*User, error) {
+	return userResource.Fetch(ctx, a, cid, opts...)
+}
 
-	var users []User
-	if err := json.Unmarshal(result, &users); err != nil {
-		return nil, errors.Wrap(err, "parsing users")
-	}
+// FetchUsers retrieves all users available to API Token.
+func (a *API) FetchUsers(opts ...CallOption) (*[]User, error) {
+	return a.FetchUsersWithContext(context.Background(), opts...)
+}
 
-	return &users, nil
+// FetchUsersWithContext is FetchUsers with a context for cancellation and deadlines.
+func (a *API) FetchUsersWithContext(ctx context.Context, opts ...CallOption) (*[]User, error) {
+	return userResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateUser updates passed user.
-func (a *API) UpdateUser(cfg *User) (*User, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid user config (nil)")
-	}
+func (a *API) UpdateUser(cfg *User, opts ...CallOption) (*User, error) {
+	return a.UpdateUserWithContext(context.Background(), cfg, opts...)
+}
 
-	userCID := cfg.CID
+// UpdateUserWithContext is UpdateUser with a context for cancellation and deadlines.
+func (a *API) UpdateUserWithContext(ctx context.Context, cfg *User, opts ...CallOption) (*User, error) {
+	return userResource.Update(ctx, a, cfg, opts...)
+}
 
-	matched, err := regexp.MatchString(config.UserCIDRegex, userCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid user CID (%s)", userCID)
-	}
+// PatchUser applies patch (see Patcher) to the user with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchUser(cid CIDType, patch Patcher, opts ...CallOption) (*User, error) {
+	return a.PatchUserWithContext(context.Background(), cid, patch, opts...)
+}
+
+// PatchUserWithContext is PatchUser with a context for cancellation and deadlines.
+func (a *API) PatchUserWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*User, error) {
+	return userResource.Patch(ctx, a, cid, patch, opts...)
+}
 
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
+// SearchUsers returns users matching a filter (search queries
+// are not supported by the user endpoint). Pass nil as filter for all
+// users available to the API Token.
+func (a *API) SearchUsers(filterCriteria *SearchFilterType, opts ...CallOption) (*[]User, error) {
+	return a.SearchUsersWithContext(context.Background(), filterCriteria, opts...)
+}
 
-	if a.Debug {
-		a.Log.Printf("update user, sending JSON: %s", string(jsonCfg))
-	}
+// SearchUsersWithContext is SearchUsers with a context for cancellation and deadlines.
+func (a *API) SearchUsersWithContext(ctx context.Context, filterCriteria *SearchFilterType, opts ...CallOption) (*[]User, error) {
+	return userResource.Search(ctx, a, nil, filterCriteria, opts...)
+}
 
-	result, err := a.Put(userCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating user")
-	}
+// IterateUsers calls fn for each user matching a filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateUsers(filterCriteria *SearchFilterType, fn func(*User) error) error {
+	return a.IterateUsersWithContext(context.Background(), filterCriteria, fn)
+}
 
-	user := &User{}
-	if err := json.Unmarshal(result, user); err != nil {
-		return nil, errors.Wrap(err, "parsing user")
-	}
+// IterateUsersWithContext is IterateUsers with a context for cancellation and deadlines.
+func (a *API) IterateUsersWithContext(ctx context.Context, filterCriteria *SearchFilterType, fn func(*User) error) error {
+	return userResource.Iterate(ctx, a, nil, filterCriteria, fn)
+}
 
-	return user, nil
+// BulkUpdateUsers updates users concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateUsers(cfgs []*User, opts *BulkOptions) BulkResults[*User] {
+	return a.BulkUpdateUsersWithContext(context.Background(), cfgs, opts)
 }
 
-// SearchUsers returns users matching a filter (search queries
-// are not supported by the user endpoint). Pass nil as filter for all
-// users available to the API Token.
-func (a *API) SearchUsers(filterCriteria *SearchFilterType) (*[]User, error) {
-	q := url.Values{}
-
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
-
-	if q.Encode() == "" {
-		return a.FetchUsers()
-	}
-
-	reqURL := url.URL{
-		Path:     config.UserPrefix,
-		RawQuery: q.Encode(),
-	}
-
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching users")
-	}
-
-	var users []User
-	if err := json.Unmarshal(result, &users); err != nil {
-		return nil, errors.Wrap(err, "parsing user")
-	}
-
-	return &users, nil
+// BulkUpdateUsersWithContext is BulkUpdateUsers with a context for cancellation and deadlines.
+func (a *API) BulkUpdateUsersWithContext(ctx context.Context, cfgs []*User, opts *BulkOptions) BulkResults[*User] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *User) (*User, error) {
+		return a.UpdateUserWithContext(ctx, cfg)
+	})
 }
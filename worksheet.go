@@ -8,11 +8,7 @@
 package apiclient
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"regexp"
-	"strings"
+	"context"
 
 	"github.com/circonus-labs/go-apiclient/config"
 	"github.com/pkg/errors"
@@ -42,6 +38,16 @@ type Worksheet struct {
 	Favorite     bool                  `json:"favorite"`                // boolean
 }
 
+// worksheetResource describes the worksheet endpoint
+var worksheetResource = RegisterResource(&Resource[Worksheet]{
+	Name:     "worksheet",
+	Plural:   "worksheets",
+	Prefix:   config.WorksheetPrefix,
+	CIDRegex: config.WorksheetCIDRegex,
+	CID:      func(o *Worksheet) string { return o.CID },
+	Tags:     func(o *Worksheet) *[]string { return &o.Tags },
+})
+
 // NewWorksheet returns a new Worksheet (with defaults, if applicable)
 func NewWorksheet() *Worksheet {
 	return &Worksheet{
@@ -50,197 +56,139 @@ func NewWorksheet() *Worksheet {
 }
 
 // FetchWorksheet retrieves worksheet with passed cid.
-func (a *API) FetchWorksheet(cid CIDType) (*Worksheet, error) {
-	if cid == nil || *cid == "" {
-		return nil, errors.New("invalid worksheet CID (none)")
-	}
-
-	var worksheetCID string
-	if !strings.HasPrefix(*cid, config.WorksheetPrefix) {
-		worksheetCID = fmt.Sprintf("%s/%s", config.WorksheetPrefix, *cid)
-	} else {
-		worksheetCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.WorksheetCIDRegex, worksheetCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid worksheet CID (%s)", worksheetCID)
-	}
-
-	result, err := a.Get(worksheetCID)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching worksheet")
-	}
-
-	if a.Debug {
-		a.Log.Printf("fetch worksheet, received JSON: %s", string(result))
-	}
-
-	worksheet := new(Worksheet)
-	if err := json.Unmarshal(result, worksheet); err != nil {
-		return nil, errors.Wrap(err, "parsing worksheet")
-	}
+func (a *API) FetchWorksheet(cid CIDType, opts ...CallOption) (*Worksheet, error) {
+	return a.FetchWorksheetWithContext(context.Background(), cid, opts...)
+}
 
-	return worksheet, nil
+// FetchWorksheetWithContext is FetchWorksheet with a context for cancellation and deadlines.
+func (a *API) FetchWorksheetWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (*Worksheet, error) {
+	return worksheetResource.Fetch(ctx, a, cid, opts...)
 }
 
 // FetchWorksheets retrieves all worksheets available to API Token.
-func (a *API) FetchWorksheets() (*[]Worksheet, error) {
-	result, err := a.Get(config.WorksheetPrefix)
-	if err != nil {
-		return nil, errors.Wrap(err, "fetching worksheets")
-	}
-
-	var worksheets []Worksheet
-	if err := json.Unmarshal(result, &worksheets); err != nil {
-		return nil, errors.Wrap(err, "parsing worksheets")
-	}
+func (a *API) FetchWorksheets(opts ...CallOption) (*[]Worksheet, error) {
+	return a.FetchWorksheetsWithContext(context.Background(), opts...)
+}
 
-	return &worksheets, nil
+// FetchWorksheetsWithContext is FetchWorksheets with a context for cancellation and deadlines.
+func (a *API) FetchWorksheetsWithContext(ctx context.Context, opts ...CallOption) (*[]Worksheet, error) {
+	return worksheetResource.FetchAll(ctx, a, opts...)
 }
 
 // UpdateWorksheet updates passed worksheet.
-func (a *API) UpdateWorksheet(cfg *Worksheet) (*Worksheet, error) {
-	if cfg == nil {
-		return nil, errors.Errorf("invalid worksheet config (nil)")
-	}
-
-	worksheetCID := cfg.CID
-
-	matched, err := regexp.MatchString(config.WorksheetCIDRegex, worksheetCID)
-	if err != nil {
-		return nil, err
-	}
-	if !matched {
-		return nil, errors.Errorf("invalid worksheet CID (%s)", worksheetCID)
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("update worksheet, sending JSON: %s", string(jsonCfg))
-	}
+func (a *API) UpdateWorksheet(cfg *Worksheet, opts ...CallOption) (*Worksheet, error) {
+	return a.UpdateWorksheetWithContext(context.Background(), cfg, opts...)
+}
 
-	result, err := a.Put(worksheetCID, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "updating worksheet")
-	}
+// UpdateWorksheetWithContext is UpdateWorksheet with a context for cancellation and deadlines.
+func (a *API) UpdateWorksheetWithContext(ctx context.Context, cfg *Worksheet, opts ...CallOption) (*Worksheet, error) {
+	return worksheetResource.Update(ctx, a, cfg, opts...)
+}
 
-	worksheet := &Worksheet{}
-	if err := json.Unmarshal(result, worksheet); err != nil {
-		return nil, errors.Wrap(err, "parsing worksheet")
-	}
+// PatchWorksheet applies patch (see Patcher) to the worksheet with the passed cid,
+// changing only the fields set by the patch.
+func (a *API) PatchWorksheet(cid CIDType, patch Patcher, opts ...CallOption) (*Worksheet, error) {
+	return a.PatchWorksheetWithContext(context.Background(), cid, patch, opts...)
+}
 
-	return worksheet, nil
+// PatchWorksheetWithContext is PatchWorksheet with a context for cancellation and deadlines.
+func (a *API) PatchWorksheetWithContext(ctx context.Context, cid CIDType, patch Patcher, opts ...CallOption) (*Worksheet, error) {
+	return worksheetResource.Patch(ctx, a, cid, patch, opts...)
 }
 
 // CreateWorksheet creates a new worksheet.
-func (a *API) CreateWorksheet(cfg *Worksheet) (*Worksheet, error) {
-	if cfg == nil {
-		return nil, errors.New("invalid worksheet config (nil)")
-	}
-
-	jsonCfg, err := json.Marshal(cfg)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.Debug {
-		a.Log.Printf("create worksheet, sending JSON: %s", string(jsonCfg))
-	}
-
-	result, err := a.Post(config.WorksheetPrefix, jsonCfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "creating worksheet")
-	}
-
-	worksheet := &Worksheet{}
-	if err := json.Unmarshal(result, worksheet); err != nil {
-		return nil, errors.Wrap(err, "parsing worksheet")
-	}
+func (a *API) CreateWorksheet(cfg *Worksheet, opts ...CallOption) (*Worksheet, error) {
+	return a.CreateWorksheetWithContext(context.Background(), cfg, opts...)
+}
 
-	return worksheet, nil
+// CreateWorksheetWithContext is CreateWorksheet with a context for cancellation and deadlines.
+func (a *API) CreateWorksheetWithContext(ctx context.Context, cfg *Worksheet, opts ...CallOption) (*Worksheet, error) {
+	return worksheetResource.Create(ctx, a, cfg, opts...)
 }
 
 // DeleteWorksheet deletes passed worksheet.
-func (a *API) DeleteWorksheet(cfg *Worksheet) (bool, error) {
+func (a *API) DeleteWorksheet(cfg *Worksheet, opts ...CallOption) (bool, error) {
+	return a.DeleteWorksheetWithContext(context.Background(), cfg, opts...)
+}
+
+// DeleteWorksheetWithContext is DeleteWorksheet with a context for cancellation and deadlines.
+func (a *API) DeleteWorksheetWithContext(ctx context.Context, cfg *Worksheet, opts ...CallOption) (bool, error) {
 	if cfg == nil {
 		return false, errors.New("invalid worksheet config (nil)")
 	}
-	return a.DeleteWorksheetByCID(CIDType(&cfg.CID))
+	return a.DeleteWorksheetByCIDWithContext(ctx, CIDType(&cfg.CID), opts...)
 }
 
 // DeleteWorksheetByCID deletes worksheet with passed cid.
-func (a *API) DeleteWorksheetByCID(cid CIDType) (bool, error) {
-	if cid == nil || *cid == "" {
-		return false, errors.New("invalid worksheet CID (none)")
-	}
-
-	var worksheetCID string
-	if !strings.HasPrefix(*cid, config.WorksheetPrefix) {
-		worksheetCID = fmt.Sprintf("%s/%s", config.WorksheetPrefix, *cid)
-	} else {
-		worksheetCID = *cid
-	}
-
-	matched, err := regexp.MatchString(config.WorksheetCIDRegex, worksheetCID)
-	if err != nil {
-		return false, err
-	}
-	if !matched {
-		return false, errors.Errorf("invalid worksheet CID (%s)", worksheetCID)
-	}
-
-	_, err = a.Delete(worksheetCID)
-	if err != nil {
-		return false, errors.Wrap(err, "deleting worksheet")
-	}
+func (a *API) DeleteWorksheetByCID(cid CIDType, opts ...CallOption) (bool, error) {
+	return a.DeleteWorksheetByCIDWithContext(context.Background(), cid, opts...)
+}
 
-	return true, nil
+// DeleteWorksheetByCIDWithContext is DeleteWorksheetByCID with a context for cancellation and deadlines.
+func (a *API) DeleteWorksheetByCIDWithContext(ctx context.Context, cid CIDType, opts ...CallOption) (bool, error) {
+	return worksheetResource.Delete(ctx, a, cid, opts...)
 }
 
 // SearchWorksheets returns worksheets matching the specified search
 // query and/or filter. If nil is passed for both parameters all
 // worksheets will be returned.
-func (a *API) SearchWorksheets(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType) (*[]Worksheet, error) {
-	q := url.Values{}
+func (a *API) SearchWorksheets(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Worksheet, error) {
+	return a.SearchWorksheetsWithContext(context.Background(), searchCriteria, filterCriteria, opts...)
+}
 
-	if searchCriteria != nil && *searchCriteria != "" {
-		q.Set("search", string(*searchCriteria))
-	}
+// SearchWorksheetsWithContext is SearchWorksheets with a context for cancellation and deadlines.
+func (a *API) SearchWorksheetsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, opts ...CallOption) (*[]Worksheet, error) {
+	return worksheetResource.Search(ctx, a, searchCriteria, filterCriteria, opts...)
+}
 
-	if filterCriteria != nil && len(*filterCriteria) > 0 {
-		for filter, criteria := range *filterCriteria {
-			for _, val := range criteria {
-				q.Add(filter, val)
-			}
-		}
-	}
+// IterateWorksheets calls fn for each worksheet matching the specified search query and/or filter (nil for all),
+// fetching and decoding them a page at a time rather than loading all of them
+// into memory. Return ErrStopIteration from fn to stop early, any other error
+// stops the iteration and is returned.
+func (a *API) IterateWorksheets(searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Worksheet) error) error {
+	return a.IterateWorksheetsWithContext(context.Background(), searchCriteria, filterCriteria, fn)
+}
 
-	if q.Encode() == "" {
-		return a.FetchWorksheets()
-	}
+// IterateWorksheetsWithContext is IterateWorksheets with a context for cancellation and deadlines.
+func (a *API) IterateWorksheetsWithContext(ctx context.Context, searchCriteria *SearchQueryType, filterCriteria *SearchFilterType, fn func(*Worksheet) error) error {
+	return worksheetResource.Iterate(ctx, a, searchCriteria, filterCriteria, fn)
+}
 
-	reqURL := url.URL{
-		Path:     config.WorksheetPrefix,
-		RawQuery: q.Encode(),
-	}
+// BulkCreateWorksheets creates worksheets concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkCreateWorksheets(cfgs []*Worksheet, opts *BulkOptions) BulkResults[*Worksheet] {
+	return a.BulkCreateWorksheetsWithContext(context.Background(), cfgs, opts)
+}
 
-	result, err := a.Get(reqURL.String())
-	if err != nil {
-		return nil, errors.Wrap(err, "searching worksheets")
-	}
+// BulkCreateWorksheetsWithContext is BulkCreateWorksheets with a context for cancellation and deadlines.
+func (a *API) BulkCreateWorksheetsWithContext(ctx context.Context, cfgs []*Worksheet, opts *BulkOptions) BulkResults[*Worksheet] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Worksheet) (*Worksheet, error) {
+		return a.CreateWorksheetWithContext(ctx, cfg)
+	})
+}
 
-	var worksheets []Worksheet
-	if err := json.Unmarshal(result, &worksheets); err != nil {
-		return nil, errors.Wrap(err, "parsing worksheets")
-	}
+// BulkUpdateWorksheets updates worksheets concurrently (see BulkOptions), the
+// results are in the same order as cfgs.
+func (a *API) BulkUpdateWorksheets(cfgs []*Worksheet, opts *BulkOptions) BulkResults[*Worksheet] {
+	return a.BulkUpdateWorksheetsWithContext(context.Background(), cfgs, opts)
+}
+
+// BulkUpdateWorksheetsWithContext is BulkUpdateWorksheets with a context for cancellation and deadlines.
+func (a *API) BulkUpdateWorksheetsWithContext(ctx context.Context, cfgs []*Worksheet, opts *BulkOptions) BulkResults[*Worksheet] {
+	return Bulk(ctx, cfgs, opts, func(ctx context.Context, cfg *Worksheet) (*Worksheet, error) {
+		return a.UpdateWorksheetWithContext(ctx, cfg)
+	})
+}
+
+// BulkDeleteWorksheets deletes worksheets by cid concurrently (see BulkOptions),
+// the results are in the same order as cids.
+func (a *API) BulkDeleteWorksheets(cids []string, opts *BulkOptions) BulkResults[bool] {
+	return a.BulkDeleteWorksheetsWithContext(context.Background(), cids, opts)
+}
 
-	return &worksheets, nil
+// BulkDeleteWorksheetsWithContext is BulkDeleteWorksheets with a context for cancellation and deadlines.
+func (a *API) BulkDeleteWorksheetsWithContext(ctx context.Context, cids []string, opts *BulkOptions) BulkResults[bool] {
+	return Bulk(ctx, cids, opts, func(ctx context.Context, cid string) (bool, error) {
+		return a.DeleteWorksheetByCIDWithContext(ctx, CIDType(&cid))
+	})
 }
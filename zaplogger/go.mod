@@ -0,0 +1,17 @@
+module github.com/circonus-labs/go-apiclient/zaplogger
+
+go 1.17
+
+require (
+	github.com/circonus-labs/go-apiclient v0.0.0-00010101000000-000000000000
+	go.uber.org/zap v1.27.0
+)
+
+require (
+	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
+	github.com/hashicorp/go-retryablehttp v0.7.5 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
+)
+
+replace github.com/circonus-labs/go-apiclient => ../
@@ -0,0 +1,53 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zaplogger adapts a zap logger for use as an apiclient.StructuredLogger
+//
+//	client, err := apiclient.New(&apiclient.Config{
+//		TokenKey:         "...",
+//		StructuredLogger: zaplogger.New(zapLogger),
+//	})
+package zaplogger
+
+import (
+	apiclient "github.com/circonus-labs/go-apiclient"
+	"go.uber.org/zap"
+)
+
+// Logger is an apiclient.StructuredLogger logging to zap
+type Logger struct {
+	l *zap.SugaredLogger
+}
+
+var _ apiclient.StructuredLogger = (*Logger)(nil)
+
+// New returns a StructuredLogger using the passed zap logger
+func New(l *zap.Logger) *Logger {
+	return &Logger{l: l.Sugar()}
+}
+
+// NewSugared returns a StructuredLogger using the passed sugared zap logger
+func NewSugared(l *zap.SugaredLogger) *Logger {
+	return &Logger{l: l}
+}
+
+// Debug logs a message with key/value pairs at debug level
+func (z *Logger) Debug(msg string, keysAndValues ...interface{}) {
+	z.l.Debugw(msg, keysAndValues...)
+}
+
+// Info logs a message with key/value pairs at info level
+func (z *Logger) Info(msg string, keysAndValues ...interface{}) {
+	z.l.Infow(msg, keysAndValues...)
+}
+
+// Warn logs a message with key/value pairs at warn level
+func (z *Logger) Warn(msg string, keysAndValues ...interface{}) {
+	z.l.Warnw(msg, keysAndValues...)
+}
+
+// Error logs a message with key/value pairs at error level
+func (z *Logger) Error(msg string, keysAndValues ...interface{}) {
+	z.l.Errorw(msg, keysAndValues...)
+}
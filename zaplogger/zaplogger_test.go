@@ -0,0 +1,50 @@
+// Copyright 2016 Circonus, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zaplogger
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	l := New(zap.New(core))
+
+	l.Debug("debug msg", "cid", "/check_bundle/1")
+	l.Info("info msg", "n", 1)
+	l.Warn("warn msg")
+	l.Error("error msg", "err", "boom")
+
+	entries := logs.All()
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+
+	expected := []struct {
+		level zapcore.Level
+		msg   string
+	}{
+		{zapcore.DebugLevel, "debug msg"},
+		{zapcore.InfoLevel, "info msg"},
+		{zapcore.WarnLevel, "warn msg"},
+		{zapcore.ErrorLevel, "error msg"},
+	}
+	for i, e := range expected {
+		if entries[i].Level != e.level || entries[i].Message != e.msg {
+			t.Fatalf("entry %d: expected %s %q, got %s %q", i, e.level, e.msg, entries[i].Level, entries[i].Message)
+		}
+	}
+
+	if cid := entries[0].ContextMap()["cid"]; cid != "/check_bundle/1" {
+		t.Fatalf("expected cid field, got %v", cid)
+	}
+	if err := entries[3].ContextMap()["err"]; err != "boom" {
+		t.Fatalf("expected err field, got %v", err)
+	}
+}